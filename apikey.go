@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nkhamm-spb/red_soft_test/auth"
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// runAPIKey управляет ключами API в таблице api_keys:
+//
+//	apikey create reports
+//	apikey revoke reports
+//
+// create выводит новый ключ один раз, в базе остается только его sha256.
+// Ключи из таблицы принимаются, если включен server.auth.api_keys_table.
+func runAPIKey(ctx context.Context, config *config.Config, args []string) error {
+	if len(args) != 2 || args[1] == "" {
+		return fmt.Errorf("Usage: apikey create|revoke name")
+	}
+	name := args[1]
+
+	storage, err := storage.Open(ctx, &config.Storage)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		key, err := auth.GenerateAPIKey()
+		if err != nil {
+			return err
+		}
+		if err := storage.CreateAPIKey(ctx, name, auth.HashAPIKey(key)); err != nil {
+			return err
+		}
+
+		fmt.Printf("Api key %s: %s\n", name, key)
+		return nil
+	case "revoke":
+		if err := storage.RevokeAPIKey(ctx, name); err != nil {
+			return err
+		}
+
+		fmt.Printf("Api key %s revoked\n", name)
+		return nil
+	default:
+		return fmt.Errorf("Unknown apikey command: %s", args[0])
+	}
+}
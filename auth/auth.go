@@ -0,0 +1,142 @@
+// Package auth проверяет ключи API и JWT токены запросов к HTTP серверу.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// ErrUnauthorized запрос без учетных данных или с неверными. Остальные
+// ошибки Authenticate означают, что проверить их не удалось.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Principal кто выполняет запрос: имя ключа API или sub токена.
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+}
+
+// Actor автор изменений для истории пользователя, например api_key:reports.
+func (principal *Principal) Actor() string {
+	return principal.Method + ":" + principal.Subject
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext возвращает nil, если запрос не проверялся, например
+// на открытом пути или при выключенной проверке.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// KeyStore ключи API из базы. FindAPIKey возвращает имя действующего ключа
+// по sha256 или storage.ErrNotFound.
+type KeyStore interface {
+	FindAPIKey(ctx context.Context, hash string) (string, error)
+}
+
+type Authenticator struct {
+	keys     map[string]string
+	keyStore KeyStore
+	jwt      *jwtVerifier
+}
+
+// New создает проверку по конфигу. keyStore нужен только при api_keys_table.
+// Должен быть задан хотя бы один способ проверки, что бы сервер не оказался
+// открытым из-за пустого конфига.
+func New(config *config.Auth, keyStore KeyStore) (*Authenticator, error) {
+	authenticator := &Authenticator{keys: make(map[string]string)}
+
+	for _, key := range config.APIKeys {
+		hash := strings.ToLower(key.SHA256)
+		if key.Name == "" || len(hash) != 64 {
+			return nil, fmt.Errorf("Wrong api key %q: name and sha256 in hex are required", key.Name)
+		}
+		authenticator.keys[hash] = key.Name
+	}
+
+	if config.APIKeysTable {
+		if keyStore == nil {
+			return nil, fmt.Errorf("api_keys_table is not supported by storage")
+		}
+		authenticator.keyStore = keyStore
+	}
+
+	if config.JWT.HMACSecret != "" || config.JWT.JWKSFile != "" {
+		verifier, err := newJWTVerifier(&config.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.jwt = verifier
+	}
+
+	if len(authenticator.keys) == 0 && authenticator.keyStore == nil && authenticator.jwt == nil {
+		return nil, fmt.Errorf("No auth method is configured, set server.auth or server.auth.disabled")
+	}
+
+	return authenticator, nil
+}
+
+// Authenticate проверяет X-API-Key или Authorization: Bearer.
+func (authenticator *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return authenticator.AuthenticateAPIKey(r.Context(), key)
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") && token != "" {
+		return authenticator.AuthenticateToken(strings.TrimSpace(token))
+	}
+
+	return nil, fmt.Errorf("Missing credentials: %w", ErrUnauthorized)
+}
+
+func (authenticator *Authenticator) AuthenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	hash := HashAPIKey(key)
+
+	if name, ok := authenticator.keys[hash]; ok {
+		return &Principal{Subject: name, Method: MethodAPIKey}, nil
+	}
+
+	if authenticator.keyStore != nil {
+		name, err := authenticator.keyStore.FindAPIKey(ctx, hash)
+		if err == nil {
+			return &Principal{Subject: name, Method: MethodAPIKey}, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("Invalid api key: %w", ErrUnauthorized)
+}
+
+func (authenticator *Authenticator) AuthenticateToken(token string) (*Principal, error) {
+	if authenticator.jwt == nil {
+		return nil, fmt.Errorf("Bearer tokens are not accepted: %w", ErrUnauthorized)
+	}
+
+	subject, err := authenticator.jwt.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: subject, Method: MethodJWT}, nil
+}
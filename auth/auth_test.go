@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken подписывает токен функцией sign от строки header.claims.
+func signToken(t *testing.T, header map[string]string, claims map[string]interface{}, sign func(input []byte) []byte) string {
+	input := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func hmacSign(input []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	for key, value := range overrides {
+		result[key] = value
+	}
+	return result
+}
+
+func TestAPIKeys(t *testing.T) {
+	_, err := New(&config.Auth{}, nil)
+	require.Error(t, err)
+
+	memory := storage.NewMemory()
+	require.NoError(t, memory.CreateAPIKey(context.Background(), "importer", HashAPIKey("table-key")))
+
+	authenticator, err := New(&config.Auth{
+		APIKeys:      []config.APIKey{{Name: "reports", SHA256: HashAPIKey("config-key")}},
+		APIKeysTable: true,
+	}, memory)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest("GET", "/api/v1/users", nil)
+	request.Header.Set(APIKeyHeader, "config-key")
+	principal, err := authenticator.Authenticate(request)
+	require.NoError(t, err)
+	require.Equal(t, &Principal{Subject: "reports", Method: MethodAPIKey}, principal)
+	require.Equal(t, "api_key:reports", principal.Actor())
+
+	principal, err = authenticator.AuthenticateAPIKey(context.Background(), "table-key")
+	require.NoError(t, err)
+	require.Equal(t, "importer", principal.Subject)
+
+	require.NoError(t, memory.RevokeAPIKey(context.Background(), "importer"))
+	_, err = authenticator.AuthenticateAPIKey(context.Background(), "table-key")
+	require.True(t, errors.Is(err, ErrUnauthorized))
+
+	_, err = authenticator.Authenticate(httptest.NewRequest("GET", "/api/v1/users", nil))
+	require.True(t, errors.Is(err, ErrUnauthorized))
+
+	request.Header.Set(APIKeyHeader, "")
+	request.Header.Set("Authorization", "Bearer token")
+	_, err = authenticator.Authenticate(request)
+	require.True(t, errors.Is(err, ErrUnauthorized))
+}
+
+func TestHMACToken(t *testing.T) {
+	authenticator, err := New(&config.Auth{JWT: config.JWT{HMACSecret: testSecret, Issuer: "issuer", Audience: "users"}}, nil)
+	require.NoError(t, err)
+
+	hs256 := map[string]string{"alg": "HS256", "typ": "JWT"}
+	valid := claims(map[string]interface{}{"iss": "issuer", "aud": []string{"other", "users"}})
+
+	request := httptest.NewRequest("GET", "/api/v1/users", nil)
+	request.Header.Set("Authorization", "Bearer "+signToken(t, hs256, valid, hmacSign))
+	principal, err := authenticator.Authenticate(request)
+	require.NoError(t, err)
+	require.Equal(t, &Principal{Subject: "alice", Method: MethodJWT}, principal)
+
+	invalid := map[string]string{
+		"expired":       signToken(t, hs256, claims(map[string]interface{}{"iss": "issuer", "aud": "users", "exp": time.Now().Add(-time.Minute).Unix()}), hmacSign),
+		"not yet valid": signToken(t, hs256, claims(map[string]interface{}{"iss": "issuer", "aud": "users", "nbf": time.Now().Add(time.Minute).Unix()}), hmacSign),
+		"without exp":   signToken(t, hs256, map[string]interface{}{"sub": "alice", "iss": "issuer", "aud": "users"}, hmacSign),
+		"wrong issuer":  signToken(t, hs256, claims(map[string]interface{}{"iss": "other", "aud": "users"}), hmacSign),
+		"wrong aud":     signToken(t, hs256, claims(map[string]interface{}{"iss": "issuer", "aud": "other"}), hmacSign),
+		"without sub":   signToken(t, hs256, claims(map[string]interface{}{"iss": "issuer", "aud": "users", "sub": ""}), hmacSign),
+		"alg none":      signToken(t, map[string]string{"alg": "none"}, valid, func([]byte) []byte { return nil }),
+		"wrong secret": signToken(t, hs256, valid, func(input []byte) []byte {
+			mac := hmac.New(sha256.New, []byte("another secret another secret !!"))
+			mac.Write(input)
+			return mac.Sum(nil)
+		}),
+		"malformed": "abc.def",
+	}
+	for name, token := range invalid {
+		_, err := authenticator.AuthenticateToken(token)
+		require.True(t, errors.Is(err, ErrUnauthorized), name)
+	}
+
+	_, err = New(&config.Auth{JWT: config.JWT{HMACSecret: "short"}}, nil)
+	require.Error(t, err)
+}
+
+func TestJWKSToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	encodeInt := func(value *big.Int, size int) string {
+		return base64.RawURLEncoding.EncodeToString(value.FillBytes(make([]byte, size)))
+	}
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeInt(rsaKey.N, 256), "e": encodeInt(big.NewInt(int64(rsaKey.E)), 3)},
+		{"kty": "EC", "kid": "ec", "alg": "ES256", "crv": "P-256", "x": encodeInt(ecKey.X, 32), "y": encodeInt(ecKey.Y, 32)},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPublic)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	authenticator, err := New(&config.Auth{JWT: config.JWT{JWKSFile: path}}, nil)
+	require.NoError(t, err)
+
+	digest := func(input []byte) []byte {
+		sum := sha256.Sum256(input)
+		return sum[:]
+	}
+	rsaSign := func(input []byte) []byte {
+		signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest(input))
+		require.NoError(t, err)
+		return signature
+	}
+	ecSign := func(input []byte) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest(input))
+		require.NoError(t, err)
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	for _, token := range []string{
+		signToken(t, map[string]string{"alg": "RS256", "kid": "rsa"}, claims(nil), rsaSign),
+		signToken(t, map[string]string{"alg": "RS256"}, claims(nil), rsaSign),
+		signToken(t, map[string]string{"alg": "PS256", "kid": "rsa"}, claims(nil), func(input []byte) []byte {
+			signature, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest(input), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			require.NoError(t, err)
+			return signature
+		}),
+		signToken(t, map[string]string{"alg": "ES256", "kid": "ec"}, claims(nil), ecSign),
+		signToken(t, map[string]string{"alg": "EdDSA", "kid": "ed"}, claims(nil), func(input []byte) []byte {
+			return ed25519.Sign(edKey, input)
+		}),
+	} {
+		principal, err := authenticator.AuthenticateToken(token)
+		require.NoError(t, err)
+		require.Equal(t, "alice", principal.Subject)
+	}
+
+	for name, token := range map[string]string{
+		"wrong kid":     signToken(t, map[string]string{"alg": "RS256", "kid": "ec"}, claims(nil), rsaSign),
+		"alg of key":    signToken(t, map[string]string{"alg": "ES384", "kid": "ec"}, claims(nil), ecSign),
+		"hmac with rsa": signToken(t, map[string]string{"alg": "HS256", "kid": "rsa"}, claims(nil), hmacSign),
+		"wrong signature": func() string {
+			token := signToken(t, map[string]string{"alg": "ES256", "kid": "ec"}, claims(nil), ecSign)
+			return token[:len(token)-4] + "AAAA"
+		}(),
+	} {
+		_, err := authenticator.AuthenticateToken(token)
+		require.True(t, errors.Is(err, ErrUnauthorized), name)
+	}
+}
@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+)
+
+// jwk открытый ключ из файла JWKS.
+type jwk struct {
+	ID  string
+	Alg string
+	Key crypto.PublicKey
+}
+
+type jwtVerifier struct {
+	secret   []byte
+	keys     []jwk
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+func newJWTVerifier(config *config.JWT) (*jwtVerifier, error) {
+	verifier := &jwtVerifier{
+		secret:   []byte(config.HMACSecret),
+		issuer:   config.Issuer,
+		audience: config.Audience,
+		leeway:   config.Leeway,
+		now:      time.Now,
+	}
+
+	if config.HMACSecret != "" && len(config.HMACSecret) < 32 {
+		return nil, fmt.Errorf("jwt.hmac_secret must be at least 32 bytes")
+	}
+
+	if config.JWKSFile != "" {
+		data, err := os.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error read jwks: %w", err)
+		}
+		if verifier.keys, err = parseJWKS(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return verifier, nil
+}
+
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS читает открытые ключи RSA, EC и Ed25519 (RFC 7517). Ключи
+// шифрования и ключи других типов пропускаются.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("Error decode jwks: %w", err)
+	}
+
+	var keys []jwk
+	for i, item := range set.Keys {
+		if item.Use != "" && item.Use != "sig" {
+			continue
+		}
+
+		key, err := item.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("Wrong jwks key %d %q: %w", i, item.Kid, err)
+		}
+		if key != nil {
+			keys = append(keys, jwk{ID: item.Kid, Alg: item.Alg, Key: key})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No signing keys in jwks")
+	}
+	return keys, nil
+}
+
+func (item *jwkJSON) publicKey() (crypto.PublicKey, error) {
+	switch item.Kty {
+	case "RSA":
+		n, err := decodeInt(item.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(item.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key must be at least 2048 bits")
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("wrong rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var checker ecdh.Curve
+		switch item.Crv {
+		case "P-256":
+			curve, checker = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, checker = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, checker = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", item.Crv)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := base64.RawURLEncoding.DecodeString(item.X)
+		if err != nil || len(x) != size {
+			return nil, fmt.Errorf("wrong x")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(item.Y)
+		if err != nil || len(y) != size {
+			return nil, fmt.Errorf("wrong y")
+		}
+		// ecdh проверяет, что точка лежит на кривой.
+		if _, err := checker.NewPublicKey(slices.Concat([]byte{4}, x, y)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if item.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", item.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(item.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("wrong x")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("wrong number %q", value)
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// audience aud токена, строка или массив строк.
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*aud = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*aud = many
+	return nil
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid token, "+format+": %w", append(args, ErrUnauthorized)...)
+}
+
+// verify проверяет подпись и утверждения токена и возвращает sub.
+func (verifier *jwtVerifier) verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", invalidToken("malformed")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", invalidToken("malformed header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", invalidToken("malformed signature")
+	}
+
+	if err := verifier.verifySignature(&header, parts[0]+"."+parts[1], signature); err != nil {
+		return "", err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", invalidToken("malformed claims")
+	}
+
+	now := verifier.now()
+	if claims.ExpiresAt == nil {
+		return "", invalidToken("exp is required")
+	}
+	if now.After(unixTime(*claims.ExpiresAt).Add(verifier.leeway)) {
+		return "", invalidToken("expired")
+	}
+	if claims.NotBefore != nil && now.Add(verifier.leeway).Before(unixTime(*claims.NotBefore)) {
+		return "", invalidToken("not valid yet")
+	}
+	if verifier.issuer != "" && claims.Issuer != verifier.issuer {
+		return "", invalidToken("wrong issuer")
+	}
+	if verifier.audience != "" && !slices.Contains(claims.Audience, verifier.audience) {
+		return "", invalidToken("wrong audience")
+	}
+	if claims.Subject == "" {
+		return "", invalidToken("sub is required")
+	}
+
+	return claims.Subject, nil
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, 0).Add(time.Duration(seconds * float64(time.Second)))
+}
+
+var algHashes = map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+// ecCurveBits кривая ключа для каждого ES алгоритма (RFC 7518, 3.4).
+var ecCurveBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+// verifySignature выбирает способ проверки по alg. Алгоритм должен
+// соответствовать типу ключа, иначе открытый ключ можно было бы выдать за
+// секрет HMAC.
+func (verifier *jwtVerifier) verifySignature(header *jwtHeader, input string, signature []byte) error {
+	if header.Alg == "EdDSA" {
+		return verifier.verifyKeys(header, func(key crypto.PublicKey) bool {
+			edKey, ok := key.(ed25519.PublicKey)
+			return ok && ed25519.Verify(edKey, []byte(input), signature)
+		})
+	}
+
+	if len(header.Alg) != 5 {
+		return invalidToken("unsupported alg %q", header.Alg)
+	}
+	hash, ok := algHashes[header.Alg[2:]]
+	if !ok {
+		return invalidToken("unsupported alg %q", header.Alg)
+	}
+
+	if header.Alg[:2] == "HS" {
+		if len(verifier.secret) == 0 {
+			return invalidToken("unsupported alg %q", header.Alg)
+		}
+		mac := hmac.New(hash.New, verifier.secret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalidToken("wrong signature")
+		}
+		return nil
+	}
+
+	digest := hash.New()
+	digest.Write([]byte(input))
+	sum := digest.Sum(nil)
+
+	switch header.Alg[:2] {
+	case "RS":
+		return verifier.verifyKeys(header, func(key crypto.PublicKey) bool {
+			rsaKey, ok := key.(*rsa.PublicKey)
+			return ok && rsa.VerifyPKCS1v15(rsaKey, hash, sum, signature) == nil
+		})
+	case "PS":
+		return verifier.verifyKeys(header, func(key crypto.PublicKey) bool {
+			rsaKey, ok := key.(*rsa.PublicKey)
+			return ok && rsa.VerifyPSS(rsaKey, hash, sum, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		})
+	case "ES":
+		return verifier.verifyKeys(header, func(key crypto.PublicKey) bool {
+			ecKey, ok := key.(*ecdsa.PublicKey)
+			if !ok || ecKey.Curve.Params().BitSize != ecCurveBits[header.Alg] {
+				return false
+			}
+			// Подпись JWS r и s фиксированной длины подряд (RFC 7518, 3.4).
+			size := (ecKey.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				return false
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			return ecdsa.Verify(ecKey, sum, r, s)
+		})
+	default:
+		return invalidToken("unsupported alg %q", header.Alg)
+	}
+}
+
+// verifyKeys проверяет подпись ключом kid или, если kid не задан, всеми
+// ключами из JWKS подходящего алгоритма.
+func (verifier *jwtVerifier) verifyKeys(header *jwtHeader, check func(key crypto.PublicKey) bool) error {
+	for _, key := range verifier.keys {
+		if header.Kid != "" && key.ID != header.Kid {
+			continue
+		}
+		if key.Alg != "" && key.Alg != header.Alg {
+			continue
+		}
+		if check(key.Key) {
+			return nil
+		}
+	}
+	return invalidToken("wrong signature")
+}
@@ -2,24 +2,166 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Server  Server  `yaml:"server"`
-	Storage Storage `yaml:"storage"`
+	Server     Server     `yaml:"server"`
+	Storage    Storage    `yaml:"storage"`
+	Enrichment Enrichment `yaml:"enrichment"`
 }
 
 type Server struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+
+	// Дата отключения старых маршрутов /api/users/... для заголовка Sunset.
+	LegacySunset time.Time `yaml:"legacy_sunset"`
+
+	Auth Auth `yaml:"auth"`
+}
+
+// Auth проверка запросов к HTTP серверу. Запрос принимается, если подошел
+// любой из способов: ключ API в заголовке X-API-Key или JWT в заголовке
+// Authorization: Bearer.
+type Auth struct {
+	// Disabled пропускает все запросы без проверки, автором изменений
+	// становится заголовок X-Actor. Только для локального запуска.
+	Disabled bool `yaml:"disabled"`
+
+	// APIKeys ключи из конфига. Хранится только sha256 ключа в hex, например
+	// вывод echo -n "$KEY" | sha256sum.
+	APIKeys []APIKey `yaml:"api_keys"`
+	// APIKeysTable проверять ключи также по таблице api_keys, ключи
+	// добавляются командой apikey.
+	APIKeysTable bool `yaml:"api_keys_table"`
+
+	JWT JWT `yaml:"jwt"`
+
+	// PublicPaths пути, открытые без проверки. Путь с / в конце открывает все
+	// пути с этим началом. По умолчанию /health и /swagger/, пустой список
+	// закрывает все пути.
+	PublicPaths *[]string `yaml:"public_paths"`
+}
+
+type APIKey struct {
+	// Name автор изменений, сделанных с этим ключом.
+	Name   string `yaml:"name"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// JWT проверка токенов Bearer. Подпись проверяется секретом HMAC (HS256,
+// HS384, HS512) или открытыми ключами из файла JWKS (RS*, PS*, ES*).
+// Токен без exp отклоняется, автором изменений становится sub.
+type JWT struct {
+	HMACSecret string `yaml:"hmac_secret"`
+	JWKSFile   string `yaml:"jwks_file"`
+	// Если заданы, iss и aud токена должны совпадать.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Допустимое расхождение часов при проверке exp и nbf.
+	Leeway time.Duration `yaml:"leeway"`
 }
 
 type Storage struct {
+	Type     string `yaml:"type"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Name     string `yaml:"name"`
+
+	// Сколько удаленные пользователи хранятся до окончательного удаления командой purge.
+	DeletedRetention time.Duration `yaml:"deleted_retention"`
+}
+
+type Enrichment struct {
+	// Провайдеры опрашиваются параллельно, при совпадении полей приоритет
+	// у провайдера, указанного раньше.
+	Providers []Provider `yaml:"providers"`
+
+	// Ниже этих порогов поле остается неизвестным, а не заполняется догадкой.
+	MinConfidence MinConfidence `yaml:"min_confidence"`
+
+	Cache    Cache      `yaml:"cache"`
+	Batch    Batch      `yaml:"batch"`
+	HTTP     HTTPClient `yaml:"http"`
+	Worker   Worker     `yaml:"worker"`
+	Reenrich Reenrich   `yaml:"reenrich"`
+}
+
+type Provider struct {
+	Name     string `yaml:"name"`
+	BaseURL  string `yaml:"base_url"`
+	Disabled bool   `yaml:"disabled"`
+	// Path файл набора данных для провайдера offline.
+	Path string `yaml:"path"`
+	// Fallback провайдеры опрашиваются, только если основные вернули ошибку,
+	// и заполняют поля, которые основные не определили.
+	Fallback bool `yaml:"fallback"`
+}
+
+type MinConfidence struct {
+	// Минимальная вероятность пола и первой национальности от 0 до 1.
+	Gender      float64 `yaml:"gender"`
+	Nationality float64 `yaml:"nationality"`
+	// Минимальное число записей, по которым определен возраст.
+	AgeCount int `yaml:"age_count"`
+}
+
+type Cache struct {
+	// Размер LRU в памяти, 0 выключает его.
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+	// Хранить результаты в таблице Postgres, что бы кэш переживал перезапуск.
+	Persistent bool `yaml:"persistent"`
+}
+
+// Batch объединение запросов к провайдерам, поддерживающим несколько имен
+// в одном запросе. Запрос уходит, когда набралось size имен или прошло
+// window с первого из них. size меньше 2 выключает объединение.
+type Batch struct {
+	Size   int           `yaml:"size"`
+	Window time.Duration `yaml:"window"`
+}
+
+// HTTPClient настройки запросов к провайдерам обогащения.
+type HTTPClient struct {
+	// Таймаут одной попытки запроса.
+	Timeout time.Duration `yaml:"timeout"`
+	// Повторы на сетевых ошибках, 429 и 5xx с экспоненциальной задержкой
+	// от backoff_base до backoff_max. Retry-After провайдера учитывается.
+	MaxRetries  int           `yaml:"max_retries"`
+	BackoffBase time.Duration `yaml:"backoff_base"`
+	BackoffMax  time.Duration `yaml:"backoff_max"`
+	// После breaker_threshold неудач подряд запросы к провайдеру не
+	// выполняются breaker_cooldown. 0 выключает circuit breaker.
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+// Worker настройки фонового обогащения новых пользователей.
+type Worker struct {
+	// Число параллельных обработчиков.
+	Workers int `yaml:"workers"`
+	// Сколько заданий обработчик забирает и выполняет одновременно, что бы
+	// их запросы к провайдерам объединялись в пакеты.
+	BatchSize int `yaml:"batch_size"`
+	// Как часто проверять очередь, когда она пуста.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Время на одну попытку. Задание, не завершенное за это время, например
+	// из-за остановки сервиса, выполнится повторно.
+	Lease time.Duration `yaml:"lease"`
+	// После max_attempts попыток пользователь получает статус partial или failed.
+	MaxAttempts int           `yaml:"max_attempts"`
+	BackoffBase time.Duration `yaml:"backoff_base"`
+	BackoffMax  time.Duration `yaml:"backoff_max"`
+}
+
+// Reenrich настройки повторного обогащения существующих пользователей.
+type Reenrich struct {
+	// Сколько пользователей в секунду ставить в очередь обогащения.
+	Rate float64 `yaml:"rate"`
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -15,9 +15,146 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/users": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить пользователей постранично с фильтрами и сортировкой",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Получить страницу пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Курсор следующей страницы из next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Минимальный возраст",
+                        "name": "min_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальный возраст",
+                        "name": "max_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Пол",
+                        "name": "gender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Национальность",
+                        "name": "nationalize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало имени",
+                        "name": "name_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало фамилии",
+                        "name": "surname_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фамилия целиком, с учетом регистра",
+                        "name": "surname",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Домен почты",
+                        "name": "email_domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Поля сортировки через запятую, минус для убывания, например -age,name",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Посчитать общее количество",
+                        "name": "with_total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.UserPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/api/users/add_user": {
             "post": {
-                "description": "Добавить пользователя",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Добавить пользователя. Возраст, пол и национальность заполняются в фоне,\nдо завершения enrichment_status равен pending, см. /api/v1/users/{id}/enrichment.\nПочты сохраняются без пробелов по краям, с доменом в нижнем регистре и в punycode",
                 "consumes": [
                     "application/json"
                 ],
@@ -41,19 +178,45 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Устаревший add_user",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/schemas.User"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Почта уже принадлежит пользователю owner_id",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
                         }
                     }
                 }
@@ -61,6 +224,14 @@ const docTemplate = `{
         },
         "/api/users/get_all": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Получить всех пользователей",
                 "consumes": [
                     "application/json"
@@ -76,17 +247,22 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.User"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
                         }
                     }
                 }
@@ -94,7 +270,15 @@ const docTemplate = `{
         },
         "/api/users/get_by_surname/{surname}": {
             "get": {
-                "description": "Получить данные пользователя по фамилии",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить всех пользователей с точно совпадающей фамилией по возрастанию id",
                 "consumes": [
                     "application/json"
                 ],
@@ -104,7 +288,7 @@ const docTemplate = `{
                 "tags": [
                     "example"
                 ],
-                "summary": "Получить данные пользователя по фамилии",
+                "summary": "Получить пользователей по фамилии",
                 "parameters": [
                     {
                         "type": "string",
@@ -118,17 +302,107 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.User"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/delete_user": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Помечает пользователя удаленным, до окончательного удаления его можно восстановить",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Удалить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя, удаление выполнится, только если он не изменился",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Устаревший delete_user",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Пользователь изменился после получения ETag",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
                         }
                     }
                 }
@@ -136,9 +410,19 @@ const docTemplate = `{
         },
         "/api/users/{id}/edit_user": {
             "put": {
-                "description": "Изменить пользователя",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "PUT заменяет пользователя целиком, отсутствующие поля очищаются.\nPATCH принимает application/merge-patch+json (RFC 7396) и application/json-patch+json (RFC 6902)\nнад документом schemas.EditUser, например [{\"op\":\"add\",\"path\":\"/emails/-\",\"value\":\"a@test.com\"}].\napplication/json обрабатывается как merge patch. Неизвестные поля отклоняются.",
                 "consumes": [
-                    "application/json"
+                    "application/json",
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
                 ],
                 "produces": [
                     "application/json"
@@ -156,7 +440,13 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Данные для редактирования",
+                        "type": "string",
+                        "description": "ETag пользователя, изменение выполнится, только если он не изменился. Без него изменение повторяется поверх одновременной записи",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Данные для редактирования или массив операций JSON Patch",
                         "name": "input",
                         "in": "body",
                         "required": true,
@@ -169,25 +459,77 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Не выполнена операция test или почта уже принадлежит пользователю owner_id",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Пользователь изменился после получения ETag",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/api/users/{id}/get_user": {
+        "/api/users/{id}/enrichment": {
             "get": {
-                "description": "Получить данные пользователя по id",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить пользователя с enrichment_status. С параметром wait запрос ждет,\nпока статус pending не сменится, но не дольше wait",
                 "consumes": [
                     "application/json"
                 ],
@@ -197,7 +539,7 @@ const docTemplate = `{
                 "tags": [
                     "example"
                 ],
-                "summary": "Получить данные пользователя по id",
+                "summary": "Статус обогащения пользователя",
                 "parameters": [
                     {
                         "type": "integer",
@@ -205,73 +547,1992 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сколько ждать завершения, например 30s, не больше 1m",
+                        "name": "wait",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "schemas.EditUser": {
-            "type": "object",
-            "properties": {
-                "age": {
-                    "type": "integer"
-                },
-                "emails": {
+        },
+        "/api/users/{id}/get_user": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить данные пользователя по id. ETag ответа можно передать в If-None-Match,\nчто бы получить 304 без тела, если пользователь не менялся, и в If-Match при изменении",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Получить данные пользователя по id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag из предыдущего ответа",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Состояние пользователя на момент в RFC 3339, например 2024-03-01T12:00:00Z",
+                        "name": "as_of",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Пользователь не менялся"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Пользователь окончательно удален, история очищена",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/purge_user": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Безвозвратно удаляет мягко удаленного пользователя и его почты. Неудаленного пользователя сначала нужно удалить, иначе 409",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Окончательно удалить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Пользователь не удален",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/restore_user": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Восстановить удаленного, но еще не удаленного окончательно пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Восстановить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/reenrich": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Поставить выбранных пользователей в очередь обогащения. Запуск идет в фоне,\nполя, измененные вручную, не перезаписываются. Ответы провайдеров запрашиваются мимо кэша",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Повторно обогатить пользователей",
+                "parameters": [
+                    {
+                        "description": "Фильтры и скорость",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Reenrich"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить пользователей постранично с фильтрами и сортировкой",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Получить страницу пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Курсор следующей страницы из next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Минимальный возраст",
+                        "name": "min_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальный возраст",
+                        "name": "max_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Пол",
+                        "name": "gender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Национальность",
+                        "name": "nationalize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало имени",
+                        "name": "name_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало фамилии",
+                        "name": "surname_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фамилия целиком, с учетом регистра",
+                        "name": "surname",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Домен почты",
+                        "name": "email_domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Поля сортировки через запятую, минус для убывания, например -age,name",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Посчитать общее количество",
+                        "name": "with_total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.UserPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Добавить пользователя. Возраст, пол и национальность заполняются в фоне,\nдо завершения enrichment_status равен pending, см. /api/v1/users/{id}/enrichment.\nПочты сохраняются без пробелов по краям, с доменом в нижнем регистре и в punycode",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Добавить пользователя",
+                "parameters": [
+                    {
+                        "description": "Данные пользователя",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.NewUser"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Устаревший add_user",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Почта уже принадлежит пользователю owner_id",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/by-email/{email}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Адрес сравнивается без учета регистра, домен можно указать как в punycode, так и в юникоде",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Получить пользователя по почте",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Почта пользователя",
+                        "name": "email",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/export": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выгрузка потоком всех пользователей, подходящих под фильтры списка, в CSV, NDJSON или XLSX.\nemails задает запись почт: join в одной колонке через email_separator, rows строка на каждую почту,\ncolumns колонки email_1 ... email_N, лишние почты дописываются в последнюю.\nОшибка посреди выгрузки обрывает ответ",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Выгрузить пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "csv, ndjson или xlsx, по умолчанию csv",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Колонки через запятую: id, name, surname, age, gender, nationalize, emails, enrichment_status, created_at, version, gender_probability, age_count",
+                        "name": "columns",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "join, rows или columns, по умолчанию join",
+                        "name": "emails",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Разделитель почт, по умолчанию ;",
+                        "name": "email_separator",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Число колонок почт для columns, по умолчанию 3",
+                        "name": "email_columns",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Минимальный возраст",
+                        "name": "min_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальный возраст",
+                        "name": "max_age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Пол",
+                        "name": "gender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Национальность",
+                        "name": "nationalize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало имени",
+                        "name": "name_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало фамилии",
+                        "name": "surname_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фамилия целиком, с учетом регистра",
+                        "name": "surname",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Домен почты",
+                        "name": "email_domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Поля сортировки через запятую, минус для убывания, например -age,name",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/import": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Добавляет пользователей из CSV (text/csv, заголовок name,surname,emails, почты через ;)\nили NDJSON (application/x-ndjson, по объекту schemas.NewUser в строке).\nСтроки проверяются как в add_user, занятые почты и повторы внутри файла отмечаются как duplicate.\nВозраст, пол и национальность не запрашиваются до вставки: пользователи создаются в статусе pending,\nи очередь обогащения заполняет их в фоне пакетными запросами к провайдерам. Статус виден в /users/{id}/enrichment.\ndry_run только проверяет строки, atomic сохраняет пользователей, только если все строки приняты",
+                "consumes": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Импорт пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "csv или ndjson, по умолчанию по Content-Type",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только проверить",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Все или ничего",
+                        "name": "atomic",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/importer.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Атомарный импорт отменен из-за отклоненных строк",
+                        "schema": {
+                            "$ref": "#/definitions/importer.Report"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/search": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Нечеткий и полнотекстовый поиск по имени, фамилии и почте без учета регистра и диакритики.\nКириллица и латиница совпадают, например Пётр находится по Petr и Pyotr.\nРезультаты упорядочены по убыванию score, в matches совпавшие слова обернуты в \u003cmark\u003e",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Поиск пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Строка поиска",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимум результатов",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.SearchResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить данные пользователя по id. ETag ответа можно передать в If-None-Match,\nчто бы получить 304 без тела, если пользователь не менялся, и в If-Match при изменении",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Получить данные пользователя по id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag из предыдущего ответа",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Состояние пользователя на момент в RFC 3339, например 2024-03-01T12:00:00Z",
+                        "name": "as_of",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Пользователь не менялся"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Пользователь окончательно удален, история очищена",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "PUT заменяет пользователя целиком, отсутствующие поля очищаются.\nPATCH принимает application/merge-patch+json (RFC 7396) и application/json-patch+json (RFC 6902)\nнад документом schemas.EditUser, например [{\"op\":\"add\",\"path\":\"/emails/-\",\"value\":\"a@test.com\"}].\napplication/json обрабатывается как merge patch. Неизвестные поля отклоняются.",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Изменить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя, изменение выполнится, только если он не изменился. Без него изменение повторяется поверх одновременной записи",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Данные для редактирования или массив операций JSON Patch",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.EditUser"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Не выполнена операция test или почта уже принадлежит пользователю owner_id",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Пользователь изменился после получения ETag",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Помечает пользователя удаленным, до окончательного удаления его можно восстановить",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Удалить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя, удаление выполнится, только если он не изменился",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Устаревший delete_user",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Пользователь изменился после получения ETag",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "PUT заменяет пользователя целиком, отсутствующие поля очищаются.\nPATCH принимает application/merge-patch+json (RFC 7396) и application/json-patch+json (RFC 6902)\nнад документом schemas.EditUser, например [{\"op\":\"add\",\"path\":\"/emails/-\",\"value\":\"a@test.com\"}].\napplication/json обрабатывается как merge patch. Неизвестные поля отклоняются.",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Изменить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя, изменение выполнится, только если он не изменился. Без него изменение повторяется поверх одновременной записи",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Данные для редактирования или массив операций JSON Patch",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.EditUser"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Не выполнена операция test или почта уже принадлежит пользователю owner_id",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Пользователь изменился после получения ETag",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{id}/enrichment": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Получить пользователя с enrichment_status. С параметром wait запрос ждет,\nпока статус pending не сменится, но не дольше wait",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Статус обогащения пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сколько ждать завершения, например 30s, не больше 1m",
+                        "name": "wait",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{id}/history": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Записи истории от старых к новым: кто, когда и в каком запросе изменил пользователя,\nи значения полей до и после. История доступна после мягкого удаления, после purge ответ 410",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "История изменений пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Только изменения поля, например nationalize",
+                        "name": "field",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.AuditRecord"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Пользователь окончательно удален, история очищена",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{id}/purge": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Безвозвратно удаляет мягко удаленного пользователя и его почты. Неудаленного пользователя сначала нужно удалить, иначе 409",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Окончательно удалить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Пользователь не удален",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Восстановить удаленного, но еще не удаленного окончательно пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Восстановить пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный ключ API или токен",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/httphandlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Отвечает, пока сервер принимает запросы. Открыт без ключа по умолчанию",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "example"
+                ],
+                "summary": "Проверка живости",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "httphandlers.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.FieldError"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "owner_id": {
+                    "type": "integer"
+                },
+                "request_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "importer.Report": {
+            "type": "object",
+            "properties": {
+                "atomic": {
+                    "type": "boolean"
+                },
+                "committed": {
+                    "type": "boolean"
+                },
+                "created": {
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "duplicates": {
+                    "type": "integer"
+                },
+                "invalid": {
+                    "type": "integer"
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/importer.Row"
+                    }
+                }
+            }
+        },
+        "importer.Row": {
+            "type": "object",
+            "properties": {
+                "duplicate_of_line": {
+                    "type": "integer"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.FieldError"
+                    }
+                },
+                "line": {
+                    "type": "integer"
+                },
+                "owner_id": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "schemas.AuditRecord": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "changed_at": {
+                    "type": "string"
+                },
+                "changes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/schemas.FieldChange"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "schemas.EditUser": {
+            "type": "object",
+            "required": [
+                "name",
+                "surname"
+            ],
+            "properties": {
+                "age": {
+                    "type": "integer",
+                    "maximum": 150,
+                    "minimum": 0
+                },
+                "emails": {
                     "type": "array",
+                    "maxItems": 10,
+                    "uniqueItems": true,
                     "items": {
                         "type": "string"
                     }
                 },
                 "gender": {
-                    "type": "string"
+                    "type": "string",
+                    "enum": [
+                        "male",
+                        "female"
+                    ]
                 },
                 "name": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "nationalize": {
                     "type": "string"
                 },
                 "surname": {
+                    "type": "string",
+                    "maxLength": 100
+                }
+            }
+        },
+        "schemas.FieldChange": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                }
+            }
+        },
+        "schemas.FieldSources": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "string"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "nationalize": {
                     "type": "string"
                 }
             }
         },
+        "schemas.Nationality": {
+            "type": "object",
+            "properties": {
+                "country": {
+                    "type": "string"
+                },
+                "probability": {
+                    "type": "number"
+                }
+            }
+        },
         "schemas.NewUser": {
+            "type": "object",
+            "required": [
+                "name",
+                "surname"
+            ],
+            "properties": {
+                "emails": {
+                    "type": "array",
+                    "maxItems": 10,
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "surname": {
+                    "type": "string",
+                    "maxLength": 100
+                }
+            }
+        },
+        "schemas.Reenrich": {
+            "type": "object",
+            "properties": {
+                "created_before": {
+                    "type": "string"
+                },
+                "empty_fields": {
+                    "type": "boolean"
+                },
+                "nationalize": {
+                    "type": "string"
+                },
+                "rate": {
+                    "description": "Пользователей в секунду, 0 значение из конфига.",
+                    "type": "number"
+                },
+                "run": {
+                    "description": "Имя запуска для продолжения с контрольной точки.",
+                    "type": "string",
+                    "maxLength": 100
+                }
+            }
+        },
+        "schemas.SearchMatch": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "highlight": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "schemas.SearchResult": {
+            "type": "object",
+            "properties": {
+                "matches": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.SearchMatch"
+                    }
+                },
+                "score": {
+                    "type": "number"
+                },
+                "user": {
+                    "$ref": "#/definitions/schemas.User"
+                }
+            }
+        },
+        "schemas.User": {
             "type": "object",
             "properties": {
+                "age": {
+                    "type": "integer"
+                },
+                "age_count": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "type": "string"
+                },
                 "emails": {
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
+                "enrichment_status": {
+                    "description": "EnrichmentStatus одно из значений Enrichment*.",
+                    "type": "string"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "gender_probability": {
+                    "description": "Достоверность данных от провайдеров, 0 если неизвестна.",
+                    "type": "number"
+                },
+                "id": {
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
                 },
+                "nationalities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.Nationality"
+                    }
+                },
+                "nationalize": {
+                    "type": "string"
+                },
+                "sources": {
+                    "$ref": "#/definitions/schemas.FieldSources"
+                },
                 "surname": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version увеличивается при каждом изменении, отдается как ETag.",
+                    "type": "integer"
+                }
+            }
+        },
+        "schemas.UserPage": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.User"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "description": "JWT токен в виде Bearer \u003ctoken\u003e",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/exporter"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// runExport выгружает пользователей в файл или stdout:
+//
+//	export [-format csv|ndjson|xlsx] [-columns id,name,emails] [-emails join|rows|columns]
+//		[-email-separator ;] [-email-columns 3] [-gender male] [-sort -age] users.csv
+//
+// Формат по умолчанию определяется по расширению файла. При ошибке файл удаляется.
+func runExport(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+
+	var options exporter.Options
+	var columns, sort string
+	var minAge, maxAge int
+	flags.StringVar(&options.Format, "format", "", "csv, ndjson or xlsx, default from file extension")
+	flags.StringVar(&columns, "columns", "", "comma separated columns, default "+strings.Join(exporter.DefaultColumns, ","))
+	flags.StringVar(&options.Emails, "emails", exporter.EmailsJoin, "join, rows or columns")
+	flags.StringVar(&options.EmailSeparator, "email-separator", exporter.DefaultEmailSeparator, "separator of joined emails")
+	flags.IntVar(&options.EmailColumns, "email-columns", exporter.DefaultEmailColumns, "email columns for -emails columns")
+	flags.IntVar(&minAge, "min-age", -1, "only users with age at least")
+	flags.IntVar(&maxAge, "max-age", -1, "only users with age at most")
+	flags.StringVar(&options.Filter.Gender, "gender", "", "only users with this gender")
+	flags.StringVar(&options.Filter.Nationalize, "nationalize", "", "only users with this nationalize")
+	flags.StringVar(&options.Filter.NamePrefix, "name-prefix", "", "only users with name starting with")
+	flags.StringVar(&options.Filter.SurnamePrefix, "surname-prefix", "", "only users with surname starting with")
+	flags.StringVar(&options.Filter.Surname, "surname", "", "only users with exactly this surname")
+	flags.StringVar(&options.Filter.EmailDomain, "email-domain", "", "only users with email in domain")
+	flags.StringVar(&sort, "sort", "", "sort fields, for example -age,name")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: export [flags] file|-")
+	}
+
+	if columns != "" {
+		options.Columns = strings.Split(columns, ",")
+	}
+	if minAge >= 0 {
+		options.Filter.MinAge = &minAge
+	}
+	if maxAge >= 0 {
+		options.Filter.MaxAge = &maxAge
+	}
+
+	var err error
+	if options.Filter.Sort, err = storage.ParseSort(sort); err != nil {
+		return err
+	}
+
+	path := flags.Arg(0)
+	if options.Format == "" && path != "-" {
+		options.Format = exporter.FormatFromName(strings.ToLower(path))
+	}
+	if options.Format == "" {
+		return fmt.Errorf("Unknown format, use -format csv, -format ndjson or -format xlsx")
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	userStorage, err := storage.Open(ctx, &config.Storage)
+	if err != nil {
+		return err
+	}
+
+	if path == "-" {
+		_, err := exporter.Export(ctx, userStorage, os.Stdout, options)
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	count, err := exporter.Export(ctx, userStorage, file, options)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Неполный файл легко принять за целый.
+		os.Remove(path)
+		return err
+	}
+
+	fmt.Printf("Exported users: %d\n", count)
+	return nil
+}
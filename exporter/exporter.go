@@ -0,0 +1,252 @@
+// Package exporter выгружает пользователей потоком в CSV, NDJSON или XLSX.
+//
+// Пользователи читаются из storage.StorageInterface.Export по одному и сразу
+// записываются, так что память не зависит от размера выгрузки.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// Форматы выгрузки.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Способы записи почт пользователя.
+const (
+	// Все почты в одной колонке emails через EmailSeparator.
+	EmailsJoin = "join"
+	// Строка на каждую почту с колонкой email, остальные колонки повторяются.
+	// Пользователь без почт выгружается одной строкой с пустой почтой.
+	EmailsRows = "rows"
+	// Колонки email_1 ... email_N. Почты сверх N дописываются в последнюю
+	// колонку через EmailSeparator.
+	EmailsColumns = "columns"
+)
+
+const (
+	DefaultEmailSeparator = ";"
+	DefaultEmailColumns   = 3
+	MaxEmailColumns       = 50
+)
+
+// DefaultColumns колонки, если Options.Columns не задан.
+var DefaultColumns = []string{"id", "name", "surname", "age", "gender", "nationalize", "emails", "enrichment_status", "created_at"}
+
+// columns значения колонок пользователя, кроме emails.
+var columns = map[string]func(user *schemas.User) interface{}{
+	"id":                 func(user *schemas.User) interface{} { return user.ID },
+	"name":               func(user *schemas.User) interface{} { return user.Name },
+	"surname":            func(user *schemas.User) interface{} { return user.Surname },
+	"age":                func(user *schemas.User) interface{} { return user.Age },
+	"gender":             func(user *schemas.User) interface{} { return user.Gender },
+	"nationalize":        func(user *schemas.User) interface{} { return user.Nationalize },
+	"enrichment_status":  func(user *schemas.User) interface{} { return user.EnrichmentStatus },
+	"created_at":         func(user *schemas.User) interface{} { return user.CreatedAt },
+	"version":            func(user *schemas.User) interface{} { return user.Version },
+	"gender_probability": func(user *schemas.User) interface{} { return user.GenderProbability },
+	"age_count":          func(user *schemas.User) interface{} { return user.AgeCount },
+}
+
+// ErrFormat неизвестный формат выгрузки.
+var ErrFormat = errors.New("Wrong export format")
+
+type Options struct {
+	Format  string
+	Columns []string
+	// Emails одно из Emails*, по умолчанию EmailsJoin.
+	Emails         string
+	EmailSeparator string
+	EmailColumns   int
+	// Filter фильтры и сортировка как у списка пользователей, курсор и limit
+	// не используются.
+	Filter storage.ListOptions
+}
+
+// FormatFromName формат по расширению файла, пустая строка если не подходит ни один.
+func FormatFromName(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"):
+		return FormatNDJSON
+	case strings.HasSuffix(name, ".xlsx"):
+		return FormatXLSX
+	}
+	return ""
+}
+
+// ContentType MIME тип формата.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Validate проверяет опции и заполняет значения по умолчанию.
+func (options *Options) Validate() error {
+	if !slices.Contains([]string{FormatCSV, FormatNDJSON, FormatXLSX}, options.Format) {
+		return fmt.Errorf("Unknown export format %s: %w", options.Format, ErrFormat)
+	}
+
+	var fields []storage.FieldError
+
+	if len(options.Columns) == 0 {
+		options.Columns = DefaultColumns
+	}
+	seen := make(map[string]bool)
+	for _, column := range options.Columns {
+		if _, ok := columns[column]; !ok && column != "emails" {
+			fields = append(fields, storage.FieldError{Field: "columns", Message: "unknown column " + column})
+		} else if seen[column] {
+			fields = append(fields, storage.FieldError{Field: "columns", Message: "duplicate column " + column})
+		}
+		seen[column] = true
+	}
+
+	if options.Emails == "" {
+		options.Emails = EmailsJoin
+	}
+	if !slices.Contains([]string{EmailsJoin, EmailsRows, EmailsColumns}, options.Emails) {
+		fields = append(fields, storage.FieldError{Field: "emails", Message: "must be one of: join, rows, columns"})
+	}
+	if options.EmailSeparator == "" {
+		options.EmailSeparator = DefaultEmailSeparator
+	}
+	if options.EmailColumns == 0 {
+		options.EmailColumns = DefaultEmailColumns
+	}
+	if options.EmailColumns < 1 || options.EmailColumns > MaxEmailColumns {
+		fields = append(fields, storage.FieldError{Field: "email_columns", Message: fmt.Sprintf("must be from 1 to %d", MaxEmailColumns)})
+	}
+
+	if len(fields) > 0 {
+		return &storage.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// header названия колонок с учетом способа записи почт.
+func (options *Options) header() []string {
+	header := make([]string, 0, len(options.Columns)+options.EmailColumns)
+	for _, column := range options.Columns {
+		if column != "emails" {
+			header = append(header, column)
+			continue
+		}
+
+		switch options.Emails {
+		case EmailsJoin:
+			header = append(header, "emails")
+		case EmailsRows:
+			header = append(header, "email")
+		case EmailsColumns:
+			for i := 1; i <= options.EmailColumns; i++ {
+				header = append(header, fmt.Sprintf("email_%d", i))
+			}
+		}
+	}
+	return header
+}
+
+// rows строки выгрузки одного пользователя.
+func (options *Options) rows(user *schemas.User) [][]interface{} {
+	row := make([]interface{}, 0, len(options.Columns)+options.EmailColumns)
+	emailsAt := -1
+	for _, column := range options.Columns {
+		if column != "emails" {
+			row = append(row, columns[column](user))
+			continue
+		}
+
+		emailsAt = len(row)
+		switch options.Emails {
+		case EmailsJoin:
+			row = append(row, strings.Join(user.Emails, options.EmailSeparator))
+		case EmailsRows:
+			row = append(row, "")
+		case EmailsColumns:
+			for i := 0; i < options.EmailColumns; i++ {
+				switch {
+				case i >= len(user.Emails):
+					row = append(row, "")
+				case i == options.EmailColumns-1:
+					row = append(row, strings.Join(user.Emails[i:], options.EmailSeparator))
+				default:
+					row = append(row, user.Emails[i])
+				}
+			}
+		}
+	}
+
+	if options.Emails != EmailsRows || emailsAt < 0 || len(user.Emails) == 0 {
+		return [][]interface{}{row}
+	}
+
+	rows := make([][]interface{}, len(user.Emails))
+	for i, email := range user.Emails {
+		rows[i] = slices.Clone(row)
+		rows[i][emailsAt] = email
+	}
+	return rows
+}
+
+// Export пишет в output пользователей, подходящих под options.Filter, и
+// возвращает их количество. Заголовок пишется перед первым пользователем,
+// поэтому при ошибке до него в output ничего не записано.
+func Export(ctx context.Context, userStorage storage.StorageInterface, output io.Writer, options Options) (int, error) {
+	if err := options.Validate(); err != nil {
+		return 0, err
+	}
+
+	var out writer
+	start := func() error {
+		var err error
+		out, err = newWriter(output, options.Format, options.header())
+		return err
+	}
+
+	count := 0
+	err := userStorage.Export(ctx, &options.Filter, func(user *schemas.User) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		for _, row := range options.rows(user) {
+			if err := out.writeRow(row); err != nil {
+				return err
+			}
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if out == nil {
+		if err := start(); err != nil {
+			return 0, err
+		}
+	}
+	return count, out.close()
+}
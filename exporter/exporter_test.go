@@ -0,0 +1,124 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func exportStorage(t *testing.T) *storage.Memory {
+	memory := storage.NewMemory()
+	for _, user := range []*schemas.User{
+		{Name: "Ivan", Surname: "Petrov", Age: 30, Gender: "male", Emails: []string{"ivan@test.com", "ivan2@test.com", "ivan3@test.com"}},
+		{Name: "Anna", Surname: "Sidorova", Age: 25, Gender: "female"},
+		{Name: "Petr", Surname: "Ivanov, Jr", Age: 40, Gender: "male", Emails: []string{"petr@test.com"}},
+	} {
+		_, err := memory.AddUser(context.Background(), user)
+		require.NoError(t, err)
+	}
+	return memory
+}
+
+func TestExportCSV(t *testing.T) {
+	memory := exportStorage(t)
+	columns := []string{"id", "surname", "age", "emails"}
+
+	var output bytes.Buffer
+	count, err := Export(context.Background(), memory, &output, Options{Format: FormatCSV, Columns: columns})
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	require.Equal(t, "id,surname,age,emails\n"+
+		"1,Petrov,30,ivan@test.com;ivan2@test.com;ivan3@test.com\n"+
+		"2,Sidorova,25,\n"+
+		"3,\"Ivanov, Jr\",40,petr@test.com\n", output.String())
+
+	output.Reset()
+	_, err = Export(context.Background(), memory, &output, Options{Format: FormatCSV, Columns: columns, Emails: EmailsRows,
+		Filter: storage.ListOptions{Gender: "male", Sort: []storage.SortField{{Field: "age", Desc: true}}}})
+	require.NoError(t, err)
+	require.Equal(t, "id,surname,age,email\n"+
+		"3,\"Ivanov, Jr\",40,petr@test.com\n"+
+		"1,Petrov,30,ivan@test.com\n"+
+		"1,Petrov,30,ivan2@test.com\n"+
+		"1,Petrov,30,ivan3@test.com\n", output.String())
+
+	output.Reset()
+	_, err = Export(context.Background(), memory, &output, Options{Format: FormatCSV, Columns: []string{"emails", "id"},
+		Emails: EmailsColumns, EmailColumns: 2, EmailSeparator: " "})
+	require.NoError(t, err)
+	require.Equal(t, "email_1,email_2,id\n"+
+		"ivan@test.com,ivan2@test.com ivan3@test.com,1\n"+
+		",,2\n"+
+		"petr@test.com,,3\n", output.String())
+}
+
+func TestExportNDJSON(t *testing.T) {
+	memory := exportStorage(t)
+
+	var output bytes.Buffer
+	_, err := Export(context.Background(), memory, &output, Options{Format: FormatNDJSON, Columns: []string{"name", "age", "emails"},
+		Filter: storage.ListOptions{MinAge: new(int)}})
+	require.NoError(t, err)
+	require.Equal(t, `{"name":"Ivan","age":30,"emails":"ivan@test.com;ivan2@test.com;ivan3@test.com"}`+"\n"+
+		`{"name":"Anna","age":25,"emails":""}`+"\n"+
+		`{"name":"Petr","age":40,"emails":"petr@test.com"}`+"\n", output.String())
+}
+
+func TestExportXLSX(t *testing.T) {
+	memory := exportStorage(t)
+
+	var output bytes.Buffer
+	_, err := Export(context.Background(), memory, &output, Options{Format: FormatXLSX, Columns: []string{"id", "surname"},
+		Filter: storage.ListOptions{SurnamePrefix: "Iv"}})
+	require.NoError(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		files[file.Name] = string(data)
+	}
+
+	require.Contains(t, files, "[Content_Types].xml")
+	require.Contains(t, files, "xl/workbook.xml")
+	require.True(t, strings.HasSuffix(files["xl/worksheets/sheet1.xml"], `<sheetData>`+
+		`<row><c t="inlineStr"><is><t xml:space="preserve">id</t></is></c><c t="inlineStr"><is><t xml:space="preserve">surname</t></is></c></row>`+
+		`<row><c><v>3</v></c><c t="inlineStr"><is><t xml:space="preserve">Ivanov, Jr</t></is></c></row>`+
+		`</sheetData></worksheet>`))
+}
+
+func TestExportOptions(t *testing.T) {
+	memory := exportStorage(t)
+
+	var output bytes.Buffer
+	_, err := Export(context.Background(), memory, &output, Options{Format: "pdf"})
+	require.True(t, errors.Is(err, ErrFormat))
+
+	_, err = Export(context.Background(), memory, &output, Options{Format: FormatCSV, Columns: []string{"id", "password", "id"}, Emails: "split"})
+	var validationErr *storage.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []storage.FieldError{
+		{Field: "columns", Message: "unknown column password"},
+		{Field: "columns", Message: "duplicate column id"},
+		{Field: "emails", Message: "must be one of: join, rows, columns"},
+	}, validationErr.Fields)
+	require.Zero(t, output.Len())
+
+	_, err = Export(context.Background(), storage.NewMemory(), &output, Options{Format: FormatCSV, Columns: []string{"id", "name"}})
+	require.NoError(t, err)
+	require.Equal(t, "id,name\n", output.String())
+}
@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// writer пишет строки выгрузки. Значения строк int, float64, string или time.Time.
+type writer interface {
+	writeRow(values []interface{}) error
+	close() error
+}
+
+func newWriter(output io.Writer, format string, header []string) (writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(output, header)
+	case FormatNDJSON:
+		return newNDJSONWriter(output, header)
+	case FormatXLSX:
+		return newXLSXWriter(output, header)
+	default:
+		return nil, fmt.Errorf("Unknown export format %s: %w", format, ErrFormat)
+	}
+}
+
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+type csvWriter struct {
+	csv    *csv.Writer
+	record []string
+}
+
+func newCSVWriter(output io.Writer, header []string) (*csvWriter, error) {
+	writer := &csvWriter{csv: csv.NewWriter(output), record: make([]string, len(header))}
+	if err := writer.csv.Write(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *csvWriter) writeRow(values []interface{}) error {
+	for i, value := range values {
+		writer.record[i] = formatValue(value)
+	}
+	return writer.csv.Write(writer.record)
+}
+
+func (writer *csvWriter) close() error {
+	writer.csv.Flush()
+	return writer.csv.Error()
+}
+
+// ndjsonWriter пишет объект на строку с ключами в порядке колонок.
+type ndjsonWriter struct {
+	output *bufio.Writer
+	keys   [][]byte
+	line   bytes.Buffer
+}
+
+func newNDJSONWriter(output io.Writer, header []string) (*ndjsonWriter, error) {
+	writer := &ndjsonWriter{output: bufio.NewWriter(output), keys: make([][]byte, len(header))}
+	for i, column := range header {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		writer.keys[i] = key
+	}
+	return writer, nil
+}
+
+func (writer *ndjsonWriter) writeRow(values []interface{}) error {
+	writer.line.Reset()
+	writer.line.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			writer.line.WriteByte(',')
+		}
+		writer.line.Write(writer.keys[i])
+		writer.line.WriteByte(':')
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("Error encode %s: %w", writer.keys[i], err)
+		}
+		writer.line.Write(data)
+	}
+	writer.line.WriteString("}\n")
+
+	_, err := writer.output.Write(writer.line.Bytes())
+	return err
+}
+
+func (writer *ndjsonWriter) close() error {
+	return writer.output.Flush()
+}
+
+// maxXLSXRows ограничение строк листа Excel, включая заголовок.
+const maxXLSXRows = 1 << 20
+
+// Части книги XLSX, кроме листа. Строки пишутся в лист как inlineStr, без
+// таблицы общих строк, что бы не держать их в памяти.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="users" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXLSXWriter(output io.Writer, header []string) (*xlsxWriter, error) {
+	writer := &xlsxWriter{zip: zip.NewWriter(output)}
+
+	for _, part := range xlsxParts {
+		file, err := writer.zip.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := writer.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer.sheet = bufio.NewWriter(sheet)
+	writer.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	values := make([]interface{}, len(header))
+	for i, column := range header {
+		values[i] = column
+	}
+	if err := writer.writeRow(values); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *xlsxWriter) writeRow(values []interface{}) error {
+	if writer.rows == maxXLSXRows {
+		return fmt.Errorf("Too many rows for xlsx, limit is %d", maxXLSXRows)
+	}
+	writer.rows++
+
+	writer.sheet.WriteString("<row>")
+	for _, value := range values {
+		switch value.(type) {
+		case int, float64:
+			writer.sheet.WriteString("<c><v>" + formatValue(value) + "</v></c>")
+		default:
+			writer.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(writer.sheet, []byte(formatValue(value))); err != nil {
+				return err
+			}
+			writer.sheet.WriteString("</t></is></c>")
+		}
+	}
+	_, err := writer.sheet.WriteString("</row>")
+	return err
+}
+
+func (writer *xlsxWriter) close() error {
+	writer.sheet.WriteString("</sheetData></worksheet>")
+	if err := writer.sheet.Flush(); err != nil {
+		return err
+	}
+	return writer.zip.Close()
+}
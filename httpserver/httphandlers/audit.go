@@ -0,0 +1,32 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/nkhamm-spb/red_soft_test/auth"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// ActorHeader автор изменений для истории пользователя.
+const ActorHeader = "X-Actor"
+
+// anonymousActor автор запросов без заголовка X-Actor.
+const anonymousActor = "anonymous"
+
+// Audit кладет в контекст автора и id запроса, их хранилище записывает в
+// историю вместе с изменениями. Автором становится auth.Principal, а
+// заголовок X-Actor учитывается, только если запрос не проверялся, например
+// при выключенной проверке. Должен стоять после RequestID и Authenticate.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := r.Header.Get(ActorHeader)
+		if principal := auth.PrincipalFromContext(r.Context()); principal != nil {
+			actor = principal.Actor()
+		} else if actor == "" || len(actor) > 128 {
+			actor = anonymousActor
+		}
+
+		ctx := storage.WithAuditInfo(r.Context(), storage.AuditInfo{Actor: actor, RequestID: RequestIDFromContext(r.Context())})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
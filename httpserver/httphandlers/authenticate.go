@@ -0,0 +1,52 @@
+package httphandlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/auth"
+)
+
+// DefaultPublicPaths пути, открытые без проверки, если server.auth.public_paths
+// не задан: проверка живости и документация.
+var DefaultPublicPaths = []string{"/health", "/swagger/"}
+
+// Authenticate пропускает запрос, только если authenticator принял ключ API
+// или токен, и кладет auth.Principal в контекст. Пути publicPaths открыты
+// всем: путь с / в конце открывает все пути с этим началом. Должен стоять
+// после RequestID и перед Audit.
+func Authenticate(authenticator *auth.Authenticator, publicPaths []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublicPath(r.URL.Path, publicPaths) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := authenticator.Authenticate(r)
+			if errors.Is(err, auth.ErrUnauthorized) {
+				log.Printf("Unauthorized request %s %s [%s]: %v\n", r.Method, r.URL.Path, RequestIDFromContext(r.Context()), err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeErrorResponse(w, r, http.StatusUnauthorized, "unauthorized", err.Error(), nil)
+				return
+			}
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func isPublicPath(path string, publicPaths []string) bool {
+	for _, public := range publicPaths {
+		if path == public || strings.HasSuffix(public, "/") && strings.HasPrefix(path, public) {
+			return true
+		}
+	}
+	return false
+}
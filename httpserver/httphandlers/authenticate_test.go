@@ -0,0 +1,70 @@
+package httphandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/auth"
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestAuthenticate(t *testing.T) {
+	memory := storage.NewMemory()
+	_, err := memory.AddUser(context.Background(), &schemas.User{Name: "Ivan", Surname: "Petrov"})
+	require.NoError(t, err)
+
+	authenticator, err := auth.New(&config.Auth{
+		APIKeys: []config.APIKey{{Name: "operator", SHA256: auth.HashAPIKey("secret-key")}},
+	}, nil)
+	require.NoError(t, err)
+
+	router := http.NewServeMux()
+	router.Handle("/health", &HandlerHealth{})
+	router.Handle("/api/v1/users", &HandlerAddUser{Storage: memory})
+	handler := RequestID(Authenticate(authenticator, DefaultPublicPaths)(Audit(router)))
+
+	serve := func(method string, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/health", "", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body := `{"name":"Anna","surname":"Sidorova"}`
+	recorder = serve(http.MethodPost, "/api/v1/users", body, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, `Bearer realm="api"`, recorder.Header().Get("WWW-Authenticate"))
+
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "unauthorized", response.Code)
+
+	recorder = serve(http.MethodPost, "/api/v1/users", body, map[string]string{auth.APIKeyHeader: "wrong-key"})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// X-Actor не подменяет автора, проверенного по ключу.
+	recorder = serve(http.MethodPost, "/api/v1/users", body, map[string]string{auth.APIKeyHeader: "secret-key", ActorHeader: "admin"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	records, err := memory.History(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, "api_key:operator", records[0].Actor)
+
+	require.True(t, isPublicPath("/swagger/index.html", DefaultPublicPaths))
+	require.False(t, isPublicPath("/healthz", DefaultPublicPaths))
+	require.False(t, isPublicPath("/swagger", DefaultPublicPaths))
+}
@@ -0,0 +1,39 @@
+package httphandlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Deprecated помечает устаревший маршрут заголовками Deprecation (RFC 9745)
+// и Sunset (RFC 8594) и ссылкой на замену. В successor переменные маршрута
+// вида {id} подставляются из запроса с экранированием для пути или для
+// строки запроса, в зависимости от того, где стоит подстановка.
+func Deprecated(successor string, deprecatedAt time.Time, sunset time.Time) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, query, hasQuery := strings.Cut(successor, "?")
+			for name, value := range mux.Vars(r) {
+				path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+				query = strings.ReplaceAll(query, "{"+name+"}", url.QueryEscape(value))
+			}
+			link := path
+			if hasQuery {
+				link += "?" + query
+			}
+
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecatedAt.Unix()))
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, link))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
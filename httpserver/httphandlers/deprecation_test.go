@@ -0,0 +1,98 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestDeprecated(t *testing.T) {
+	deprecatedAt := time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+
+	router := mux.NewRouter()
+	router.Handle("/api/users/{id:[0-9]+}/get_user", Deprecated("/api/v1/users/{id}", deprecatedAt, sunset)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/users/7/get_user", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "@1792281600", recorder.Header().Get("Deprecation"))
+	require.Equal(t, "Sun, 18 Apr 2027 00:00:00 GMT", recorder.Header().Get("Sunset"))
+	require.Equal(t, `</api/v1/users/7>; rel="successor-version"`, recorder.Header().Get("Link"))
+}
+
+func TestDeprecatedEscape(t *testing.T) {
+	router := mux.NewRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	deprecatedAt := time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	router.Handle("/api/users/get_by_surname/{surname}",
+		Deprecated("/api/v1/users?surname={surname}", deprecatedAt, time.Time{})(ok))
+	router.Handle("/api/users/by_surname/{surname}",
+		Deprecated("/api/v1/surnames/{surname}", deprecatedAt, time.Time{})(ok))
+
+	cases := []struct {
+		path string
+		link string
+	}{
+		{"/api/users/get_by_surname/O'Neil%20&%20Co", `</api/v1/users?surname=O%27Neil+%26+Co>; rel="successor-version"`},
+		{"/api/users/get_by_surname/%D0%98%D0%B2%D0%B0%D0%BD%23%3E", `</api/v1/users?surname=%D0%98%D0%B2%D0%B0%D0%BD%23%3E>; rel="successor-version"`},
+		{"/api/users/by_surname/O'Neil%20&%20Co", `</api/v1/surnames/O%27Neil%20&%20Co>; rel="successor-version"`},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, c.path, nil))
+		require.Equal(t, c.link, recorder.Header().Get("Link"), c.path)
+	}
+}
+
+func TestRESTResponses(t *testing.T) {
+	memory := storage.NewMemory()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"name":"Ivan","surname":"Petrov","emails":[" ivan@Test.COM "]}`))
+	(&HandlerAddUser{Storage: memory, LocationPrefix: "/api/v1/users"}).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var user schemas.User
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+	require.Equal(t, []string{"ivan@test.com"}, user.Emails)
+	require.Equal(t, "/api/v1/users/1", recorder.Header().Get("Location"))
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPut, "/api/v1/users/1", strings.NewReader(`{"name":"Ivan","surname":"Sidorov"}`))
+	request = mux.SetURLVars(request, map[string]string{"id": "1"})
+	(&HandlerEditUser{Storage: memory, Replace: true}).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+	require.Equal(t, "Sidorov", user.Surname)
+	require.Empty(t, user.Emails)
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPut, "/api/v1/users/1", strings.NewReader(`{"surname":"Sidorov"}`))
+	request = mux.SetURLVars(request, map[string]string{"id": "1"})
+	(&HandlerEditUser{Storage: memory, Replace: true}).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodDelete, "/api/v1/users/1", nil)
+	request = mux.SetURLVars(request, map[string]string{"id": "1"})
+	(&HandlerDeleteUser{Storage: memory, NoContent: true}).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+}
@@ -0,0 +1,76 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// ErrorResponse тело ответа с ошибкой, одинаковое для всех обработчиков.
+// OwnerID заполняется для email_conflict: пользователь, которому уже
+// принадлежит почта.
+type ErrorResponse struct {
+	Code      string               `json:"code"`
+	Message   string               `json:"message"`
+	Fields    []storage.FieldError `json:"fields,omitempty"`
+	OwnerID   int                  `json:"owner_id,omitempty"`
+	RequestID string               `json:"request_id,omitempty"`
+}
+
+// writeError выбирает статус по ошибке хранилища. Текст неизвестных ошибок
+// только логируется, что бы наружу не попадали запросы и детали базы.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Error in request %s %s [%s]: %v\n", r.Method, r.URL.Path, RequestIDFromContext(r.Context()), err)
+
+	var validationErr *storage.ValidationError
+	var emailErr *storage.EmailConflictError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", "Validation failed", validationErr.Fields)
+	case errors.Is(err, storage.ErrValidation):
+		writeErrorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", "Validation failed", nil)
+	case errors.Is(err, storage.ErrNotFound):
+		writeErrorResponse(w, r, http.StatusNotFound, "not_found", "Not found", nil)
+	case errors.Is(err, storage.ErrPurged):
+		writeErrorResponse(w, r, http.StatusGone, "gone", "User was purged", nil)
+	case errors.Is(err, storage.ErrVersionMismatch):
+		writeErrorResponse(w, r, http.StatusPreconditionFailed, "precondition_failed", "User was changed, reload it and retry", nil)
+	case errors.As(err, &emailErr):
+		writeResponse(w, http.StatusConflict, ErrorResponse{
+			Code:      "email_conflict",
+			Message:   emailErr.Error(),
+			Fields:    []storage.FieldError{{Field: "emails", Message: "already used by another user"}},
+			OwnerID:   emailErr.UserID,
+			RequestID: RequestIDFromContext(r.Context()),
+		})
+	case errors.Is(err, storage.ErrConflict):
+		writeErrorResponse(w, r, http.StatusConflict, "conflict", "Conflict", nil)
+	default:
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Internal server error", nil)
+	}
+}
+
+func writeBadRequest(w http.ResponseWriter, r *http.Request, message string) {
+	writeErrorResponse(w, r, http.StatusBadRequest, "bad_request", message, nil)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message string, fields []storage.FieldError) {
+	writeResponse(w, status, ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Fields:    fields,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+}
+
+func writeResponse(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error in write error response: %v\n", err)
+	}
+}
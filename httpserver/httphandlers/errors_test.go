@@ -0,0 +1,62 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("User not found: %w", storage.ErrNotFound), http.StatusNotFound, "not_found"},
+		{fmt.Errorf("Error exec: %w", storage.ErrConflict), http.StatusConflict, "conflict"},
+		{&storage.EmailConflictError{Email: "a@test.com", UserID: 5}, http.StatusConflict, "email_conflict"},
+		{&storage.ValidationError{Fields: []storage.FieldError{{Field: "age", Message: "wrong format"}}},
+			http.StatusUnprocessableEntity, "validation_failed"},
+		{errors.New(`pq: syntax error at or near "WHERE"`), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/users/1/get_user", nil)
+
+		RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, c.err)
+		})).ServeHTTP(recorder, request)
+
+		require.Equal(t, c.status, recorder.Code)
+
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.Equal(t, c.code, response.Code)
+		require.NotContains(t, response.Message, "pq:")
+		require.Equal(t, recorder.Header().Get(RequestIDHeader), response.RequestID)
+		require.NotEmpty(t, response.RequestID)
+	}
+}
+
+func TestHandlerGetUserNotFound(t *testing.T) {
+	handler := &HandlerGetUser{Storage: storage.NewMemory()}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/users/1/get_user", nil)
+	request.Header.Set(RequestIDHeader, "test-request")
+	request = mux.SetURLVars(request, map[string]string{"id": "1"})
+
+	RequestID(handler).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.JSONEq(t, `{"code":"not_found","message":"Not found","request_id":"test-request"}`, recorder.Body.String())
+}
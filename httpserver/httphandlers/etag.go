@@ -0,0 +1,62 @@
+package httphandlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// userETag сильный ETag пользователя по его версии.
+func userETag(user *schemas.User) string {
+	return fmt.Sprintf(`"%d"`, user.Version)
+}
+
+func setETag(w http.ResponseWriter, user *schemas.User) {
+	w.Header().Set("ETag", userETag(user))
+}
+
+// etags значения заголовка со списком ETag, в том числе из нескольких строк.
+func etags(r *http.Request, name string) []string {
+	var tags []string
+	for _, value := range r.Header.Values(name) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// ifMatch проверяет If-Match по текущей версии пользователя с сильным
+// сравнением (RFC 9110, 13.1.1). Возвращает версию, которую хранилище должно
+// проверить атомарно при записи, или 0, если заголовка нет.
+func ifMatch(r *http.Request, user *schemas.User) (int, error) {
+	tags := etags(r, "If-Match")
+	if len(tags) == 0 {
+		return 0, nil
+	}
+
+	etag := userETag(user)
+	for _, tag := range tags {
+		if tag == "*" || tag == etag {
+			return user.Version, nil
+		}
+	}
+	return 0, fmt.Errorf("If-Match %s, current ETag %s: %w", strings.Join(tags, ", "), etag, storage.ErrVersionMismatch)
+}
+
+// notModified true, если If-None-Match совпадает с ETag пользователя при
+// слабом сравнении (RFC 9110, 13.1.2).
+func notModified(r *http.Request, user *schemas.User) bool {
+	etag := userETag(user)
+	for _, tag := range etags(r, "If-None-Match") {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
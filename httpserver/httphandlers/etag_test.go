@@ -0,0 +1,65 @@
+package httphandlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestETag(t *testing.T) {
+	memory := storage.NewMemory()
+	_, err := memory.AddUser(context.Background(), &schemas.User{Name: "Ivan", Surname: "Petrov"})
+	require.NoError(t, err)
+
+	serve := func(handler http.Handler, method string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, "/api/v1/users/1", strings.NewReader(body))
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		request = mux.SetURLVars(request, map[string]string{"id": "1"})
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	get := &HandlerGetUser{Storage: memory}
+	edit := &HandlerEditUser{Storage: memory}
+
+	recorder := serve(get, http.MethodGet, "", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"1"`, recorder.Header().Get("ETag"))
+
+	recorder = serve(get, http.MethodGet, "", map[string]string{"If-None-Match": `W/"1"`})
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+
+	recorder = serve(edit, http.MethodPatch, `{"surname":"Sidorov"}`, map[string]string{
+		"Content-Type": "application/merge-patch+json", "If-Match": `"0", "1"`})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+
+	// Второй оператор редактирует по устаревшей версии.
+	recorder = serve(edit, http.MethodPatch, `{"surname":"Ivanov"}`, map[string]string{
+		"Content-Type": "application/merge-patch+json", "If-Match": `"1"`})
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"code":"precondition_failed"`)
+
+	// Слабый ETag не подходит для If-Match.
+	recorder = serve(&HandlerDeleteUser{Storage: memory, NoContent: true}, http.MethodDelete, "", map[string]string{"If-Match": `W/"2"`})
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	recorder = serve(get, http.MethodGet, "", map[string]string{"If-None-Match": `"1"`})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"surname":"Sidorov"`)
+
+	recorder = serve(&HandlerDeleteUser{Storage: memory, NoContent: true}, http.MethodDelete, "", map[string]string{"If-Match": `"2"`})
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+}
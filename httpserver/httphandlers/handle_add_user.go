@@ -2,92 +2,77 @@ package httphandlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
-	"sync"
 
-	"github.com/nkhamm-spb/red_soft_test/metadata"
 	"github.com/nkhamm-spb/red_soft_test/schemas"
 	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/validation"
 )
 
 type HandlerAddUser struct {
 	Storage storage.StorageInterface
+	// Если задан, ответ 201 Created с заголовком Location вида LocationPrefix/{id}.
+	LocationPrefix string
 }
 
 // @Summary Добавить пользователя
-// @Description Добавить пользователя
+// @Description Добавить пользователя. Возраст, пол и национальность заполняются в фоне,
+// @Description до завершения enrichment_status равен pending, см. /api/v1/users/{id}/enrichment.
+// @Description Почты сохраняются без пробелов по краям, с доменом в нижнем регистре и в punycode
 // @Tags example
 // @Accept   json
 // @Produce  json
 // @Param   input body   schemas.NewUser true  "Данные пользователя"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
+// @Success 201 {object} schemas.User
+// @Success 200 {object} schemas.User "Устаревший add_user"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 409 {object} ErrorResponse "Почта уже принадлежит пользователю owner_id"
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users [post]
 // @Router /api/users/add_user [post]
 func (h *HandlerAddUser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var newUser schemas.NewUser
 
 	err := json.NewDecoder(r.Body).Decode(&newUser)
 	if err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+		writeBadRequest(w, r, "Wrong request body")
 		return
 	}
 
-	log.Printf("Request to add new user: %v\n", newUser)
-
-	user := schemas.User{
-		Name:    newUser.Name,
-		Surname: newUser.Surname,
-		Emails:  newUser.Emails,
+	if err := validation.Validate(&newUser); err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	ch := make(chan error, 3)
-
-	go func() {
-		defer wg.Done()
-		user.Age, err = metadata.GetAge(r.Context(), user.Name, user.Surname)
-		if err != nil {
-			ch <- err
-		}
-	}()
-	go func() {
-		defer wg.Done()
-		user.Gender, _ = metadata.GetGender(r.Context(), user.Name, user.Surname)
-		if err != nil {
-			ch <- err
-		}
-	}()
-	go func() {
-		defer wg.Done()
-		user.Nationalize, _ = metadata.GetNationalize(r.Context(), user.Name, user.Surname)
-		if err != nil {
-			ch <- err
-		}
-	}()
-
-	wg.Wait()
-	close(ch)
+	log.Printf("Request to add new user: %v\n", newUser)
 
-	for err := range ch {
-		log.Printf("Error in add new user: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	user := schemas.User{
+		Name:             newUser.Name,
+		Surname:          newUser.Surname,
+		Emails:           newUser.Emails,
+		EnrichmentStatus: schemas.EnrichmentPending,
 	}
 
 	addedUser, err := h.Storage.AddUser(r.Context(), &user)
 
 	if err != nil {
-		log.Printf("Error in add new user: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
+	setETag(w, addedUser)
 	w.Header().Set("Content-Type", "application/json")
+	if h.LocationPrefix != "" {
+		w.Header().Set("Location", fmt.Sprintf("%s/%d", h.LocationPrefix, addedUser.ID))
+		w.WriteHeader(http.StatusCreated)
+	}
 	if err := json.NewEncoder(w).Encode(addedUser); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Error in encode response: %v\n", err)
 	}
 }
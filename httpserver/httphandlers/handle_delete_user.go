@@ -0,0 +1,78 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerDeleteUser struct {
+	Storage storage.StorageInterface
+	// Отвечать 204 без тела вместо удаленного пользователя.
+	NoContent bool
+}
+
+// @Summary Удалить пользователя
+// @Description Помечает пользователя удаленным, до окончательного удаления его можно восстановить
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "id пользователя"
+// @Param   If-Match header string false "ETag пользователя, удаление выполнится, только если он не изменился"
+// @Success 204
+// @Success 200 {object} schemas.User "Устаревший delete_user"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse "Пользователь изменился после получения ETag"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id} [delete]
+// @Router /api/users/{id}/delete_user [delete]
+func (h *HandlerDeleteUser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeBadRequest(w, r, "Wrong user id")
+		return
+	}
+
+	log.Printf("Request to delete user with id: %d\n", id)
+
+	// Версия нужна, только если клиент передал If-Match.
+	version := 0
+	if len(etags(r, "If-Match")) > 0 {
+		current, err := h.Storage.GetUserById(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if version, err = ifMatch(r, current); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	user, err := h.Storage.DeleteUser(r.Context(), id, version)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if h.NoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
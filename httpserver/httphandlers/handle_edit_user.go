@@ -1,67 +1,313 @@
 package httphandlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"maps"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
+	"github.com/nkhamm-spb/red_soft_test/patch"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
 	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/validation"
 )
 
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// acceptPatch форматы изменений для заголовка Accept-Patch (RFC 5789).
+var acceptPatch = strings.Join([]string{mergePatchType, jsonPatchType}, ", ")
+
 type HandlerEditUser struct {
 	Storage storage.StorageInterface
+	// Replace полная замена для PUT: отсутствующие в запросе поля очищаются.
+	// Без него тело запроса считается patch.
+	Replace bool
 }
 
 // @Summary Изменить пользователя
-// @Description Изменить пользователя
+// @Description PUT заменяет пользователя целиком, отсутствующие поля очищаются.
+// @Description PATCH принимает application/merge-patch+json (RFC 7396) и application/json-patch+json (RFC 6902)
+// @Description над документом schemas.EditUser, например [{"op":"add","path":"/emails/-","value":"a@test.com"}].
+// @Description application/json обрабатывается как merge patch. Неизвестные поля отклоняются.
 // @Tags example
 // @Accept   json
+// @Accept   application/merge-patch+json
+// @Accept   application/json-patch+json
 // @Produce  json
 // @Param   id path int true "id пользователя"
-// @Param   input body   schemas.EditUser true  "Данные для редактирования"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
+// @Param   If-Match header string false "ETag пользователя, изменение выполнится, только если он не изменился. Без него изменение повторяется поверх одновременной записи"
+// @Param   input body   schemas.EditUser true  "Данные для редактирования или массив операций JSON Patch"
+// @Success 200 {object} schemas.User
+// @Header  200 {string} ETag "Новая версия пользователя"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Не выполнена операция test или почта уже принадлежит пользователю owner_id"
+// @Failure 412 {object} ErrorResponse "Пользователь изменился после получения ETag"
+// @Failure 415 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id} [put]
+// @Router /api/v1/users/{id} [patch]
 // @Router /api/users/{id}/edit_user [put]
 func (h *HandlerEditUser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Тут специально нет десериализации в EditUser что бы было возможно заменить данные на пустые
+	w.Header().Set("Accept-Patch", acceptPatch)
 
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBadRequest(w, r, "Wrong user id")
 		return
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, "Wrong request body")
 		return
 	}
 	defer r.Body.Close()
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			writeBadRequest(w, r, "Wrong content type")
+			return
+		}
+	}
+
+	if mediaType != "application/json" && (h.Replace || mediaType != mergePatchType && mediaType != jsonPatchType) {
+		writeErrorResponse(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type",
+			fmt.Sprintf("Unsupported content type: %s", mediaType), nil)
 		return
 	}
 
-	log.Printf("Request to edit user with id: %d data to edit: %v\n", id, data)
+	// Без If-Match клиент не знает версию, поэтому изменение, пересекшееся с
+	// чужой записью, применяется заново к свежему пользователю.
+	conditional := len(etags(r, "If-Match")) > 0
+	for attempt := 1; ; attempt++ {
+		user, err := h.Storage.GetUserById(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 
-	editedUser, err := h.Storage.EditUser(r.Context(), id, data)
+		if _, err := ifMatch(r, user); err != nil {
+			writeError(w, r, err)
+			return
+		}
 
-	if err != nil {
-		log.Printf("Error in edit user: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		edit, err := h.applyEdit(user, body, mediaType)
+		var requestErr *editRequestError
+		if errors.As(err, &requestErr) {
+			writeErrorResponse(w, r, requestErr.status, requestErr.code, requestErr.message, nil)
+			return
+		} else if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		userPatch, changed := diffUser(user, edit)
+		if err := validation.ValidatePartial(edit, changed); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		log.Printf("Request to edit user with id: %d changed fields: %v\n", id, changed)
+
+		if !userPatch.Empty() {
+			// Изменение вычислено по этой версии, хранилище проверит ее атомарно.
+			edited, err := h.Storage.EditUser(r.Context(), id, userPatch, user.Version)
+			if errors.Is(err, storage.ErrVersionMismatch) && !conditional && attempt < editAttempts {
+				log.Printf("User %d was changed concurrently, retrying edit\n", id)
+				continue
+			}
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			user = edited
+		}
+
+		writeUser(w, user)
 		return
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(editedUser); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// editAttempts сколько раз изменение без If-Match применяется заново при
+// одновременной записи, прежде чем вернуть 412.
+const editAttempts = 3
+
+// editRequestError ошибка в самом запросе на изменение с готовым статусом ответа.
+type editRequestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (err *editRequestError) Error() string {
+	return err.message
+}
+
+// applyEdit применяет тело запроса к user и строго разбирает результат.
+func (h *HandlerEditUser) applyEdit(user *schemas.User, body []byte, mediaType string) (*schemas.EditUser, error) {
+	var document interface{}
+	switch {
+	case mediaType == jsonPatchType:
+		var operations []patch.Operation
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&operations); err != nil {
+			return nil, &editRequestError{http.StatusBadRequest, "bad_request", "Wrong request body"}
+		}
+
+		var err error
+		document, err = patch.Apply(editDocument(user), operations)
+		switch {
+		case errors.Is(err, patch.ErrTestFailed):
+			return nil, &editRequestError{http.StatusConflict, "conflict", err.Error()}
+		case errors.Is(err, patch.ErrPath):
+			return nil, &editRequestError{http.StatusUnprocessableEntity, "validation_failed", err.Error()}
+		case err != nil:
+			return nil, &editRequestError{http.StatusBadRequest, "bad_request", err.Error()}
+		}
+	default:
+		var object map[string]interface{}
+		if err := json.Unmarshal(body, &object); err != nil || object == nil {
+			return nil, &editRequestError{http.StatusBadRequest, "bad_request", "Request body must be a JSON object"}
+		}
+
+		if h.Replace {
+			document = object
+			break
+		}
+
+		if mediaType == "application/json" {
+			// Старые клиенты edit_user присылали поля в любом регистре, например Emails.
+			object = lowerKeys(object)
+		}
+		document = patch.Merge(editDocument(user), object)
 	}
+
+	return decodeEditUser(document)
+}
+
+// editDocument изменяемые поля пользователя в виде JSON документа, к которому
+// применяется patch. Пути JSON Patch совпадают с полями schemas.EditUser.
+func editDocument(user *schemas.User) map[string]interface{} {
+	emails := make([]interface{}, len(user.Emails))
+	for i, email := range user.Emails {
+		emails[i] = email
+	}
+
+	return map[string]interface{}{
+		"name":        user.Name,
+		"surname":     user.Surname,
+		"gender":      user.Gender,
+		"age":         float64(user.Age),
+		"nationalize": user.Nationalize,
+		"emails":      emails,
+	}
+}
+
+func lowerKeys(object map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		result[strings.ToLower(key)] = value
+	}
+	return result
+}
+
+// editFields допустимые поля документа, те же, что в editDocument.
+var editFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	for field := range editDocument(&schemas.User{}) {
+		fields[field] = true
+	}
+	return fields
+}()
+
+// decodeEditUser строго разбирает документ после patch: неизвестные поля и
+// значения неверного типа возвращаются как *storage.ValidationError.
+func decodeEditUser(document interface{}) (*schemas.EditUser, error) {
+	object, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("User must be a JSON object: %w", storage.ErrValidation)
+	}
+
+	var unknown []storage.FieldError
+	for _, field := range slices.Sorted(maps.Keys(object)) {
+		if !editFields[field] {
+			unknown = append(unknown, storage.FieldError{Field: field, Message: "unknown field"})
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &storage.ValidationError{Fields: unknown}
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var edit schemas.EditUser
+	if err := json.Unmarshal(data, &edit); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &storage.ValidationError{Fields: []storage.FieldError{{Field: typeErr.Field, Message: "wrong type"}}}
+		}
+		return nil, fmt.Errorf("User must be a JSON object: %w", storage.ErrValidation)
+	}
+
+	return &edit, nil
+}
+
+// diffUser возвращает изменения относительно user и json имена измененных
+// полей для проверки. Неизмененные поля не проверяются, что бы старые данные,
+// не проходящие текущие правила, не мешали менять остальные поля.
+func diffUser(user *schemas.User, edit *schemas.EditUser) (*schemas.UserPatch, map[string]bool) {
+	userPatch := &schemas.UserPatch{}
+	changed := make(map[string]bool)
+
+	if edit.Name != user.Name {
+		userPatch.Name = &edit.Name
+		changed["name"] = true
+	}
+	if edit.Surname != user.Surname {
+		userPatch.Surname = &edit.Surname
+		changed["surname"] = true
+	}
+	if edit.Gender != user.Gender {
+		userPatch.Gender = &edit.Gender
+		changed["gender"] = true
+	}
+	if edit.Age != user.Age {
+		userPatch.Age = &edit.Age
+		changed["age"] = true
+	}
+	if edit.Nationalize != user.Nationalize {
+		userPatch.Nationalize = &edit.Nationalize
+		changed["nationalize"] = true
+	}
+	if !slices.Equal(edit.Emails, user.Emails) {
+		emails := append([]string{}, edit.Emails...)
+		userPatch.Emails = &emails
+		changed["emails"] = true
+	}
+
+	return userPatch, changed
 }
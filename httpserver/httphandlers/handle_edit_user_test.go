@@ -0,0 +1,138 @@
+package httphandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func editUser(t *testing.T, handler *HandlerEditUser, contentType string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPatch, "/api/v1/users/1", strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	request = mux.SetURLVars(request, map[string]string{"id": "1"})
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHandlerEditUserPatch(t *testing.T) {
+	memory := storage.NewMemory()
+	_, err := memory.AddUser(context.Background(), &schemas.User{Name: "Ivan", Surname: "Petrov",
+		Age: 30, Gender: "male", Nationalize: "RU", Emails: []string{"ivan@test.com"}})
+	require.NoError(t, err)
+	handler := &HandlerEditUser{Storage: memory}
+
+	var user schemas.User
+
+	recorder := editUser(t, handler, "application/merge-patch+json", `{"surname":"Sidorov","emails":["a@test.com","b@test.com"]}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+	require.Equal(t, "Sidorov", user.Surname)
+	require.Equal(t, []string{"a@test.com", "b@test.com"}, user.Emails)
+
+	recorder = editUser(t, handler, "application/json-patch+json", `[
+		{"op":"test","path":"/surname","value":"Sidorov"},
+		{"op":"remove","path":"/emails/0"},
+		{"op":"add","path":"/emails/-","value":"c@test.com"}
+	]`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+	require.Equal(t, []string{"b@test.com", "c@test.com"}, user.Emails)
+	require.Equal(t, 30, user.Age)
+	require.Empty(t, user.Sources.Age, "unchanged fields keep their source")
+
+	// Старый формат edit_user: application/json и поле с заглавной буквы.
+	recorder = editUser(t, handler, "application/json", `{"Emails":["d@test.com"],"gender":null}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+	require.Equal(t, []string{"d@test.com"}, user.Emails)
+	require.Equal(t, "", user.Gender)
+	require.Equal(t, schemas.SourceManual, user.Sources.Gender)
+
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+		response    string
+	}{
+		{"application/merge-patch+json", `{"nickname":"vanya"}`, http.StatusUnprocessableEntity,
+			`"fields":[{"field":"nickname","message":"unknown field"}]`},
+		{"application/merge-patch+json", `{"nickname":"vanya","alias":"v"}`, http.StatusUnprocessableEntity,
+			`"fields":[{"field":"alias","message":"unknown field"},{"field":"nickname","message":"unknown field"}]`},
+		{"application/merge-patch+json", `{"age":"thirty"}`, http.StatusUnprocessableEntity,
+			`"fields":[{"field":"age","message":"wrong type"}]`},
+		{"application/merge-patch+json", `{"emails":["not an email"]}`, http.StatusUnprocessableEntity,
+			`"fields":[{"field":"emails[0]","message":"must be a valid email address"}]`},
+		{"application/merge-patch+json", `["name"]`, http.StatusBadRequest, `"code":"bad_request"`},
+		{"application/json-patch+json", `[{"op":"test","path":"/name","value":"Petr"}]`, http.StatusConflict, `"code":"conflict"`},
+		{"application/json-patch+json", `[{"op":"remove","path":"/emails/5"}]`, http.StatusUnprocessableEntity, `"code":"validation_failed"`},
+		{"application/json-patch+json", `[{"op":"add","path":"/nickname","value":"vanya"}]`, http.StatusUnprocessableEntity,
+			`"fields":[{"field":"nickname","message":"unknown field"}]`},
+		{"application/json-patch+json", `[{"op":"jump","path":"/name"}]`, http.StatusBadRequest, `"code":"bad_request"`},
+		{"text/plain", `name=Petr`, http.StatusUnsupportedMediaType, `"code":"unsupported_media_type"`},
+	}
+
+	for _, c := range cases {
+		recorder := editUser(t, handler, c.contentType, c.body)
+		require.Equal(t, c.status, recorder.Code, c.body)
+		require.Contains(t, recorder.Body.String(), c.response, c.body)
+	}
+
+	got, err := memory.GetUserById(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, user.Emails, got.Emails)
+	require.Equal(t, user.Surname, got.Surname)
+}
+
+// racingStorage перед первой записью меняет пользователя, как одновременный запрос.
+type racingStorage struct {
+	storage.StorageInterface
+	raced bool
+}
+
+func (s *racingStorage) EditUser(ctx context.Context, id int, patch *schemas.UserPatch, version int) (*schemas.User, error) {
+	if !s.raced {
+		s.raced = true
+		age := 31
+		if _, err := s.StorageInterface.EditUser(ctx, id, &schemas.UserPatch{Age: &age}, 0); err != nil {
+			return nil, err
+		}
+	}
+	return s.StorageInterface.EditUser(ctx, id, patch, version)
+}
+
+func TestHandlerEditUserConcurrent(t *testing.T) {
+	memory := storage.NewMemory()
+	_, err := memory.AddUser(context.Background(), &schemas.User{Name: "Ivan", Surname: "Petrov", Age: 30})
+	require.NoError(t, err)
+
+	// Без If-Match изменение применяется заново и не стирает чужую запись.
+	handler := &HandlerEditUser{Storage: &racingStorage{StorageInterface: memory}}
+	recorder := editUser(t, handler, "application/merge-patch+json", `{"surname":"Sidorov"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var user schemas.User
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+	require.Equal(t, "Sidorov", user.Surname)
+	require.Equal(t, 31, user.Age)
+	require.Equal(t, 3, user.Version)
+
+	// С If-Match одновременная запись возвращает 412.
+	handler = &HandlerEditUser{Storage: &racingStorage{StorageInterface: memory}}
+	request := httptest.NewRequest(http.MethodPatch, "/api/v1/users/1", strings.NewReader(`{"name":"Petr"}`))
+	request.Header.Set("Content-Type", "application/merge-patch+json")
+	request.Header.Set("If-Match", `"3"`)
+	request = mux.SetURLVars(request, map[string]string{"id": "1"})
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code, recorder.Body.String())
+}
@@ -0,0 +1,114 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/worker"
+)
+
+const (
+	maxEnrichmentWait = time.Minute
+	// Как часто перечитывать пользователя при ожидании: обогащение мог
+	// завершить другой экземпляр сервиса.
+	enrichmentPollInterval = time.Second
+)
+
+type HandlerEnrichmentStatus struct {
+	Storage storage.StorageInterface
+	Pool    *worker.Pool
+}
+
+// @Summary Статус обогащения пользователя
+// @Description Получить пользователя с enrichment_status. С параметром wait запрос ждет,
+// @Description пока статус pending не сменится, но не дольше wait
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "id пользователя"
+// @Param   wait query string false "Сколько ждать завершения, например 30s, не больше 1m"
+// @Success 200 {object} schemas.User
+// @Header  200 {string} ETag "Версия пользователя"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/enrichment [get]
+// @Router /api/users/{id}/enrichment [get]
+func (h *HandlerEnrichmentStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeBadRequest(w, r, "Wrong user id")
+		return
+	}
+
+	var wait time.Duration
+	if value := r.URL.Query().Get("wait"); value != "" {
+		wait, err = time.ParseDuration(value)
+		if err != nil || wait < 0 {
+			writeBadRequest(w, r, "Wrong wait")
+			return
+		}
+		wait = min(wait, maxEnrichmentWait)
+	}
+
+	log.Printf("Request to get enrichment status of user %d, wait %s\n", id, wait)
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(enrichmentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Подписка до чтения, что бы не пропустить завершение между ними.
+		var done <-chan struct{}
+		stop := func() {}
+		if h.Pool != nil {
+			done, stop = h.Pool.Wait(id)
+		}
+
+		user, err := h.Storage.GetUserById(r.Context(), id)
+		if err != nil {
+			stop()
+			writeError(w, r, err)
+			return
+		}
+
+		if user.EnrichmentStatus != schemas.EnrichmentPending {
+			stop()
+			writeUser(w, user)
+			return
+		}
+
+		select {
+		case <-done:
+		case <-ticker.C:
+		case <-timeout.C:
+			stop()
+			writeUser(w, user)
+			return
+		case <-r.Context().Done():
+			stop()
+			return
+		}
+		stop()
+	}
+}
+
+func writeUser(w http.ResponseWriter, user *schemas.User) {
+	setETag(w, user)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,122 @@
+package httphandlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/exporter"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerExportUsers struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Выгрузить пользователей
+// @Description Выгрузка потоком всех пользователей, подходящих под фильтры списка, в CSV, NDJSON или XLSX.
+// @Description emails задает запись почт: join в одной колонке через email_separator, rows строка на каждую почту,
+// @Description columns колонки email_1 ... email_N, лишние почты дописываются в последнюю.
+// @Description Ошибка посреди выгрузки обрывает ответ
+// @Tags example
+// @Produce  text/csv
+// @Produce  application/x-ndjson
+// @Produce  application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param   format query string false "csv, ndjson или xlsx, по умолчанию csv"
+// @Param   columns query string false "Колонки через запятую: id, name, surname, age, gender, nationalize, emails, enrichment_status, created_at, version, gender_probability, age_count"
+// @Param   emails query string false "join, rows или columns, по умолчанию join"
+// @Param   email_separator query string false "Разделитель почт, по умолчанию ;"
+// @Param   email_columns query int false "Число колонок почт для columns, по умолчанию 3"
+// @Param   min_age query int false "Минимальный возраст"
+// @Param   max_age query int false "Максимальный возраст"
+// @Param   gender query string false "Пол"
+// @Param   nationalize query string false "Национальность"
+// @Param   name_prefix query string false "Начало имени"
+// @Param   surname_prefix query string false "Начало фамилии"
+// @Param   surname query string false "Фамилия целиком, с учетом регистра"
+// @Param   email_domain query string false "Домен почты"
+// @Param   sort query string false "Поля сортировки через запятую, минус для убывания, например -age,name"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/export [get]
+func (h *HandlerExportUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := parseListOptions(query)
+	if err != nil {
+		writeBadRequest(w, r, err.Error())
+		return
+	}
+
+	options := exporter.Options{
+		Format:         query.Get("format"),
+		Emails:         query.Get("emails"),
+		EmailSeparator: query.Get("email_separator"),
+		Filter:         *filter,
+	}
+	if options.Format == "" {
+		options.Format = exporter.FormatCSV
+	}
+	if value := query.Get("columns"); value != "" {
+		for _, column := range strings.Split(value, ",") {
+			options.Columns = append(options.Columns, strings.TrimSpace(column))
+		}
+	}
+	if value := query.Get("email_columns"); value != "" {
+		if options.EmailColumns, err = strconv.Atoi(value); err != nil {
+			writeBadRequest(w, r, "Wrong email_columns: "+value)
+			return
+		}
+	}
+
+	if err := options.Validate(); err != nil {
+		if errors.Is(err, exporter.ErrFormat) {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("Request to export users: %v\n", r.URL.RawQuery)
+
+	w.Header().Set("Content-Type", exporter.ContentType(options.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, options.Format))
+
+	output := &startedWriter{ResponseWriter: w}
+	count, err := exporter.Export(r.Context(), h.Storage, output, options)
+	if err != nil {
+		if !output.started {
+			w.Header().Del("Content-Disposition")
+			writeError(w, r, err)
+			return
+		}
+
+		// Статус уже отправлен, обрываем соединение, что бы клиент не принял
+		// неполную выгрузку за целую.
+		log.Printf("Error in export after %d users [%s]: %v\n", count, RequestIDFromContext(r.Context()), err)
+		panic(http.ErrAbortHandler)
+	}
+
+	log.Printf("Exported users: %d\n", count)
+}
+
+// startedWriter отмечает, что тело ответа уже начато и ошибку нельзя
+// отправить статусом.
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedWriter) Write(data []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(data)
+}
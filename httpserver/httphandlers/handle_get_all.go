@@ -17,8 +17,11 @@ type HandlerGetAll struct {
 // @Tags example
 // @Accept  json
 // @Produce  json
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
+// @Success 200 {array} schemas.User
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /api/users/get_all [get]
 func (h *HandlerGetAll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Println("Request to get all users")
@@ -26,14 +29,12 @@ func (h *HandlerGetAll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	users, err := h.Storage.GetAll(r.Context())
 
 	if err != nil {
-		log.Printf("Error in get all users: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(users); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Error in encode response: %v\n", err)
 	}
 }
@@ -0,0 +1,42 @@
+package httphandlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerGetByEmail struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Получить пользователя по почте
+// @Description Адрес сравнивается без учета регистра, домен можно указать как в punycode, так и в юникоде
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   email path string true "Почта пользователя"
+// @Success 200 {object} schemas.User
+// @Header  200 {string} ETag "Версия пользователя"
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/by-email/{email} [get]
+func (h *HandlerGetByEmail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+	log.Printf("Request to get user with email: %s\n", email)
+
+	user, err := h.Storage.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeUser(w, user)
+}
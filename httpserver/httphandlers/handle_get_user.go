@@ -1,13 +1,14 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/nkhamm-spb/red_soft_test/schemas"
 	"github.com/nkhamm-spb/red_soft_test/storage"
 )
 
@@ -16,35 +17,59 @@ type HandlerGetUser struct {
 }
 
 // @Summary Получить данные пользователя по id
-// @Description Получить данные пользователя по id
+// @Description Получить данные пользователя по id. ETag ответа можно передать в If-None-Match,
+// @Description что бы получить 304 без тела, если пользователь не менялся, и в If-Match при изменении
 // @Tags example
 // @Accept  json
 // @Produce  json
 // @Param   id path int true "id пользователя"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
+// @Param   If-None-Match header string false "ETag из предыдущего ответа"
+// @Param   as_of query string false "Состояние пользователя на момент в RFC 3339, например 2024-03-01T12:00:00Z"
+// @Success 200 {object} schemas.User
+// @Header  200 {string} ETag "Версия пользователя"
+// @Success 304 "Пользователь не менялся"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse "Пользователь окончательно удален, история очищена"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id} [get]
 // @Router /api/users/{id}/get_user [get]
 func (h *HandlerGetUser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBadRequest(w, r, "Wrong user id")
 		return
 	}
 
-	log.Printf("Request to get user with id: %d\n", id)
+	var user *schemas.User
+	if value := r.URL.Query().Get("as_of"); value != "" {
+		asOf, parseErr := time.Parse(time.RFC3339Nano, value)
+		if parseErr != nil {
+			writeBadRequest(w, r, "Wrong as_of")
+			return
+		}
 
-	user, err := h.Storage.GetUserById(r.Context(), id)
+		log.Printf("Request to get user with id: %d as of %s\n", id, asOf)
+		user, err = h.Storage.GetUserAsOf(r.Context(), id, asOf)
+	} else {
+		log.Printf("Request to get user with id: %d\n", id)
+		user, err = h.Storage.GetUserById(r.Context(), id)
+	}
 
 	if err != nil {
-		log.Printf("Error in get user by id request: %v\n", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if notModified(r, user) {
+		setETag(w, user)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+
+	writeUser(w, user)
 }
@@ -0,0 +1,18 @@
+package httphandlers
+
+import (
+	"net/http"
+)
+
+type HandlerHealth struct{}
+
+// @Summary Проверка живости
+// @Description Отвечает, пока сервер принимает запросы. Открыт без ключа по умолчанию
+// @Tags example
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Router /health [get]
+func (h *HandlerHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
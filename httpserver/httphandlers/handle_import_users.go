@@ -0,0 +1,108 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/nkhamm-spb/red_soft_test/importer"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// maxImportSize ограничение тела запроса импорта.
+const maxImportSize = 32 << 20
+
+type HandlerImportUsers struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Импорт пользователей
+// @Description Добавляет пользователей из CSV (text/csv, заголовок name,surname,emails, почты через ;)
+// @Description или NDJSON (application/x-ndjson, по объекту schemas.NewUser в строке).
+// @Description Строки проверяются как в add_user, занятые почты и повторы внутри файла отмечаются как duplicate.
+// @Description Возраст, пол и национальность не запрашиваются до вставки: пользователи создаются в статусе pending,
+// @Description и очередь обогащения заполняет их в фоне пакетными запросами к провайдерам. Статус виден в /users/{id}/enrichment.
+// @Description dry_run только проверяет строки, atomic сохраняет пользователей, только если все строки приняты
+// @Tags example
+// @Accept   text/csv
+// @Accept   application/x-ndjson
+// @Produce  json
+// @Param   format query string false "csv или ndjson, по умолчанию по Content-Type"
+// @Param   dry_run query bool false "Только проверить"
+// @Param   atomic query bool false "Все или ничего"
+// @Success 200 {object} importer.Report
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 422 {object} importer.Report "Атомарный импорт отменен из-за отклоненных строк"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/import [post]
+func (h *HandlerImportUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeBadRequest(w, r, "Wrong content type")
+			return
+		}
+		if format = importer.FormatFromContentType(mediaType); format == "" {
+			writeErrorResponse(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type",
+				fmt.Sprintf("Unsupported content type: %s", mediaType), nil)
+			return
+		}
+	}
+
+	options := importer.Options{Format: format}
+	for name, value := range map[string]*bool{"dry_run": &options.DryRun, "atomic": &options.Atomic} {
+		if query.Has(name) {
+			var err error
+			if *value, err = strconv.ParseBool(query.Get(name)); err != nil {
+				writeBadRequest(w, r, fmt.Sprintf("Wrong %s: %s", name, query.Get(name)))
+				return
+			}
+		}
+	}
+
+	log.Printf("Request to import users format: %s dry run: %t atomic: %t\n", options.Format, options.DryRun, options.Atomic)
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	defer body.Close()
+
+	report, err := importer.Import(r.Context(), h.Storage, body, options)
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &sizeErr):
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Sprintf("Request body is larger than %d bytes", sizeErr.Limit), nil)
+		return
+	case errors.Is(err, importer.ErrFormat):
+		writeBadRequest(w, r, err.Error())
+		return
+	case err != nil:
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("Imported users: %d duplicates: %d invalid: %d committed: %t\n",
+		report.Created, report.Duplicates, report.Invalid, report.Committed)
+
+	status := http.StatusOK
+	if report.Atomic && !report.DryRun && !report.Committed {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
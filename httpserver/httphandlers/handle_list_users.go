@@ -0,0 +1,118 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerListUsers struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Получить страницу пользователей
+// @Description Получить пользователей постранично с фильтрами и сортировкой
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   cursor query string false "Курсор следующей страницы из next_cursor"
+// @Param   limit query int false "Размер страницы"
+// @Param   min_age query int false "Минимальный возраст"
+// @Param   max_age query int false "Максимальный возраст"
+// @Param   gender query string false "Пол"
+// @Param   nationalize query string false "Национальность"
+// @Param   name_prefix query string false "Начало имени"
+// @Param   surname_prefix query string false "Начало фамилии"
+// @Param   surname query string false "Фамилия целиком, с учетом регистра"
+// @Param   email_domain query string false "Домен почты"
+// @Param   sort query string false "Поля сортировки через запятую, минус для убывания, например -age,name"
+// @Param   with_total query bool false "Посчитать общее количество"
+// @Success 200 {object} schemas.UserPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users [get]
+// @Router /api/users [get]
+func (h *HandlerListUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	options, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, r, err.Error())
+		return
+	}
+
+	log.Printf("Request to list users: %v\n", r.URL.RawQuery)
+
+	page, err := h.Storage.List(r.Context(), options)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
+
+func parseListOptions(query url.Values) (*storage.ListOptions, error) {
+	options := storage.ListOptions{
+		Cursor:        query.Get("cursor"),
+		Gender:        query.Get("gender"),
+		Nationalize:   query.Get("nationalize"),
+		NamePrefix:    query.Get("name_prefix"),
+		SurnamePrefix: query.Get("surname_prefix"),
+		Surname:       query.Get("surname"),
+		EmailDomain:   query.Get("email_domain"),
+	}
+
+	intParams := []struct {
+		key    string
+		target **int
+	}{
+		{"min_age", &options.MinAge},
+		{"max_age", &options.MaxAge},
+	}
+
+	for _, param := range intParams {
+		if value := query.Get(param.key); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("Wrong %s: %s", param.key, value)
+			}
+			*param.target = &number
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("Wrong limit: %s", value)
+		}
+		options.Limit = limit
+	}
+
+	if value := query.Get("with_total"); value != "" {
+		withTotal, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Wrong with_total: %s", value)
+		}
+		options.WithTotal = withTotal
+	}
+
+	sort, err := storage.ParseSort(query.Get("sort"))
+	if err != nil {
+		return nil, err
+	}
+	options.Sort = sort
+
+	return &options, nil
+}
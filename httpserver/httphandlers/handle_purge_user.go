@@ -0,0 +1,49 @@
+package httphandlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerPurgeUser struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Окончательно удалить пользователя
+// @Description Безвозвратно удаляет мягко удаленного пользователя и его почты. Неудаленного пользователя сначала нужно удалить, иначе 409
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "id пользователя"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Пользователь не удален"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/purge [delete]
+// @Router /api/users/{id}/purge_user [delete]
+func (h *HandlerPurgeUser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeBadRequest(w, r, "Wrong user id")
+		return
+	}
+
+	log.Printf("Request to purge user with id: %d\n", id)
+
+	if err := h.Storage.PurgeUser(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package httphandlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/validation"
+	"github.com/nkhamm-spb/red_soft_test/worker"
+)
+
+type HandlerReenrich struct {
+	Reenricher *worker.Reenricher
+	// Context отменяется при остановке сервера, запуск на нем переживает запрос.
+	Context context.Context
+}
+
+// @Summary Повторно обогатить пользователей
+// @Description Поставить выбранных пользователей в очередь обогащения. Запуск идет в фоне,
+// @Description поля, измененные вручную, не перезаписываются. Ответы провайдеров запрашиваются мимо кэша
+// @Tags admin
+// @Accept   json
+// @Produce  json
+// @Param   input body   schemas.Reenrich true  "Фильтры и скорость"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/admin/reenrich [post]
+func (h *HandlerReenrich) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request schemas.Reenrich
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBadRequest(w, r, "Wrong request body")
+		return
+	}
+
+	if err := validation.Validate(&request); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if request.Rate < 0 {
+		writeBadRequest(w, r, "Wrong rate")
+		return
+	}
+
+	log.Printf("Request to reenrich users: %+v\n", request)
+
+	// Запуск переживает запрос, но не остановку сервиса: прогресс хранится
+	// в контрольной точке.
+	run, err := h.Reenricher.Start(h.Context, worker.ReenrichOptions{
+		Run: request.Run,
+		Filter: storage.ReenrichFilter{
+			EmptyFields:   request.EmptyFields,
+			Nationalize:   request.Nationalize,
+			CreatedBefore: request.CreatedBefore,
+		},
+		Rate: request.Rate,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"run": run}); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
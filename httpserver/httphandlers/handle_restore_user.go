@@ -0,0 +1,51 @@
+package httphandlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerRestoreUser struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Восстановить пользователя
+// @Description Восстановить удаленного, но еще не удаленного окончательно пользователя
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "id пользователя"
+// @Success 200 {object} schemas.User
+// @Header  200 {string} ETag "Версия пользователя"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/restore [post]
+// @Router /api/users/{id}/restore_user [post]
+func (h *HandlerRestoreUser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeBadRequest(w, r, "Wrong user id")
+		return
+	}
+
+	log.Printf("Request to restore user with id: %d\n", id)
+
+	user, err := h.Storage.RestoreUser(r.Context(), id)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeUser(w, user)
+}
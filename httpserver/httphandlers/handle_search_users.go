@@ -0,0 +1,61 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerSearchUsers struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary Поиск пользователей
+// @Description Нечеткий и полнотекстовый поиск по имени, фамилии и почте без учета регистра и диакритики.
+// @Description Кириллица и латиница совпадают, например Пётр находится по Petr и Pyotr.
+// @Description Результаты упорядочены по убыванию score, в matches совпавшие слова обернуты в <mark>
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   q query string true "Строка поиска"
+// @Param   limit query int false "Максимум результатов"
+// @Success 200 {array} schemas.SearchResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/search [get]
+func (h *HandlerSearchUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeBadRequest(w, r, "Missing q")
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			writeBadRequest(w, r, "Wrong limit: "+value)
+			return
+		}
+	}
+
+	log.Printf("Request to search users: %s\n", query)
+
+	results, err := h.Storage.Search(r.Context(), query, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
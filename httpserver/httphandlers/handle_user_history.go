@@ -0,0 +1,66 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+type HandlerUserHistory struct {
+	Storage storage.StorageInterface
+}
+
+// @Summary История изменений пользователя
+// @Description Записи истории от старых к новым: кто, когда и в каком запросе изменил пользователя,
+// @Description и значения полей до и после. История доступна после мягкого удаления, после purge ответ 410
+// @Tags example
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "id пользователя"
+// @Param   field query string false "Только изменения поля, например nationalize"
+// @Success 200 {array} schemas.AuditRecord
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse "Пользователь окончательно удален, история очищена"
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/history [get]
+func (h *HandlerUserHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeBadRequest(w, r, "Wrong user id")
+		return
+	}
+
+	log.Printf("Request to get history of user with id: %d\n", id)
+
+	records, err := h.Storage.History(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if field := r.URL.Query().Get("field"); field != "" {
+		filtered := make([]schemas.AuditRecord, 0)
+		for _, record := range records {
+			if _, ok := record.Changes[field]; ok {
+				filtered = append(filtered, record)
+			}
+		}
+		records = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,78 @@
+package httphandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestUserHistory(t *testing.T) {
+	memory := storage.NewMemory()
+	_, err := memory.AddUser(context.Background(), &schemas.User{Name: "Ivan", Surname: "Petrov"})
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond)
+	created := time.Now()
+	time.Sleep(time.Millisecond)
+
+	serve := func(handler http.Handler, method string, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		request = mux.SetURLVars(request, map[string]string{"id": "1"})
+		RequestID(Audit(handler)).ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(&HandlerEditUser{Storage: memory}, http.MethodPatch, "/api/v1/users/1", `{"surname":"Sidorov","age":30}`,
+		map[string]string{"Content-Type": "application/merge-patch+json", "X-Actor": "operator", "X-Request-ID": "edit-1"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	history := &HandlerUserHistory{Storage: memory}
+	recorder = serve(history, http.MethodGet, "/api/v1/users/1/history", "", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var records []schemas.AuditRecord
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &records))
+	require.Len(t, records, 2)
+	require.Equal(t, schemas.AuditCreate, records[0].Action)
+	require.Equal(t, "system", records[0].Actor)
+	require.Equal(t, schemas.AuditEdit, records[1].Action)
+	require.Equal(t, "operator", records[1].Actor)
+	require.Equal(t, "edit-1", records[1].RequestID)
+	require.Equal(t, `"Petrov"`, string(records[1].Changes["surname"].Before))
+	require.Equal(t, `"Sidorov"`, string(records[1].Changes["surname"].After))
+
+	recorder = serve(history, http.MethodGet, "/api/v1/users/1/history?field=sources", "", nil)
+	records = nil
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &records))
+	require.Len(t, records, 2)
+	require.Equal(t, `{"age":"manual"}`, string(records[1].Changes["sources"].After))
+
+	recorder = serve(history, http.MethodGet, "/api/v1/users/1/history?field=emails", "", nil)
+	require.Equal(t, "[]\n", recorder.Body.String())
+
+	get := &HandlerGetUser{Storage: memory}
+	recorder = serve(get, http.MethodGet, "/api/v1/users/1?as_of="+url.QueryEscape(created.Format(time.RFC3339Nano)), "", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"surname":"Petrov"`)
+
+	recorder = serve(get, http.MethodGet, "/api/v1/users/1?as_of=2000-01-01T00:00:00Z", "", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(get, http.MethodGet, "/api/v1/users/1?as_of=yesterday", "", nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -14,33 +14,34 @@ type HandlerGetBySurname struct {
 	Storage storage.StorageInterface
 }
 
-// @Summary Получить данные пользователя по фамилии
-// @Description Получить данные пользователя по фамилии
+// @Summary Получить пользователей по фамилии
+// @Description Получить всех пользователей с точно совпадающей фамилией по возрастанию id
 // @Tags example
 // @Accept  json
 // @Produce  json
 // @Param   surname path string true "Фамилия пользователя"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
+// @Success 200 {array} schemas.User
+// @Failure 401 {object} ErrorResponse "Нет или неверный ключ API или токен"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /api/users/get_by_surname/{surname} [get]
 func (h *HandlerGetBySurname) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	surname := vars["surname"]
-	log.Printf("Request to get user with surname: %s", surname)
+	log.Printf("Request to get users with surname: %s", surname)
 
-	user, err := h.Storage.GetUserBySurname(r.Context(), surname)
+	users, err := h.Storage.GetUsersBySurname(r.Context(), surname)
 
 	if err != nil {
-		log.Printf("Error in get user by surname request: %v\n", err.Error())
-
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if err := json.NewEncoder(w).Encode(users); err != nil {
+		log.Printf("Error in encode response: %v\n", err)
 	}
 }
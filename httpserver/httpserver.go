@@ -2,6 +2,7 @@ package httpserver
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,32 +10,97 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/nkhamm-spb/red_soft_test/auth"
 	"github.com/nkhamm-spb/red_soft_test/config"
 	_ "github.com/nkhamm-spb/red_soft_test/docs"
 	"github.com/nkhamm-spb/red_soft_test/httpserver/httphandlers"
 	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/worker"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+// Старые маршруты /api/users/... объявлены устаревшими с появлением /api/v1.
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunsetAfter  = 180 * 24 * time.Hour
+)
+
 type Server struct {
 	config *config.Server
 
 	httpServer *http.Server
 	router     *mux.Router
+
+	// ctx живет до Shutdown, на нем выполняются фоновые задачи обработчиков.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func New(ctx context.Context, storage *storage.Storage, config *config.Server) (*Server, error) {
+func New(ctx context.Context, storage storage.StorageInterface, pool *worker.Pool, reenricher *worker.Reenricher, config *config.Server) (*Server, error) {
 	log.Printf("Creating new HTTP server")
 
 	server := &Server{config: config}
 	server.httpServer = &http.Server{}
+	server.ctx, server.cancel = context.WithCancel(ctx)
 
 	server.router = mux.NewRouter()
-	server.router.Handle("/api/users/{id:[0-9]+}/get_user", &httphandlers.HandlerGetUser{Storage: storage}).Methods("GET")
-	server.router.Handle("/api/users/{id:[0-9]+}/edit_user", &httphandlers.HandlerEditUser{Storage: storage}).Methods("PUT")
-	server.router.Handle("/api/users/add_user", &httphandlers.HandlerAddUser{Storage: storage}).Methods("POST")
-	server.router.Handle("/api/users/get_by_surname/{surname}", &httphandlers.HandlerGetBySurname{Storage: storage}).Methods("GET")
-	server.router.Handle("/api/users/get_all", &httphandlers.HandlerGetAll{Storage: storage}).Methods("GET")
+
+	middlewares := []mux.MiddlewareFunc{httphandlers.RequestID}
+	if config.Auth.Disabled {
+		log.Println("Authentication is disabled, all routes are open")
+	} else {
+		authenticator, err := auth.New(&config.Auth, storage)
+		if err != nil {
+			return nil, err
+		}
+
+		publicPaths := httphandlers.DefaultPublicPaths
+		if config.Auth.PublicPaths != nil {
+			publicPaths = *config.Auth.PublicPaths
+		}
+		middlewares = append(middlewares, httphandlers.Authenticate(authenticator, publicPaths))
+	}
+	server.router.Use(append(middlewares, httphandlers.Audit)...)
+
+	v1 := server.router.PathPrefix("/api/v1").Subrouter()
+	v1.Handle("/users", &httphandlers.HandlerListUsers{Storage: storage}).Methods("GET")
+	v1.Handle("/users", &httphandlers.HandlerAddUser{Storage: storage, LocationPrefix: "/api/v1/users"}).Methods("POST")
+	v1.Handle("/users/export", &httphandlers.HandlerExportUsers{Storage: storage}).Methods("GET")
+	v1.Handle("/users/import", &httphandlers.HandlerImportUsers{Storage: storage}).Methods("POST")
+	v1.Handle("/users/search", &httphandlers.HandlerSearchUsers{Storage: storage}).Methods("GET")
+	v1.Handle("/users/by-email/{email}", &httphandlers.HandlerGetByEmail{Storage: storage}).Methods("GET")
+	v1.Handle("/users/{id:[0-9]+}", &httphandlers.HandlerGetUser{Storage: storage}).Methods("GET")
+	v1.Handle("/users/{id:[0-9]+}", &httphandlers.HandlerEditUser{Storage: storage, Replace: true}).Methods("PUT")
+	v1.Handle("/users/{id:[0-9]+}", &httphandlers.HandlerEditUser{Storage: storage}).Methods("PATCH")
+	v1.Handle("/users/{id:[0-9]+}", &httphandlers.HandlerDeleteUser{Storage: storage, NoContent: true}).Methods("DELETE")
+	v1.Handle("/users/{id:[0-9]+}/restore", &httphandlers.HandlerRestoreUser{Storage: storage}).Methods("POST")
+	v1.Handle("/users/{id:[0-9]+}/purge", &httphandlers.HandlerPurgeUser{Storage: storage}).Methods("DELETE")
+	v1.Handle("/users/{id:[0-9]+}/history", &httphandlers.HandlerUserHistory{Storage: storage}).Methods("GET")
+	v1.Handle("/users/{id:[0-9]+}/enrichment", &httphandlers.HandlerEnrichmentStatus{Storage: storage, Pool: pool}).Methods("GET")
+	v1.Handle("/admin/reenrich", &httphandlers.HandlerReenrich{Reenricher: reenricher, Context: server.ctx}).Methods("POST")
+
+	// Старые маршруты работают как раньше, но сообщают о замене и дате отключения.
+	sunset := config.LegacySunset
+	if sunset.IsZero() {
+		sunset = legacyDeprecatedAt.Add(legacySunsetAfter)
+	}
+	legacy := func(path string, successor string, handler http.Handler) *mux.Route {
+		return server.router.Handle(path, httphandlers.Deprecated(successor, legacyDeprecatedAt, sunset)(handler))
+	}
+	legacy("/api/users/{id:[0-9]+}/get_user", "/api/v1/users/{id}", &httphandlers.HandlerGetUser{Storage: storage}).Methods("GET")
+	legacy("/api/users/{id:[0-9]+}/edit_user", "/api/v1/users/{id}", &httphandlers.HandlerEditUser{Storage: storage}).Methods("PUT")
+	legacy("/api/users/{id:[0-9]+}/delete_user", "/api/v1/users/{id}", &httphandlers.HandlerDeleteUser{Storage: storage}).Methods("DELETE")
+	legacy("/api/users/{id:[0-9]+}/restore_user", "/api/v1/users/{id}/restore", &httphandlers.HandlerRestoreUser{Storage: storage}).Methods("POST")
+	legacy("/api/users/{id:[0-9]+}/purge_user", "/api/v1/users/{id}/purge", &httphandlers.HandlerPurgeUser{Storage: storage}).Methods("DELETE")
+	legacy("/api/users/{id:[0-9]+}/enrichment", "/api/v1/users/{id}/enrichment", &httphandlers.HandlerEnrichmentStatus{Storage: storage, Pool: pool}).Methods("GET")
+	legacy("/api/users/add_user", "/api/v1/users", &httphandlers.HandlerAddUser{Storage: storage}).Methods("POST")
+	legacy("/api/users/get_by_surname/{surname}", "/api/v1/users?surname={surname}", &httphandlers.HandlerGetBySurname{Storage: storage}).Methods("GET")
+	legacy("/api/users", "/api/v1/users", &httphandlers.HandlerListUsers{Storage: storage}).Methods("GET")
+	legacy("/api/users/get_all", "/api/v1/users", &httphandlers.HandlerGetAll{Storage: storage}).Methods("GET")
+	legacy("/api/admin/reenrich", "/api/v1/admin/reenrich", &httphandlers.HandlerReenrich{Reenricher: reenricher, Context: server.ctx}).Methods("POST")
+
+	server.router.Handle("/health", &httphandlers.HandlerHealth{}).Methods("GET")
+	server.router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 
 	server.router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"), // URL документации
@@ -52,6 +118,7 @@ func (s *Server) Run() error {
 
 func (s *Server) Shutdown() error {
 	log.Printf("Waiting for shutdown HTTP Server")
+	s.cancel()
 
 	cancelCtx, cancel := context.WithTimeout(context.Background(), time.Duration(5*int(time.Second)))
 	defer cancel()
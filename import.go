@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/importer"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// runImport добавляет пользователей из файла или stdin:
+//
+//	import [-format csv|ndjson] [-dry-run] [-atomic] [-chunk 100] users.csv
+//
+// Формат по умолчанию определяется по расширению файла. Выводятся только
+// непринятые строки и итог.
+func runImport(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+
+	var options importer.Options
+	flags.StringVar(&options.Format, "format", "", "csv or ndjson, default from file extension")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "only validate rows")
+	flags.BoolVar(&options.Atomic, "atomic", false, "create users only if all rows are accepted")
+	flags.IntVar(&options.ChunkSize, "chunk", importer.DefaultChunkSize, "users per insert")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: import [flags] file|-")
+	}
+
+	var input io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+
+		if options.Format == "" {
+			options.Format = importer.FormatFromContentType(strings.ToLower(filepath.Ext(path)))
+		}
+	}
+	if options.Format == "" {
+		return fmt.Errorf("Unknown format, use -format csv or -format ndjson")
+	}
+
+	storage, err := storage.Open(ctx, &config.Storage)
+	if err != nil {
+		return err
+	}
+
+	report, err := importer.Import(ctx, storage, input, options)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case importer.StatusDuplicate:
+			if row.DuplicateOfLine != 0 {
+				fmt.Printf("line %d: duplicate email %s of line %d\n", row.Line, row.Email, row.DuplicateOfLine)
+			} else {
+				fmt.Printf("line %d: duplicate email %s of user %d\n", row.Line, row.Email, row.OwnerID)
+			}
+		case importer.StatusInvalid:
+			for _, field := range row.Errors {
+				fmt.Printf("line %d: %s %s\n", row.Line, field.Field, field.Message)
+			}
+		}
+	}
+
+	fmt.Printf("Created: %d duplicates: %d invalid: %d committed: %t\n",
+		report.Created, report.Duplicates, report.Invalid, report.Committed)
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package importer добавляет пользователей пакетами из CSV или NDJSON.
+//
+// Строки читаются потоком и проверяются по одной, проверенные добавляются
+// пакетами через storage.UserImport. Возраст, пол и национальность не
+// запрашиваются до вставки: пользователи создаются в статусе pending с
+// заданием в очереди, и пул обогащения обрабатывает их после импорта. Пул
+// выполняет задания одновременно, поэтому metadata.Batcher объединяет их в
+// пакетные запросы к провайдерам, а повторы, кэш, источники полей и история
+// работают так же, как после add_user. Импорт не ждет провайдеров, и
+// отклоненные строки не тратят запросы.
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/validation"
+)
+
+const DefaultChunkSize = 100
+
+// Статусы строк в отчете.
+const (
+	StatusCreated   = "created"
+	StatusDuplicate = "duplicate"
+	StatusInvalid   = "invalid"
+)
+
+type Options struct {
+	Format string
+	// DryRun проверяет все строки, включая занятые почты, но ничего не сохраняет.
+	DryRun bool
+	// Atomic сохраняет пользователей, только если все строки приняты.
+	Atomic    bool
+	ChunkSize int
+}
+
+// Row результат одной строки. Line номер строки входных данных с 1.
+// Для duplicate Email занятый адрес, а OwnerID его владелец или
+// DuplicateOfLine, если адрес встретился раньше в этом же импорте.
+type Row struct {
+	Line            int                  `json:"line"`
+	Status          string               `json:"status"`
+	UserID          int                  `json:"user_id,omitempty"`
+	Email           string               `json:"email,omitempty"`
+	OwnerID         int                  `json:"owner_id,omitempty"`
+	DuplicateOfLine int                  `json:"duplicate_of_line,omitempty"`
+	Errors          []storage.FieldError `json:"errors,omitempty"`
+}
+
+// Report итог импорта. Если Committed ложно, строки created только прошли
+// проверку и пользователи не созданы.
+type Report struct {
+	DryRun     bool  `json:"dry_run"`
+	Atomic     bool  `json:"atomic"`
+	Committed  bool  `json:"committed"`
+	Created    int   `json:"created"`
+	Duplicates int   `json:"duplicates"`
+	Invalid    int   `json:"invalid"`
+	Rows       []Row `json:"rows"`
+}
+
+type pendingUser struct {
+	row  int
+	user *schemas.User
+}
+
+type importRun struct {
+	session storage.UserImport
+	report  *Report
+	pending []pendingUser
+	// lines строки, в которых созданы пользователи этого импорта.
+	lines map[int]int
+}
+
+// Import читает input и добавляет пользователей. Ошибка возвращается, только
+// если импорт прерван целиком, например из-за неверного заголовка CSV или
+// недоступной базы. Пакеты, сохраненные до этого в неатомарном режиме, остаются.
+func Import(ctx context.Context, userStorage storage.StorageInterface, input io.Reader, options Options) (*Report, error) {
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = DefaultChunkSize
+	}
+
+	reader, err := newReader(input, options.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := userStorage.BeginImport(ctx, options.Atomic || options.DryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &importRun{
+		session: session,
+		report:  &Report{DryRun: options.DryRun, Atomic: options.Atomic, Rows: make([]Row, 0)},
+		lines:   make(map[int]int),
+	}
+
+	if err := run.read(ctx, reader, options.ChunkSize); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	report := run.report
+	if options.DryRun || options.Atomic && report.Duplicates+report.Invalid > 0 {
+		if err := session.Rollback(); err != nil {
+			return nil, err
+		}
+		for i := range report.Rows {
+			report.Rows[i].UserID = 0
+		}
+		return report, nil
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	report.Committed = true
+
+	return report, nil
+}
+
+func (run *importRun) read(ctx context.Context, reader reader, chunkSize int) error {
+	for {
+		record, err := reader.next()
+		if err == io.EOF {
+			return run.flush(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		run.report.Rows = append(run.report.Rows, Row{Line: record.line})
+		row := len(run.report.Rows) - 1
+
+		if record.err == nil {
+			if err := validation.Validate(&record.user); err != nil {
+				errors.As(err, &record.err)
+			}
+		}
+		if record.err != nil {
+			run.reject(row, record.err)
+			continue
+		}
+
+		run.pending = append(run.pending, pendingUser{row: row, user: &schemas.User{
+			Name:             record.user.Name,
+			Surname:          record.user.Surname,
+			Emails:           record.user.Emails,
+			EnrichmentStatus: schemas.EnrichmentPending,
+		}})
+
+		if len(run.pending) >= chunkSize {
+			if err := run.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (run *importRun) flush(ctx context.Context) error {
+	if len(run.pending) == 0 {
+		return nil
+	}
+
+	users := make([]*schemas.User, len(run.pending))
+	for i, pending := range run.pending {
+		users[i] = pending.user
+	}
+
+	errs, err := run.session.Add(ctx, users)
+	if err != nil {
+		return err
+	}
+
+	for i, pending := range run.pending {
+		if errs[i] != nil {
+			run.reject(pending.row, errs[i])
+			continue
+		}
+
+		row := &run.report.Rows[pending.row]
+		row.Status = StatusCreated
+		row.UserID = pending.user.ID
+		run.lines[pending.user.ID] = row.Line
+		run.report.Created++
+	}
+
+	run.pending = run.pending[:0]
+	return nil
+}
+
+func (run *importRun) reject(index int, err error) {
+	row := &run.report.Rows[index]
+
+	var conflictErr *storage.EmailConflictError
+	var validationErr *storage.ValidationError
+	switch {
+	case errors.As(err, &conflictErr):
+		row.Status = StatusDuplicate
+		row.Email = conflictErr.Email
+		if line, ok := run.lines[conflictErr.UserID]; ok {
+			row.DuplicateOfLine = line
+		} else {
+			row.OwnerID = conflictErr.UserID
+		}
+		run.report.Duplicates++
+	case errors.Is(err, storage.ErrConflict):
+		row.Status = StatusDuplicate
+		run.report.Duplicates++
+	case errors.As(err, &validationErr):
+		row.Status = StatusInvalid
+		row.Errors = validationErr.Fields
+		run.report.Invalid++
+	default:
+		row.Status = StatusInvalid
+		row.Errors = []storage.FieldError{{Message: err.Error()}}
+		run.report.Invalid++
+	}
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestImportCSV(t *testing.T) {
+	memory := storage.NewMemory()
+	ctx := context.Background()
+
+	owner, err := memory.AddUser(ctx, &schemas.User{Name: "Old", Surname: "Owner", Emails: []string{"taken@test.com"}})
+	require.NoError(t, err)
+
+	input := strings.Join([]string{
+		"name,surname,emails",
+		"Ivan,Petrov,ivan@test.com;ivan2@test.com",
+		"Petr,Ivanov1,petr@test.com",
+		"Anna,Sidorova,IVAN@test.com",
+		"Olga,Smirnova,taken@test.com",
+		"Maria,Popova",
+		`"Ivan,Ivanov`,
+	}, "\n")
+
+	report, err := Import(ctx, memory, strings.NewReader(input), Options{Format: FormatCSV, ChunkSize: 2})
+	require.NoError(t, err)
+	require.True(t, report.Committed)
+	require.Equal(t, 1, report.Created)
+	require.Equal(t, 2, report.Duplicates)
+	require.Equal(t, 3, report.Invalid)
+
+	require.Equal(t, StatusCreated, report.Rows[0].Status)
+	require.Equal(t, 2, report.Rows[0].Line)
+
+	require.Equal(t, StatusInvalid, report.Rows[1].Status)
+	require.Equal(t, []storage.FieldError{{Field: "surname", Message: "must contain only Latin or Cyrillic letters, spaces, hyphens and apostrophes"}}, report.Rows[1].Errors)
+
+	require.Equal(t, Row{Line: 4, Status: StatusDuplicate, Email: "IVAN@test.com", DuplicateOfLine: 2}, report.Rows[2])
+	require.Equal(t, Row{Line: 5, Status: StatusDuplicate, Email: "taken@test.com", OwnerID: owner.ID}, report.Rows[3])
+
+	require.Equal(t, StatusInvalid, report.Rows[4].Status)
+	require.Equal(t, 6, report.Rows[4].Line)
+	require.Equal(t, StatusInvalid, report.Rows[5].Status)
+	require.Equal(t, 7, report.Rows[5].Line)
+
+	user, err := memory.GetUserById(ctx, report.Rows[0].UserID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ivan@test.com", "ivan2@test.com"}, user.Emails)
+	require.Equal(t, schemas.EnrichmentPending, user.EnrichmentStatus)
+}
+
+func TestImportNDJSON(t *testing.T) {
+	memory := storage.NewMemory()
+	ctx := context.Background()
+
+	input := `{"name": "Ivan", "surname": "Petrov", "emails": ["ivan@test.com"]}
+
+not json
+{"name": "Anna", "surname": "Sidorova"}`
+
+	report, err := Import(ctx, memory, strings.NewReader(input), Options{Format: FormatNDJSON})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Created)
+	require.Equal(t, []Row{
+		{Line: 1, Status: StatusCreated, UserID: report.Rows[0].UserID},
+		{Line: 3, Status: StatusInvalid, Errors: []storage.FieldError{{Message: "must be a JSON object with name, surname and emails"}}},
+		{Line: 4, Status: StatusCreated, UserID: report.Rows[2].UserID},
+	}, report.Rows)
+
+	users, err := memory.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+}
+
+func TestImportDryRunAndAtomic(t *testing.T) {
+	memory := storage.NewMemory()
+	ctx := context.Background()
+
+	input := "name,surname,email\nIvan,Petrov,ivan@test.com\nAnna,Sidorova,ivan@test.com\n"
+
+	report, err := Import(ctx, memory, strings.NewReader(input), Options{Format: FormatCSV, DryRun: true})
+	require.NoError(t, err)
+	require.False(t, report.Committed)
+	require.Equal(t, 1, report.Created)
+	require.Equal(t, 1, report.Duplicates)
+	require.Zero(t, report.Rows[0].UserID)
+	require.Equal(t, 2, report.Rows[1].DuplicateOfLine)
+
+	report, err = Import(ctx, memory, strings.NewReader(input), Options{Format: FormatCSV, Atomic: true})
+	require.NoError(t, err)
+	require.False(t, report.Committed)
+
+	users, err := memory.GetAll(ctx)
+	require.NoError(t, err)
+	require.Empty(t, users)
+
+	report, err = Import(ctx, memory, strings.NewReader("name,surname\nIvan,Petrov\n"), Options{Format: FormatCSV, Atomic: true})
+	require.NoError(t, err)
+	require.True(t, report.Committed)
+
+	users, err = memory.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, report.Rows[0].UserID, users[0].ID)
+
+	_, err = Import(ctx, memory, strings.NewReader("name,age\n"), Options{Format: FormatCSV})
+	require.True(t, errors.Is(err, ErrFormat))
+}
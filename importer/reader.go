@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// Форматы входных данных.
+const (
+	// CSV с заголовком name,surname,emails. Несколько почт в одной ячейке
+	// разделяются точкой с запятой или пробелом.
+	FormatCSV = "csv"
+	// NDJSON по объекту schemas.NewUser в строке, как тело add_user.
+	FormatNDJSON = "ndjson"
+)
+
+// ErrFormat неизвестный формат или неверный заголовок, импорт не начинается.
+var ErrFormat = errors.New("Wrong import format")
+
+// record строка входных данных. err ошибка разбора только этой строки.
+type record struct {
+	line int
+	user schemas.NewUser
+	err  *storage.ValidationError
+}
+
+// reader читает строки по одной, в конце возвращает io.EOF.
+type reader interface {
+	next() (*record, error)
+}
+
+func newReader(input io.Reader, format string) (reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(input)
+	case FormatNDJSON:
+		return &ndjsonReader{input: bufio.NewReader(input)}, nil
+	default:
+		return nil, fmt.Errorf("Unknown import format %s: %w", format, ErrFormat)
+	}
+}
+
+// FormatFromContentType формат по заголовку Content-Type или расширению
+// файла, пустая строка если не подходит ни один.
+func FormatFromContentType(contentType string) string {
+	switch contentType {
+	case "text/csv", ".csv":
+		return FormatCSV
+	case "application/x-ndjson", "application/jsonl", ".ndjson", ".jsonl":
+		return FormatNDJSON
+	}
+	return ""
+}
+
+type csvReader struct {
+	csv     *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(input io.Reader) (*csvReader, error) {
+	reader := &csvReader{csv: csv.NewReader(input), columns: make(map[string]int)}
+	reader.csv.TrimLeadingSpace = true
+
+	header, err := reader.csv.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("Missing csv header: %w", ErrFormat)
+		}
+		return nil, fmt.Errorf("Error read csv header %v: %w", err, ErrFormat)
+	}
+
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		switch column {
+		case "email":
+			column = "emails"
+		case "name", "surname", "emails":
+		default:
+			return nil, fmt.Errorf("Unknown csv column %s: %w", column, ErrFormat)
+		}
+		reader.columns[column] = i
+	}
+
+	for _, column := range []string{"name", "surname"} {
+		if _, ok := reader.columns[column]; !ok {
+			return nil, fmt.Errorf("Missing csv column %s: %w", column, ErrFormat)
+		}
+	}
+
+	return reader, nil
+}
+
+func (reader *csvReader) next() (*record, error) {
+	fields, err := reader.csv.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &record{line: parseErr.StartLine, err: rowError("", parseErr.Err.Error())}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error read csv: %w", err)
+	}
+	line, _ := reader.csv.FieldPos(0)
+
+	value := func(column string) string {
+		if i, ok := reader.columns[column]; ok {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+
+	user := schemas.NewUser{Name: value("name"), Surname: value("surname")}
+	user.Emails = strings.FieldsFunc(value("emails"), func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+
+	return &record{line: line, user: user}, nil
+}
+
+type ndjsonReader struct {
+	input *bufio.Reader
+	line  int
+}
+
+func (reader *ndjsonReader) next() (*record, error) {
+	for {
+		data, err := reader.input.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("Error read ndjson: %w", err)
+		}
+		if err == io.EOF && len(data) == 0 {
+			return nil, io.EOF
+		}
+		reader.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		row := &record{line: reader.line}
+		if err := json.Unmarshal(data, &row.user); err != nil {
+			row.err = rowError("", "must be a JSON object with name, surname and emails")
+		}
+		return row, nil
+	}
+}
+
+func rowError(field string, message string) *storage.ValidationError {
+	return &storage.ValidationError{Fields: []storage.FieldError{{Field: field, Message: message}}}
+}
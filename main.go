@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -9,9 +10,20 @@ import (
 
 	"github.com/nkhamm-spb/red_soft_test/config"
 	"github.com/nkhamm-spb/red_soft_test/httpserver"
+	"github.com/nkhamm-spb/red_soft_test/metadata"
 	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/worker"
 )
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT токен в виде Bearer <token>
+
 func main() {
 	config, err := config.LoadConfig("config.yaml")
 
@@ -19,13 +31,46 @@ func main() {
 		log.Fatalf("Error occur on read config: %v", err)
 	}
 
-	storage, err := storage.New(context.Background(), &config.Storage)
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), config, os.Args[1:]); err != nil {
+			log.Fatalf("Error occur on run command: %v", err)
+		}
+		return
+	}
+
+	userStorage, err := storage.Open(context.Background(), &config.Storage)
 
 	if err != nil {
 		log.Fatalf("Error occur on init storage: %v", err)
 	}
 
-	server, err := httpserver.New(context.Background(), storage, &config.Server)
+	var persistentCache metadata.Cache
+	if config.Enrichment.Cache.Persistent {
+		if cache, ok := storage.NewEnrichmentCache(userStorage, config.Enrichment.Cache.TTL); ok {
+			persistentCache = cache
+		} else {
+			log.Printf("Persistent enrichment cache is not supported by storage %s", config.Storage.Type)
+		}
+	}
+
+	enricher, err := metadata.New(&config.Enrichment, persistentCache)
+
+	if err != nil {
+		log.Fatalf("Error occur on init enrichment: %v", err)
+	}
+
+	pool := worker.New(userStorage, enricher, &config.Enrichment.Worker)
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	go func() {
+		pool.Run(workersCtx)
+		close(workersDone)
+	}()
+
+	reenricher := worker.NewReenricher(userStorage, &config.Enrichment.Reenrich)
+
+	server, err := httpserver.New(context.Background(), userStorage, pool, reenricher, &config.Server)
 
 	if err != nil {
 		log.Fatalf("Error occur on create server: %v", err)
@@ -51,4 +96,31 @@ func main() {
 	}
 
 	log.Println("Server stopped")
+
+	reenricher.Wait()
+
+	stopWorkers()
+	<-workersDone
+}
+
+func runCommand(ctx context.Context, config *config.Config, args []string) error {
+	// Изменения из команд попадают в историю от имени команды.
+	ctx = storage.WithAuditInfo(ctx, storage.AuditInfo{Actor: args[0]})
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, config, args[1:])
+	case "purge":
+		return runPurge(ctx, config)
+	case "apikey":
+		return runAPIKey(ctx, config, args[1:])
+	case "export":
+		return runExport(ctx, config, args[1:])
+	case "import":
+		return runImport(ctx, config, args[1:])
+	case "reenrich":
+		return runReenrich(ctx, config, args[1:])
+	default:
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
 }
@@ -0,0 +1,146 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxBatchSize наибольшее число имен в одном запросе к провайдерам.
+const MaxBatchSize = 10
+
+// defaultBatchTimeout ограничивает пакетный запрос, если ни у одного из
+// ждущих вызовов нет дедлайна.
+const defaultBatchTimeout = time.Minute
+
+// Name имя и фамилия человека для пакетного запроса.
+type Name struct {
+	Name    string
+	Surname string
+}
+
+// BatchEnricher провайдер, который умеет определять данные сразу для
+// нескольких имен одним запросом. Результаты возвращаются в порядке names.
+type BatchEnricher interface {
+	Enricher
+	EnrichBatch(ctx context.Context, names []Name) ([]*Result, error)
+}
+
+// Batcher собирает одиночные запросы в пакеты и отправляет их одним вызовом
+// EnrichBatch, когда набралось size имен или прошло window с первого
+// запроса в пакете. Одинаковые имена в пакете запрашиваются один раз.
+type Batcher struct {
+	enricher BatchEnricher
+	size     int
+	window   time.Duration
+
+	mu      sync.Mutex
+	pending []*batchCall
+	// timer окна текущего пакета, останавливается при отправке по размеру.
+	timer *time.Timer
+}
+
+type batchCall struct {
+	ctx    context.Context
+	name   Name
+	done   chan struct{}
+	result *Result
+	err    error
+}
+
+func NewBatcher(enricher BatchEnricher, size int, window time.Duration) *Batcher {
+	return &Batcher{enricher: enricher, size: min(size, MaxBatchSize), window: window}
+}
+
+func (batcher *Batcher) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	call := &batchCall{ctx: ctx, name: Name{Name: name, Surname: surname}, done: make(chan struct{})}
+
+	batcher.mu.Lock()
+	batcher.pending = append(batcher.pending, call)
+	switch len(batcher.pending) {
+	case batcher.size:
+		go batcher.flush(batcher.take())
+	case 1:
+		var timer *time.Timer
+		timer = time.AfterFunc(batcher.window, func() {
+			batcher.mu.Lock()
+			// Пакет мог уйти по размеру, пока таймер срабатывал, тогда у
+			// следующего пакета свой таймер.
+			if batcher.timer != timer {
+				batcher.mu.Unlock()
+				return
+			}
+			batch := batcher.take()
+			batcher.mu.Unlock()
+
+			batcher.flush(batch)
+		})
+		batcher.timer = timer
+	}
+	batcher.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take забирает текущий пакет и останавливает его таймер, вызывается под mu.
+func (batcher *Batcher) take() []*batchCall {
+	if batcher.timer != nil {
+		batcher.timer.Stop()
+		batcher.timer = nil
+	}
+
+	batch := batcher.pending
+	batcher.pending = nil
+	return batch
+}
+
+// batchContext контекст пакетного запроса. Запрос не отменяется вместе с
+// отдельным вызовом: его ждут несколько вызывающих, и отмена одного не
+// должна ломать остальных. Дедлайн берется самый ранний из вызовов, а без
+// них defaultBatchTimeout.
+func batchContext(batch []*batchCall) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(defaultBatchTimeout)
+	for _, call := range batch {
+		if callDeadline, ok := call.ctx.Deadline(); ok && callDeadline.Before(deadline) {
+			deadline = callDeadline
+		}
+	}
+	return context.WithDeadline(context.WithoutCancel(batch[0].ctx), deadline)
+}
+
+// flush выполняет пакет с контекстом из batchContext.
+func (batcher *Batcher) flush(batch []*batchCall) {
+	ctx, cancel := batchContext(batch)
+	defer cancel()
+
+	var names []Name
+	index := make(map[string]int)
+	for _, call := range batch {
+		key := NormalizeName(call.name.Name, call.name.Surname)
+		if _, ok := index[key]; !ok {
+			index[key] = len(names)
+			names = append(names, call.name)
+		}
+	}
+
+	results, err := batcher.enricher.EnrichBatch(ctx, names)
+	if err == nil && len(results) != len(names) {
+		err = fmt.Errorf("Wrong batch result size: %d for %d names", len(results), len(names))
+	}
+
+	for _, call := range batch {
+		if err != nil {
+			call.err = err
+		} else {
+			copied := *results[index[NormalizeName(call.name.Name, call.name.Surname)]]
+			call.result = &copied
+		}
+		close(call.done)
+	}
+}
@@ -0,0 +1,141 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+)
+
+type countingBatchEnricher struct {
+	mu        sync.Mutex
+	batches   [][]Name
+	deadlines []time.Time
+}
+
+func (enricher *countingBatchEnricher) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	return nil, fmt.Errorf("Enrich must not be called")
+}
+
+func (enricher *countingBatchEnricher) EnrichBatch(ctx context.Context, names []Name) ([]*Result, error) {
+	deadline, _ := ctx.Deadline()
+	enricher.mu.Lock()
+	enricher.batches = append(enricher.batches, names)
+	enricher.deadlines = append(enricher.deadlines, deadline)
+	enricher.mu.Unlock()
+
+	results := make([]*Result, len(names))
+	for i, name := range names {
+		results[i] = &Result{Age: len(name.Name)}
+	}
+	return results, nil
+}
+
+func enrichAll(t *testing.T, enricher Enricher, names []string) []*Result {
+	results := make([]*Result, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := enricher.Enrich(context.Background(), name, "Petrov")
+			if err == nil {
+				results[i] = result
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func TestBatcherSize(t *testing.T) {
+	counting := &countingBatchEnricher{}
+	batcher := NewBatcher(counting, 3, time.Hour)
+
+	results := enrichAll(t, batcher, []string{"Ivan", "Anna", "Al"})
+	require.Len(t, counting.batches, 1)
+	require.Len(t, counting.batches[0], 3)
+	require.Equal(t, []*Result{{Age: 4}, {Age: 4}, {Age: 2}}, results)
+}
+
+func TestBatcherWindow(t *testing.T) {
+	counting := &countingBatchEnricher{}
+	batcher := NewBatcher(counting, 10, 20*time.Millisecond)
+
+	// Одинаковые имена запрашиваются один раз.
+	results := enrichAll(t, batcher, []string{"Ivan", "ivan", "Al"})
+	require.Len(t, counting.batches, 1)
+	require.Len(t, counting.batches[0], 2)
+	require.Equal(t, []*Result{{Age: 4}, {Age: 4}, {Age: 2}}, results)
+}
+
+func TestBatcherSizeStopsWindow(t *testing.T) {
+	counting := &countingBatchEnricher{}
+	batcher := NewBatcher(counting, 2, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	enrichAll(t, batcher, []string{"Ivan", "Anna"})
+
+	// Таймер ушедшего по размеру пакета не забирает следующий раньше окна.
+	start := time.Now()
+	result, err := batcher.Enrich(ctx, "Al", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, &Result{Age: 2}, result)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	require.Len(t, counting.deadlines, 2)
+	require.WithinDuration(t, time.Now().Add(defaultBatchTimeout), counting.deadlines[0], time.Second)
+	deadline, _ := ctx.Deadline()
+	require.Equal(t, deadline, counting.deadlines[1])
+}
+
+func TestBatcherContext(t *testing.T) {
+	batcher := NewBatcher(&countingBatchEnricher{}, 10, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := batcher.Enrich(ctx, "Ivan", "Petrov")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestProviderBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["name[]"]
+		if len(names) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var items []string
+		for _, name := range names {
+			if name == "Ivan Petrov" {
+				items = append(items, `{"name": "Ivan Petrov", "gender": "male", "probability": 0.99}`)
+			} else {
+				items = append(items, fmt.Sprintf(`{"name": %q, "gender": null, "probability": 0}`, name))
+			}
+		}
+		w.Write([]byte("[" + strings.Join(items, ",") + "]"))
+	}))
+	defer server.Close()
+
+	enricher, err := New(&config.Enrichment{
+		Providers: []config.Provider{{Name: "genderize", BaseURL: server.URL}},
+		Batch:     config.Batch{Size: 2, Window: time.Hour},
+	}, nil)
+	require.NoError(t, err)
+
+	results := enrichAll(t, enricher, []string{"Ivan", "Xyz"})
+	require.Equal(t, []*Result{{Gender: "male", GenderProbability: 0.99}, {}}, results)
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без запроса к провайдеру, пока его breaker открыт.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Breaker размыкается после threshold неудачных запросов подряд и не пускает
+// запросы cooldown. Затем пропускает один пробный запрос: успех замыкает
+// breaker, неудача снова размыкает его.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow сообщает, можно ли выполнить запрос. После true нужно вызвать
+// Success, Failure или Cancel.
+func (breaker *Breaker) Allow() bool {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	if breaker.threshold <= 0 || breaker.failures < breaker.threshold {
+		return true
+	}
+
+	if breaker.now().Before(breaker.openUntil) || breaker.probing {
+		return false
+	}
+
+	breaker.probing = true
+	return true
+}
+
+func (breaker *Breaker) Success() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.failures = 0
+	breaker.probing = false
+}
+
+// Cancel завершает запрос, отмененный вызывающим: счетчик неудач не
+// меняется, пробный запрос освобождается.
+func (breaker *Breaker) Cancel() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.probing = false
+}
+
+func (breaker *Breaker) Failure() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.failures++
+	breaker.probing = false
+	if breaker.threshold > 0 && breaker.failures >= breaker.threshold {
+		breaker.openUntil = breaker.now().Add(breaker.cooldown)
+	}
+}
@@ -0,0 +1,94 @@
+package metadata
+
+import (
+	"context"
+	"expvar"
+	"strings"
+)
+
+// Cache хранит результаты провайдеров по ключу из имени провайдера и
+// нормализованного имени человека.
+type Cache interface {
+	Get(ctx context.Context, key string) (*Result, bool)
+	Set(ctx context.Context, key string, result *Result)
+}
+
+// cacheVersion меняется при изменении формата Result, что бы старые записи в
+// постоянном кэше не читались.
+const cacheVersion = "v2"
+
+// cacheStats счетчики попаданий и промахов по провайдерам, доступны в /debug/vars.
+var cacheStats = expvar.NewMap("enrichment_cache")
+
+// NormalizeName приводит имя к ключу кэша: нижний регистр, пробелы схлопнуты.
+func NormalizeName(name string, surname string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name+" "+surname)), " ")
+}
+
+type refreshKey struct{}
+
+// WithRefresh помечает запрос как повторное обогащение: Cached не читает
+// кэш, а обновляет его свежим ответом.
+func WithRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+func isRefresh(ctx context.Context) bool {
+	refresh, _ := ctx.Value(refreshKey{}).(bool)
+	return refresh
+}
+
+// Cached кэширует успешные ответы Enricher. Ошибки не кэшируются.
+type Cached struct {
+	Enricher Enricher
+	Provider string
+	Cache    Cache
+}
+
+func (cached *Cached) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	key := cached.Provider + ":" + cacheVersion + ":" + NormalizeName(name, surname)
+
+	if isRefresh(ctx) {
+		cacheStats.Add(cached.Provider+".refreshes", 1)
+	} else if result, ok := cached.Cache.Get(ctx, key); ok {
+		cacheStats.Add(cached.Provider+".hits", 1)
+		copied := *result
+		return &copied, nil
+	} else {
+		cacheStats.Add(cached.Provider+".misses", 1)
+	}
+
+	result, err := cached.Enricher.Enrich(ctx, name, surname)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *result
+	cached.Cache.Set(ctx, key, &copied)
+
+	return result, nil
+}
+
+// Tiered проверяет кэши по порядку, найденное значение копируется в более
+// ранние кэши. Например LRU в памяти перед таблицей в Postgres.
+type Tiered struct {
+	Caches []Cache
+}
+
+func (tiered *Tiered) Get(ctx context.Context, key string) (*Result, bool) {
+	for i, cache := range tiered.Caches {
+		if result, ok := cache.Get(ctx, key); ok {
+			for j := 0; j < i; j++ {
+				tiered.Caches[j].Set(ctx, key, result)
+			}
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+func (tiered *Tiered) Set(ctx context.Context, key string, result *Result) {
+	for _, cache := range tiered.Caches {
+		cache.Set(ctx, key, result)
+	}
+}
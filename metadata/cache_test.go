@@ -0,0 +1,121 @@
+package metadata
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingEnricher struct {
+	calls int
+	// age ответа, по умолчанию 42.
+	age int
+}
+
+func (enricher *countingEnricher) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	enricher.calls++
+	if enricher.age != 0 {
+		return &Result{Age: enricher.age}, nil
+	}
+	return &Result{Age: 42}, nil
+}
+
+func TestNormalizeName(t *testing.T) {
+	require.Equal(t, "иван петров", NormalizeName("  Иван ", "ПЕТРОВ\t"))
+	require.Equal(t, NormalizeName("Ivan", "Petrov"), NormalizeName("ivan  ", " PETROV"))
+}
+
+func TestCached(t *testing.T) {
+	inner := &countingEnricher{}
+	cached := &Cached{Enricher: inner, Provider: "agify", Cache: NewLRU(10, time.Hour)}
+	ctx := context.Background()
+
+	hits, misses := statValue("agify.hits"), statValue("agify.misses")
+
+	result, err := cached.Enrich(ctx, "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, 42, result.Age)
+
+	result.Age = 1
+	result, err = cached.Enrich(ctx, " IVAN", "petrov ")
+	require.NoError(t, err)
+	require.Equal(t, 42, result.Age)
+	require.Equal(t, 1, inner.calls)
+
+	require.Equal(t, hits+1, statValue("agify.hits"))
+	require.Equal(t, misses+1, statValue("agify.misses"))
+}
+
+func TestCachedRefresh(t *testing.T) {
+	inner := &countingEnricher{}
+	cached := &Cached{Enricher: inner, Provider: "genderize", Cache: NewLRU(10, time.Hour)}
+	ctx := context.Background()
+
+	refreshes := statValue("genderize.refreshes")
+
+	_, err := cached.Enrich(ctx, "Ivan", "Petrov")
+	require.NoError(t, err)
+
+	// Повторное обогащение идет к провайдеру, даже если имя есть в кэше.
+	inner.age = 50
+	result, err := cached.Enrich(WithRefresh(ctx), "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, 50, result.Age)
+	require.Equal(t, 2, inner.calls)
+	require.Equal(t, refreshes+1, statValue("genderize.refreshes"))
+
+	// Свежий ответ заменяет запись в кэше.
+	result, err = cached.Enrich(ctx, "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, 50, result.Age)
+	require.Equal(t, 2, inner.calls)
+}
+
+func statValue(key string) int64 {
+	if value, ok := cacheStats.Get(key).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	lru := NewLRU(2, time.Minute)
+	lru.now = func() time.Time { return now }
+
+	lru.Set(ctx, "a", &Result{Age: 1})
+	lru.Set(ctx, "b", &Result{Age: 2})
+	_, ok := lru.Get(ctx, "a")
+	require.True(t, ok)
+
+	lru.Set(ctx, "c", &Result{Age: 3})
+	_, ok = lru.Get(ctx, "b")
+	require.False(t, ok, "least recently used entry must be evicted")
+	require.Equal(t, 2, lru.Len())
+
+	now = now.Add(2 * time.Minute)
+	_, ok = lru.Get(ctx, "a")
+	require.False(t, ok, "expired entry must not be returned")
+	require.Equal(t, 1, lru.Len())
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	first := NewLRU(10, time.Hour)
+	second := NewLRU(10, time.Hour)
+	tiered := &Tiered{Caches: []Cache{first, second}}
+
+	second.Set(ctx, "key", &Result{Gender: "male"})
+
+	result, ok := tiered.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, "male", result.Gender)
+
+	_, ok = first.Get(ctx, "key")
+	require.True(t, ok, "hit from the second tier must be copied to the first")
+}
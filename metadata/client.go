@@ -0,0 +1,216 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+)
+
+// Значения по умолчанию для незаданных полей enrichment.http.
+const (
+	defaultTimeout         = 5 * time.Second
+	defaultBackoffBase     = 200 * time.Millisecond
+	defaultBackoffMax      = 5 * time.Second
+	defaultBreakerCooldown = 30 * time.Second
+	maxResponseSize        = 1 << 20
+)
+
+// StatusError ответ провайдера с неуспешным HTTP статусом.
+type StatusError struct {
+	StatusCode int
+	URL        string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Wrong http status code: %d in url: %s", e.StatusCode, e.URL)
+}
+
+// Client выполняет запросы к провайдерам с таймаутом на попытку, повторами
+// на сетевых ошибках, 429 и 5xx и отдельным Breaker на каждого провайдера.
+type Client struct {
+	http   *http.Client
+	config config.HTTPClient
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+func NewClient(httpConfig *config.HTTPClient) *Client {
+	client := &Client{
+		http:     &http.Client{},
+		config:   *httpConfig,
+		breakers: make(map[string]*Breaker),
+		sleep:    sleep,
+	}
+
+	if client.config.Timeout <= 0 {
+		client.config.Timeout = defaultTimeout
+	}
+	if client.config.BackoffBase <= 0 {
+		client.config.BackoffBase = defaultBackoffBase
+	}
+	if client.config.BackoffMax <= 0 {
+		client.config.BackoffMax = defaultBackoffMax
+	}
+	if client.config.BreakerCooldown <= 0 {
+		client.config.BreakerCooldown = defaultBreakerCooldown
+	}
+
+	return client
+}
+
+func (client *Client) breaker(provider string) *Breaker {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	breaker, ok := client.breakers[provider]
+	if !ok {
+		breaker = NewBreaker(client.config.BreakerThreshold, client.config.BreakerCooldown)
+		client.breakers[provider] = breaker
+	}
+	return breaker
+}
+
+// GetJson запрашивает url и декодирует ответ в out.
+func (client *Client) GetJson(ctx context.Context, provider string, url string, out interface{}) error {
+	breaker := client.breaker(provider)
+
+	for attempt := 0; ; attempt++ {
+		if !breaker.Allow() {
+			return fmt.Errorf("Provider %s: %w", provider, ErrCircuitOpen)
+		}
+
+		err := client.get(ctx, url, out)
+		if err != nil && canceled(ctx, err) {
+			// Запрос отменил вызывающий, это ничего не говорит о провайдере.
+			breaker.Cancel()
+			return err
+		}
+		if err == nil || !retryable(ctx, err) {
+			// Провайдер ответил, значит он доступен, даже если ответ неверный.
+			breaker.Success()
+			return err
+		}
+		breaker.Failure()
+
+		if attempt >= client.config.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		delay := client.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		if err := client.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (client *Client) get(ctx context.Context, url string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, client.config.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.http.Do(request)
+	if err != nil {
+		return fmt.Errorf("Error in request %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+		return &StatusError{StatusCode: resp.StatusCode, URL: url, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("Error in request %w", err)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// backoff экспоненциальная задержка перед повтором с равномерным джиттером
+// в верхней половине интервала.
+func (client *Client) backoff(attempt int) time.Duration {
+	delay := client.config.BackoffBase << attempt
+	if delay <= 0 || delay > client.config.BackoffMax {
+		delay = client.config.BackoffMax
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if canceled(ctx, err) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr)
+}
+
+// canceled true, если запрос прерван отменой или дедлайном ctx вызывающего,
+// а не таймаутом Client.
+func canceled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled)
+}
+
+// parseRetryAfter понимает оба формата заголовка: секунды и HTTP дату.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+)
+
+func newTestClient(httpConfig *config.HTTPClient) (*Client, *[]time.Duration) {
+	client := NewClient(httpConfig)
+	delays := &[]time.Duration{}
+	client.sleep = func(ctx context.Context, delay time.Duration) error {
+		*delays = append(*delays, delay)
+		return nil
+	}
+	return client, delays
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"age": 42}`))
+		}
+	}))
+	defer server.Close()
+
+	client, delays := newTestClient(&config.HTTPClient{MaxRetries: 3, BackoffBase: time.Millisecond})
+
+	var data map[string]interface{}
+	require.NoError(t, client.GetJson(context.Background(), "agify", server.URL, &data))
+	require.Equal(t, float64(42), data["age"])
+	require.Equal(t, int32(3), calls.Load())
+	require.Len(t, *delays, 2)
+	require.Equal(t, 7*time.Second, (*delays)[1])
+}
+
+func TestClientNoRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(&config.HTTPClient{MaxRetries: 3})
+
+	var data map[string]interface{}
+	err := client.GetJson(context.Background(), "agify", server.URL, &data)
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(&config.HTTPClient{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	var data map[string]interface{}
+	for i := 0; i < 2; i++ {
+		require.Error(t, client.GetJson(context.Background(), "agify", server.URL, &data))
+	}
+
+	err := client.GetJson(context.Background(), "agify", server.URL, &data)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.Equal(t, int32(2), calls.Load())
+
+	// Breaker отдельный для каждого провайдера.
+	err = client.GetJson(context.Background(), "genderize", server.URL, &data)
+	require.False(t, errors.Is(err, ErrCircuitOpen))
+}
+
+func TestClientCanceled(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, delays := newTestClient(&config.HTTPClient{Timeout: time.Minute, MaxRetries: 3,
+		BreakerThreshold: 1, BreakerCooldown: time.Minute})
+
+	// Отмена вызывающим не повторяется и не размыкает breaker.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var data map[string]interface{}
+	err := client.GetJson(ctx, "agify", server.URL, &data)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), calls.Load())
+	require.Empty(t, *delays)
+	require.True(t, client.breaker("agify").Allow())
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(&config.HTTPClient{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	var data map[string]interface{}
+	require.Error(t, client.GetJson(context.Background(), "agify", server.URL, &data))
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	breaker := NewBreaker(1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	require.True(t, breaker.Allow())
+	breaker.Failure()
+	require.False(t, breaker.Allow())
+
+	now = now.Add(time.Minute)
+	require.True(t, breaker.Allow())
+	require.False(t, breaker.Allow())
+	breaker.Success()
+	require.True(t, breaker.Allow())
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU кэш в памяти с ограничением по размеру и времени жизни записей.
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	items    map[string]*list.Element
+
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	result    Result
+	expiresAt time.Time
+}
+
+func NewLRU(capacity int, ttl time.Duration) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (lru *LRU) Get(ctx context.Context, key string) (*Result, bool) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	element, ok := lru.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if lru.ttl > 0 && lru.now().After(entry.expiresAt) {
+		lru.order.Remove(element)
+		delete(lru.items, key)
+		return nil, false
+	}
+
+	lru.order.MoveToFront(element)
+	result := entry.result
+	return &result, true
+}
+
+func (lru *LRU) Set(ctx context.Context, key string, result *Result) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	expiresAt := lru.now().Add(lru.ttl)
+
+	if element, ok := lru.items[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.result = *result
+		entry.expiresAt = expiresAt
+		lru.order.MoveToFront(element)
+		return
+	}
+
+	lru.items[key] = lru.order.PushFront(&lruEntry{key: key, result: *result, expiresAt: expiresAt})
+
+	for lru.order.Len() > lru.capacity {
+		oldest := lru.order.Back()
+		lru.order.Remove(oldest)
+		delete(lru.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (lru *LRU) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	return lru.order.Len()
+}
@@ -2,93 +2,169 @@ package metadata
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"errors"
 	"log"
-	"net/http"
-	"net/url"
+	"sync"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
 )
 
-func GetJson(ctx context.Context, url string) (*map[string]interface{}, error) {
-	resp, err := http.Get(url)
+// Result данные о человеке, полученные от провайдеров. Пустое поле значит,
+// что провайдер его не определяет или не смог определить.
+type Result struct {
+	Age int `json:"age,omitempty"`
+	// AgeCount число записей, по которым провайдер определил возраст.
+	AgeCount          int     `json:"age_count,omitempty"`
+	Gender            string  `json:"gender,omitempty"`
+	GenderProbability float64 `json:"gender_probability,omitempty"`
+	Nationalize       string  `json:"nationalize,omitempty"`
+	// Nationalities все варианты национальности по убыванию вероятности.
+	Nationalities []schemas.Nationality `json:"nationalities,omitempty"`
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("Error in request %v", err)
+// Merge заполняет пустые поля result значениями из other. Значение поля
+// берется вместе с его достоверностью.
+func (result *Result) Merge(other *Result) {
+	if other == nil {
+		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Wrong http status code: %d in url: %s", resp.StatusCode, url)
+	if result.Age == 0 {
+		result.Age = other.Age
+		result.AgeCount = other.AgeCount
 	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if result.Gender == "" {
+		result.Gender = other.Gender
+		result.GenderProbability = other.GenderProbability
 	}
-
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
+	if result.Nationalize == "" && len(result.Nationalities) == 0 {
+		result.Nationalize = other.Nationalize
+		result.Nationalities = other.Nationalities
 	}
+}
 
-	return &data, nil
+// Apply записывает определенные поля в пользователя. Поля, заданные вручную,
+// не меняются. Оценки достоверности записываются, даже если значение не
+// прошло порог в Filter. Список национальностей заменяется целиком, если он
+// не пуст и национальность не задана вручную.
+func (result *Result) Apply(user *schemas.User) {
+	if user.Sources.Age != schemas.SourceManual {
+		if result.AgeCount != 0 {
+			user.AgeCount = result.AgeCount
+		}
+		if result.Age != 0 {
+			user.Age = result.Age
+			user.Sources.Age = schemas.SourceEnriched
+		}
+	}
+	if user.Sources.Gender != schemas.SourceManual {
+		if result.GenderProbability != 0 {
+			user.GenderProbability = result.GenderProbability
+		}
+		if result.Gender != "" {
+			user.Gender = result.Gender
+			user.Sources.Gender = schemas.SourceEnriched
+		}
+	}
+	if result.Nationalize != "" && user.Sources.Nationalize != schemas.SourceManual {
+		user.Nationalize = result.Nationalize
+		user.Sources.Nationalize = schemas.SourceEnriched
+	}
+	if len(result.Nationalities) > 0 && user.Sources.Nationalize != schemas.SourceManual {
+		user.Nationalities = append([]schemas.Nationality(nil), result.Nationalities...)
+	}
 }
 
-func GetGender(ctx context.Context, name string, surname string) (string, error) {
-	url := fmt.Sprintf("https://api.genderize.io?name=%s", url.QueryEscape(fmt.Sprintf("%s %s", name, surname)))
-	jsonMap, err := GetJson(ctx, url)
+// Empty сообщает, что ни одно поле не определено.
+func (result *Result) Empty() bool {
+	return result == nil || result.Age == 0 && result.Gender == "" && result.Nationalize == ""
+}
 
-	if err != nil {
-		return "", err
+// Filter очищает поля, достоверность которых ниже порогов. Сами оценки
+// достоверности и список национальностей остаются для анализа.
+func (result *Result) Filter(min *config.MinConfidence) {
+	if result.AgeCount < min.AgeCount {
+		result.Age = 0
 	}
-
-	if gender, ok := (*jsonMap)["gender"].(string); ok {
-		log.Printf("Getted gender: %s for user: %s %s\n", gender, name, surname)
-		return gender, nil
-	} else {
-		return "", fmt.Errorf("Gender wrong result format")
+	if result.GenderProbability < min.Gender {
+		result.Gender = ""
+	}
+	if len(result.Nationalities) > 0 && result.Nationalities[0].Probability < min.Nationality {
+		result.Nationalize = ""
 	}
 }
 
-func GetAge(ctx context.Context, name string, surname string) (int, error) {
-	url := fmt.Sprintf("https://api.agify.io?name=%s", url.QueryEscape(fmt.Sprintf("%s %s", name, surname)))
-	jsonMap, err := GetJson(ctx, url)
+// Enricher определяет данные о человеке по имени и фамилии.
+type Enricher interface {
+	Enrich(ctx context.Context, name string, surname string) (*Result, error)
+}
+
+// Chain опрашивает провайдеров параллельно и сливает результаты в порядке
+// списка: поле берется у первого провайдера, который его определил.
+type Chain struct {
+	Enrichers []Enricher
+}
 
-	if err != nil {
-		return 0, err
+func (chain *Chain) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	results := make([]*Result, len(chain.Enrichers))
+	errs := make([]error, len(chain.Enrichers))
+
+	var wg sync.WaitGroup
+	for i, enricher := range chain.Enrichers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = enricher.Enrich(ctx, name, surname)
+		}()
 	}
+	wg.Wait()
 
-	if age, ok := (*jsonMap)["age"].(float64); ok {
-		log.Printf("Getted age: %d for user: %s %s\n", int(age), name, surname)
-		return int(age), nil
-	} else {
-		return 0, fmt.Errorf("Age wrong result format")
+	result := &Result{}
+	for _, item := range results {
+		result.Merge(item)
 	}
+
+	return result, errors.Join(errs...)
 }
 
-func GetNationalize(ctx context.Context, name string, surname string) (string, error) {
-	url := fmt.Sprintf("https://api.nationalize.io?name=%s", url.QueryEscape(fmt.Sprintf("%s %s", name, surname)))
-	jsonMap, err := GetJson(ctx, url)
+// Fallback опрашивает Fallback, только если Primary вернул ошибку. Ответ
+// Fallback заполняет поля, которые Primary не определил, и при успехе
+// заменяет ошибку Primary.
+type Fallback struct {
+	Primary  Enricher
+	Fallback Enricher
+}
 
-	if err != nil {
-		return "", err
+func (fallback *Fallback) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	result, err := fallback.Primary.Enrich(ctx, name, surname)
+	if err == nil {
+		return result, nil
 	}
 
-	countryList, ok := (*jsonMap)["country"].([]interface{})
-	if !ok {
-		return "", fmt.Errorf("Nationalize wrong result format")
+	other, fallbackErr := fallback.Fallback.Enrich(ctx, name, surname)
+	if fallbackErr != nil {
+		return result, errors.Join(err, fallbackErr)
 	}
 
-	itemMap, ok := countryList[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("Nationalize wrong result format")
+	log.Printf("Using fallback enrichment for user: %s %s, primary error: %v\n", name, surname, err)
+
+	if result == nil {
+		result = &Result{}
 	}
+	result.Merge(other)
+	return result, nil
+}
+
+// Confident отбрасывает догадки Enricher с низкой достоверностью, см. Result.Filter.
+type Confident struct {
+	Enricher      Enricher
+	MinConfidence config.MinConfidence
+}
 
-	if nationalize, ok := itemMap["country_id"].(string); ok {
-		log.Printf("Getted nationalize: %s for user: %s %s\n", nationalize, name, surname)
-		return nationalize, nil
-	} else {
-		return "", fmt.Errorf("Nationalize wrong result format")
+func (confident *Confident) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	result, err := confident.Enricher.Enrich(ctx, name, surname)
+	if result != nil {
+		result.Filter(&confident.MinConfidence)
 	}
+	return result, err
 }
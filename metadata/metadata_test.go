@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func newStubServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agify", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "Ivan Petrov" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"count": 10, "name": "Ivan Petrov", "age": 42}`))
+	})
+	mux.HandleFunc("/genderize", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"count": 10, "name": "Ivan Petrov", "gender": "male", "probability": 0.99}`))
+	})
+	mux.HandleFunc("/nationalize", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"count": 10, "name": "Ivan Petrov", "country": [{"country_id": "UA", "probability": 0.15}, {"country_id": "RU", "probability": 0.8}]}`))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewChain(t *testing.T) {
+	server := newStubServer(t)
+
+	enricher, err := New(&config.Enrichment{Providers: []config.Provider{
+		{Name: "agify", BaseURL: server.URL + "/agify"},
+		{Name: "genderize", BaseURL: server.URL + "/genderize"},
+		{Name: "nationalize", BaseURL: server.URL + "/nationalize"},
+	}}, nil)
+	require.NoError(t, err)
+
+	result, err := enricher.Enrich(context.Background(), "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, &Result{Age: 42, AgeCount: 10, Gender: "male", GenderProbability: 0.99, Nationalize: "RU",
+		Nationalities: []schemas.Nationality{{Country: "RU", Probability: 0.8}, {Country: "UA", Probability: 0.15}}}, result)
+}
+
+func TestNewChainDisabledAndUnknown(t *testing.T) {
+	server := newStubServer(t)
+
+	enricher, err := New(&config.Enrichment{Providers: []config.Provider{
+		{Name: "agify", BaseURL: server.URL + "/agify"},
+		{Name: "genderize", BaseURL: server.URL + "/broken", Disabled: true},
+	}}, nil)
+	require.NoError(t, err)
+
+	result, err := enricher.Enrich(context.Background(), "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, &Result{Age: 42, AgeCount: 10}, result)
+
+	_, err = New(&config.Enrichment{Providers: []config.Provider{{Name: "unknown"}}}, nil)
+	require.Error(t, err)
+}
+
+func TestChainPartialFailure(t *testing.T) {
+	server := newStubServer(t)
+
+	client := NewClient(&config.HTTPClient{})
+	chain := &Chain{Enrichers: []Enricher{
+		&Agify{BaseURL: server.URL + "/agify", Client: client},
+		&Genderize{BaseURL: server.URL + "/broken", Client: client},
+	}}
+
+	result, err := chain.Enrich(context.Background(), "Ivan", "Petrov")
+	require.Error(t, err)
+	require.Equal(t, 42, result.Age)
+}
+
+func TestMinConfidence(t *testing.T) {
+	server := newStubServer(t)
+
+	enricher, err := New(&config.Enrichment{
+		Providers: []config.Provider{
+			{Name: "agify", BaseURL: server.URL + "/agify"},
+			{Name: "genderize", BaseURL: server.URL + "/genderize"},
+			{Name: "nationalize", BaseURL: server.URL + "/nationalize"},
+		},
+		MinConfidence: config.MinConfidence{Gender: 0.9, Nationality: 0.9, AgeCount: 20},
+	}, nil)
+	require.NoError(t, err)
+
+	result, err := enricher.Enrich(context.Background(), "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, "male", result.Gender)
+	require.Equal(t, "", result.Nationalize)
+	require.Equal(t, 0, result.Age)
+	require.Equal(t, 10, result.AgeCount)
+	require.Len(t, result.Nationalities, 2)
+}
+
+func TestUnknownName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"count": 0, "name": "Xyz", "age": null, "gender": null, "probability": 0, "country": []}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.HTTPClient{})
+	for _, enricher := range []Enricher{
+		&Agify{BaseURL: server.URL, Client: client},
+		&Genderize{BaseURL: server.URL, Client: client},
+		&Nationalize{BaseURL: server.URL, Client: client},
+	} {
+		result, err := enricher.Enrich(context.Background(), "Xyz", "Xyz")
+		require.NoError(t, err)
+		require.True(t, result.Empty())
+	}
+}
@@ -0,0 +1,244 @@
+package metadata
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func init() {
+	Register("offline", func(config *config.Provider, client *Client) (Enricher, error) {
+		if config.Path == "" {
+			return nil, fmt.Errorf("path to dataset is required")
+		}
+		return LoadOffline(config.Path)
+	})
+}
+
+// DatasetEntry статистика по одному имени в наборе данных Offline. В CSV
+// страны записываются одной колонкой вида RU:0.8;UA:0.1.
+type DatasetEntry struct {
+	Name              string                `json:"name"`
+	Gender            string                `json:"gender"`
+	GenderProbability float64               `json:"gender_probability"`
+	Age               int                   `json:"age"`
+	AgeCount          int                   `json:"age_count"`
+	Countries         []schemas.Nationality `json:"countries"`
+}
+
+// Offline определяет данные по имени из локального набора данных, без
+// запросов в сеть. Имена сравниваются без учета регистра, диакритики и
+// способа транслитерации, см. NameKey.
+type Offline struct {
+	entries map[string]*Result
+}
+
+// LoadOffline загружает набор данных из CSV или JSON файла, формат
+// определяется по расширению.
+func LoadOffline(path string) (*Offline, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error open dataset: %w", err)
+	}
+	defer file.Close()
+
+	var entries []DatasetEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		entries, err = readDatasetCSV(file)
+	case ".json":
+		err = json.NewDecoder(file).Decode(&entries)
+	default:
+		return nil, fmt.Errorf("Unknown dataset format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error read dataset %s: %w", path, err)
+	}
+
+	return NewOffline(entries), nil
+}
+
+func NewOffline(entries []DatasetEntry) *Offline {
+	offline := &Offline{entries: make(map[string]*Result, len(entries))}
+
+	for _, entry := range entries {
+		result := &Result{
+			Age:               entry.Age,
+			AgeCount:          entry.AgeCount,
+			Gender:            entry.Gender,
+			GenderProbability: entry.GenderProbability,
+			Nationalities:     append([]schemas.Nationality(nil), entry.Countries...),
+		}
+
+		sort.SliceStable(result.Nationalities, func(i, j int) bool {
+			return result.Nationalities[i].Probability > result.Nationalities[j].Probability
+		})
+		if len(result.Nationalities) > 0 {
+			result.Nationalize = result.Nationalities[0].Country
+		}
+
+		offline.entries[NameKey(entry.Name)] = result
+	}
+
+	return offline
+}
+
+// Enrich ищет только по имени. Неизвестное имя не ошибка, а пустой результат.
+func (offline *Offline) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	result, ok := offline.entries[NameKey(name)]
+	if !ok {
+		return &Result{}, nil
+	}
+
+	copied := *result
+	return &copied, nil
+}
+
+func readDatasetCSV(reader io.Reader) ([]DatasetEntry, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("column name is required")
+	}
+
+	var entries []DatasetEntry
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := DatasetEntry{Name: value("name"), Gender: value("gender")}
+
+		if entry.GenderProbability, err = parseFloat(value("gender_probability")); err != nil {
+			return nil, fmt.Errorf("line %d: wrong gender_probability: %w", line, err)
+		}
+		if entry.Age, err = parseInt(value("age")); err != nil {
+			return nil, fmt.Errorf("line %d: wrong age: %w", line, err)
+		}
+		if entry.AgeCount, err = parseInt(value("age_count")); err != nil {
+			return nil, fmt.Errorf("line %d: wrong age_count: %w", line, err)
+		}
+		if entry.Countries, err = parseCountries(value("countries")); err != nil {
+			return nil, fmt.Errorf("line %d: wrong countries: %w", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func parseFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func parseCountries(value string) ([]schemas.Nationality, error) {
+	var countries []schemas.Nationality
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		country, probability, _ := strings.Cut(item, ":")
+		parsed, err := parseFloat(probability)
+		if err != nil {
+			return nil, err
+		}
+		countries = append(countries, schemas.Nationality{Country: strings.ToUpper(country), Probability: parsed})
+	}
+	return countries, nil
+}
+
+// cyrillicToLatin транслитерация, близкая к принятой в загранпаспортах.
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia", 'і': "i", 'ї': "i", 'є': "e", 'ґ': "g",
+}
+
+// NameKey приводит имя к ключу поиска: нижний регистр, без диакритики,
+// кириллица в латинице. Затем сглаживаются различия разных систем
+// транслитерации: j и y считаются i, x считается ks, а повторы букв
+// схлопываются. Так Юлия, Yuliya и Julia дают один ключ.
+func NameKey(name string) string {
+	var latin strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(strings.TrimSpace(name))) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Диакритика, в том числе краткая у й после NFD.
+		case unicode.Is(unicode.Cyrillic, r):
+			latin.WriteString(cyrillicToLatin[r])
+		case unicode.IsLetter(r):
+			latin.WriteRune(r)
+		}
+	}
+
+	var key strings.Builder
+	var previous rune
+	for _, r := range latin.String() {
+		switch r {
+		case 'j', 'y':
+			r = 'i'
+		case 'x':
+			if previous != 'k' {
+				key.WriteRune('k')
+			}
+			previous = 'k'
+			r = 's'
+		}
+		if r != previous {
+			key.WriteRune(r)
+		}
+		previous = r
+	}
+
+	return key.String()
+}
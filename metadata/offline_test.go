@@ -0,0 +1,80 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func TestNameKey(t *testing.T) {
+	same := [][]string{
+		{"Ivan", "ivan", "ИВАН", "Иван"},
+		{"Yuliya", "Юлия", "Julia", "Iuliia"},
+		{"Dmitry", "Дмитрий", "Dmitriy"},
+		{"Alexei", "Алексей", "Aleksey"},
+		{"Natalia", "Наталья", "Natalya"},
+		{"José", "Jose", "JOSE"},
+	}
+	for _, names := range same {
+		for _, name := range names[1:] {
+			require.Equal(t, NameKey(names[0]), NameKey(name), name)
+		}
+	}
+
+	require.NotEqual(t, NameKey("Ivan"), NameKey("Ivana"))
+}
+
+func TestOfflineCSV(t *testing.T) {
+	offline, err := LoadOffline("testdata/names.csv")
+	require.NoError(t, err)
+
+	result, err := offline.Enrich(context.Background(), "Иван", "Петров")
+	require.NoError(t, err)
+	require.Equal(t, &Result{Age: 45, AgeCount: 12000, Gender: "male", GenderProbability: 0.99, Nationalize: "RU",
+		Nationalities: []schemas.Nationality{{Country: "RU", Probability: 0.72}, {Country: "UA", Probability: 0.08},
+			{Country: "BG", Probability: 0.05}}}, result)
+
+	result, err = offline.Enrich(context.Background(), "Unknown", "Petrov")
+	require.NoError(t, err)
+	require.True(t, result.Empty())
+}
+
+func TestOfflineJSON(t *testing.T) {
+	offline, err := LoadOffline("testdata/names.json")
+	require.NoError(t, err)
+
+	result, err := offline.Enrich(context.Background(), "anna", "Petrova")
+	require.NoError(t, err)
+	require.Equal(t, "female", result.Gender)
+	require.Equal(t, "RU", result.Nationalize)
+
+	_, err = LoadOffline("testdata/missing.csv")
+	require.Error(t, err)
+}
+
+func TestOfflineFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	enricher, err := New(&config.Enrichment{Providers: []config.Provider{
+		{Name: "genderize", BaseURL: server.URL},
+		{Name: "offline", Path: "testdata/names.csv", Fallback: true},
+	}}, nil)
+	require.NoError(t, err)
+
+	result, err := enricher.Enrich(context.Background(), "Ivan", "Petrov")
+	require.NoError(t, err)
+	require.Equal(t, "male", result.Gender)
+	require.Equal(t, 45, result.Age)
+
+	_, err = New(&config.Enrichment{Providers: []config.Provider{{Name: "offline"}}}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,216 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func init() {
+	Register("agify", func(config *config.Provider, client *Client) (Enricher, error) {
+		return &Agify{BaseURL: baseURL(config, "https://api.agify.io"), Client: client}, nil
+	})
+	Register("genderize", func(config *config.Provider, client *Client) (Enricher, error) {
+		return &Genderize{BaseURL: baseURL(config, "https://api.genderize.io"), Client: client}, nil
+	})
+	Register("nationalize", func(config *config.Provider, client *Client) (Enricher, error) {
+		return &Nationalize{BaseURL: baseURL(config, "https://api.nationalize.io"), Client: client}, nil
+	})
+}
+
+func baseURL(config *config.Provider, defaultURL string) string {
+	if config.BaseURL != "" {
+		return config.BaseURL
+	}
+	return defaultURL
+}
+
+func nameURL(baseURL string, name string, surname string) string {
+	return fmt.Sprintf("%s?name=%s", baseURL, url.QueryEscape(fmt.Sprintf("%s %s", name, surname)))
+}
+
+// batchURL запрос для нескольких имен сразу, ответом будет массив в том же порядке.
+func batchURL(baseURL string, names []Name) string {
+	query := url.Values{}
+	for _, name := range names {
+		query.Add("name[]", fmt.Sprintf("%s %s", name.Name, name.Surname))
+	}
+	return baseURL + "?" + query.Encode()
+}
+
+// Genderize определяет пол через genderize.io.
+type Genderize struct {
+	BaseURL string
+	Client  *Client
+}
+
+type genderizeResponse struct {
+	Gender      *string `json:"gender"`
+	Probability float64 `json:"probability"`
+}
+
+func (response *genderizeResponse) result(name string, surname string) *Result {
+	// null значит, что имя провайдеру неизвестно.
+	if response.Gender == nil {
+		log.Printf("Gender is unknown for user: %s %s\n", name, surname)
+		return &Result{}
+	}
+
+	log.Printf("Getted gender: %s (%.2f) for user: %s %s\n", *response.Gender, response.Probability, name, surname)
+	return &Result{Gender: *response.Gender, GenderProbability: response.Probability}
+}
+
+func (provider *Genderize) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	var response genderizeResponse
+	err := provider.Client.GetJson(ctx, "genderize", nameURL(provider.BaseURL, name, surname), &response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return response.result(name, surname), nil
+}
+
+func (provider *Genderize) EnrichBatch(ctx context.Context, names []Name) ([]*Result, error) {
+	var responses []genderizeResponse
+	err := provider.Client.GetJson(ctx, "genderize", batchURL(provider.BaseURL, names), &responses)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responses) != len(names) {
+		return nil, fmt.Errorf("Wrong batch result size: %d for %d names", len(responses), len(names))
+	}
+
+	results := make([]*Result, len(responses))
+	for i := range responses {
+		results[i] = responses[i].result(names[i].Name, names[i].Surname)
+	}
+	return results, nil
+}
+
+// Agify определяет возраст через agify.io.
+type Agify struct {
+	BaseURL string
+	Client  *Client
+}
+
+type agifyResponse struct {
+	Age   *int `json:"age"`
+	Count int  `json:"count"`
+}
+
+func (response *agifyResponse) result(name string, surname string) *Result {
+	if response.Age == nil {
+		log.Printf("Age is unknown for user: %s %s\n", name, surname)
+		return &Result{}
+	}
+
+	log.Printf("Getted age: %d (%d samples) for user: %s %s\n", *response.Age, response.Count, name, surname)
+	return &Result{Age: *response.Age, AgeCount: response.Count}
+}
+
+func (provider *Agify) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	var response agifyResponse
+	err := provider.Client.GetJson(ctx, "agify", nameURL(provider.BaseURL, name, surname), &response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return response.result(name, surname), nil
+}
+
+func (provider *Agify) EnrichBatch(ctx context.Context, names []Name) ([]*Result, error) {
+	var responses []agifyResponse
+	err := provider.Client.GetJson(ctx, "agify", batchURL(provider.BaseURL, names), &responses)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responses) != len(names) {
+		return nil, fmt.Errorf("Wrong batch result size: %d for %d names", len(responses), len(names))
+	}
+
+	results := make([]*Result, len(responses))
+	for i := range responses {
+		results[i] = responses[i].result(names[i].Name, names[i].Surname)
+	}
+	return results, nil
+}
+
+// Nationalize определяет национальность через nationalize.io. Возвращает все
+// варианты, самый вероятный становится Nationalize.
+type Nationalize struct {
+	BaseURL string
+	Client  *Client
+}
+
+type nationalizeResponse struct {
+	Country []struct {
+		CountryID   string  `json:"country_id"`
+		Probability float64 `json:"probability"`
+	} `json:"country"`
+}
+
+func (response *nationalizeResponse) result(name string, surname string) (*Result, error) {
+	result := &Result{}
+	for _, item := range response.Country {
+		if item.CountryID == "" {
+			return nil, fmt.Errorf("Nationalize wrong result format")
+		}
+		result.Nationalities = append(result.Nationalities, schemas.Nationality{Country: item.CountryID, Probability: item.Probability})
+	}
+
+	if len(result.Nationalities) == 0 {
+		log.Printf("Nationalize is unknown for user: %s %s\n", name, surname)
+		return result, nil
+	}
+
+	sort.SliceStable(result.Nationalities, func(i, j int) bool {
+		return result.Nationalities[i].Probability > result.Nationalities[j].Probability
+	})
+	result.Nationalize = result.Nationalities[0].Country
+
+	log.Printf("Getted nationalize: %s (%.2f) for user: %s %s\n", result.Nationalize, result.Nationalities[0].Probability, name, surname)
+	return result, nil
+}
+
+func (provider *Nationalize) Enrich(ctx context.Context, name string, surname string) (*Result, error) {
+	var response nationalizeResponse
+	err := provider.Client.GetJson(ctx, "nationalize", nameURL(provider.BaseURL, name, surname), &response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return response.result(name, surname)
+}
+
+func (provider *Nationalize) EnrichBatch(ctx context.Context, names []Name) ([]*Result, error) {
+	var responses []nationalizeResponse
+	err := provider.Client.GetJson(ctx, "nationalize", batchURL(provider.BaseURL, names), &responses)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responses) != len(names) {
+		return nil, fmt.Errorf("Wrong batch result size: %d for %d names", len(responses), len(names))
+	}
+
+	results := make([]*Result, len(responses))
+	for i := range responses {
+		if results[i], err = responses[i].result(names[i].Name, names[i].Surname); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
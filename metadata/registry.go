@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+)
+
+// Factory создает провайдера по его настройкам из config.yaml.
+// Сетевые провайдеры должны выполнять запросы через общий client.
+type Factory func(config *config.Provider, client *Client) (Enricher, error)
+
+const defaultBatchWindow = 50 * time.Millisecond
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register добавляет тип провайдера, который можно указать в enrichment.providers.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("metadata: provider %s registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// DefaultProviders используются, если в конфиге не указано ни одного провайдера.
+var DefaultProviders = []config.Provider{
+	{Name: "agify"},
+	{Name: "genderize"},
+	{Name: "nationalize"},
+}
+
+// New создает Chain из включенных провайдеров в порядке конфига. Провайдеры
+// с fallback собираются в отдельный Chain, см. Fallback. Провайдеры,
+// реализующие BatchEnricher, оборачиваются в Batcher, если включено
+// объединение запросов. Если в конфиге включен кэш, каждый провайдер
+// оборачивается в Cached перед Batcher, что бы найденные в кэше имена не
+// попадали в пакеты. persistent дополнительный кэш за LRU, может быть nil.
+// Пороги min_confidence применяются к объединенному результату, поэтому в
+// кэше хранятся ответы провайдеров как есть.
+func New(config *config.Enrichment, persistent Cache) (Enricher, error) {
+	providers := config.Providers
+	if len(providers) == 0 {
+		providers = DefaultProviders
+	}
+
+	cache := newCache(&config.Cache, persistent)
+	client := NewClient(&config.HTTP)
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	chain := &Chain{}
+	fallback := &Chain{}
+	for i := range providers {
+		provider := &providers[i]
+		if provider.Disabled {
+			log.Printf("Enrichment provider %s is disabled", provider.Name)
+			continue
+		}
+
+		factory, ok := registry[provider.Name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown enrichment provider: %s", provider.Name)
+		}
+
+		enricher, err := factory(provider, client)
+		if err != nil {
+			return nil, fmt.Errorf("Error create enrichment provider %s: %w", provider.Name, err)
+		}
+
+		if batchEnricher, ok := enricher.(BatchEnricher); ok && config.Batch.Size > 1 {
+			enricher = NewBatcher(batchEnricher, config.Batch.Size, batchWindow(&config.Batch))
+		}
+
+		if cache != nil {
+			enricher = &Cached{Enricher: enricher, Provider: provider.Name, Cache: cache}
+		}
+		if provider.Fallback {
+			fallback.Enrichers = append(fallback.Enrichers, enricher)
+		} else {
+			chain.Enrichers = append(chain.Enrichers, enricher)
+		}
+	}
+
+	var enricher Enricher = chain
+	if len(fallback.Enrichers) > 0 {
+		enricher = &Fallback{Primary: chain, Fallback: fallback}
+	}
+
+	return &Confident{Enricher: enricher, MinConfidence: config.MinConfidence}, nil
+}
+
+func batchWindow(config *config.Batch) time.Duration {
+	if config.Window <= 0 {
+		return defaultBatchWindow
+	}
+	return config.Window
+}
+
+func newCache(config *config.Cache, persistent Cache) Cache {
+	var caches []Cache
+	if config.Size > 0 {
+		caches = append(caches, NewLRU(config.Size, config.TTL))
+	}
+	if persistent != nil {
+		caches = append(caches, persistent)
+	}
+
+	switch len(caches) {
+	case 0:
+		return nil
+	case 1:
+		return caches[0]
+	default:
+		return &Tiered{Caches: caches}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// runMigrate обрабатывает команду:
+//
+//	migrate status   - текущая версия и непримененные миграции
+//	migrate up       - применить все непримененные миграции
+//	migrate down [N] - откатить N последних миграций (по умолчанию 1)
+func runMigrate(ctx context.Context, config *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: migrate status|up|down [N]")
+	}
+
+	migrator, err := storage.OpenMigrator(ctx, &config.Storage)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "status":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Current version: %d\n", version)
+		for _, migration := range pending {
+			fmt.Printf("Pending: %d_%s\n", migration.Version, migration.Name)
+		}
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied migrations: %d\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("Wrong number of steps: %s", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted migrations: %d\n", reverted)
+	default:
+		return fmt.Errorf("Unknown migrate command: %s", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,334 @@
+// Package patch применяет к JSON документам изменения в форматах
+// JSON Merge Patch (RFC 7396) и JSON Patch (RFC 6902).
+//
+// Документы в том виде, в котором их возвращает json.Unmarshal в interface{}:
+// map[string]interface{}, []interface{}, string, float64, bool и nil.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalid неверная операция или путь.
+	ErrInvalid = errors.New("invalid patch")
+	// ErrPath пути операции нет в документе.
+	ErrPath = errors.New("path not found")
+	// ErrTestFailed значение не совпало в операции test.
+	ErrTestFailed = errors.New("test failed")
+)
+
+// Merge применяет merge patch. Объекты объединяются рекурсивно, null удаляет
+// поле, остальные значения, в том числе массивы, заменяются целиком.
+// Исходный документ не меняется.
+func Merge(doc interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docObject, _ := doc.(map[string]interface{})
+	result := make(map[string]interface{}, len(docObject)+len(patchObject))
+	for key, value := range docObject {
+		result[key] = value
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = Merge(result[key], value)
+	}
+	return result
+}
+
+// Operation операция JSON Patch. Value nil, если поле value не передано,
+// и json.RawMessage("null"), если передан null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply выполняет операции по порядку над копией документа. Если хотя бы одна
+// операция не выполнена, возвращается ошибка, а документ остается прежним.
+func Apply(doc interface{}, operations []Operation) (interface{}, error) {
+	result := deepCopy(doc)
+
+	for i, operation := range operations {
+		var err error
+		if result, err = apply(result, &operation); err != nil {
+			return nil, fmt.Errorf("Operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+	return result, nil
+}
+
+func apply(doc interface{}, operation *Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("Missing value: %w", ErrInvalid)
+		}
+		var value interface{}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, fmt.Errorf("Wrong value: %w", ErrInvalid)
+		}
+
+		switch operation.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "copy" {
+			return add(doc, path, deepCopy(value))
+		}
+
+		if isPrefix(from, path) && len(from) < len(path) {
+			return nil, fmt.Errorf("Move into own child: %w", ErrInvalid)
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("Unknown op %q: %w", operation.Op, ErrInvalid)
+	}
+}
+
+// parsePointer разбирает JSON Pointer (RFC 6901), пустая строка указывает на
+// весь документ.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("Pointer %q must start with /: %w", pointer, ErrInvalid)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// index номер элемента массива длины length. Для добавления допустимы
+// номер length и "-" в значении конца массива.
+func index(token string, length int, forAdd bool) (int, error) {
+	if token == "-" && forAdd {
+		return length, nil
+	}
+	if token == "" || len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("Wrong array index %q: %w", token, ErrInvalid)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("Wrong array index %q: %w", token, ErrInvalid)
+	}
+	if i > length || i == length && !forAdd {
+		return 0, fmt.Errorf("Index %d out of range: %w", i, ErrPath)
+	}
+	return i, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+		}
+	}
+	return doc, nil
+}
+
+// update находит родителя последнего элемента пути и заменяет его результатом
+// change. Массивы при вставке и удалении пересоздаются, поэтому новые значения
+// записываются обратно по всей цепочке.
+func update(doc interface{}, path []string, change func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("Member %q: %w", path[0], ErrPath)
+		}
+		child, err := update(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := index(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("Member %q: %w", path[0], ErrPath)
+	}
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+		}
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("Remove whole document: %w", ErrInvalid)
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+		}
+	})
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+			}
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("Member %q: %w", token, ErrPath)
+		}
+	})
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(node))
+		for key, item := range node {
+			result[key] = deepCopy(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(node))
+		for i, item := range node {
+			result[i] = deepCopy(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
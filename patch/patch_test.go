@@ -0,0 +1,114 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, data string) interface{} {
+	var value interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &value))
+	return value
+}
+
+func TestMerge(t *testing.T) {
+	// Примеры из приложения A RFC 7396.
+	cases := []struct{ doc, patch, result string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, c := range cases {
+		doc := decode(t, c.doc)
+		result, err := json.Marshal(Merge(doc, decode(t, c.patch)))
+		require.NoError(t, err)
+		require.JSONEq(t, c.result, string(result), c)
+		require.Equal(t, decode(t, c.doc), doc, "source document must not change")
+	}
+}
+
+func TestApply(t *testing.T) {
+	// Примеры из приложения A RFC 6902.
+	cases := []struct{ doc, patch, result string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"foo":"bar"}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":"bar","baz":"bar"}`},
+	}
+
+	for _, c := range cases {
+		var operations []Operation
+		require.NoError(t, json.Unmarshal([]byte(c.patch), &operations))
+
+		doc := decode(t, c.doc)
+		patched, err := Apply(doc, operations)
+		require.NoError(t, err, c)
+
+		result, err := json.Marshal(patched)
+		require.NoError(t, err)
+		require.JSONEq(t, c.result, string(result), c)
+		require.Equal(t, decode(t, c.doc), doc, "source document must not change")
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	cases := []struct {
+		doc, patch string
+		err        error
+	}{
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ErrTestFailed},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ErrPath},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ErrPath},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, ErrPath},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, ErrPath},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`, ErrInvalid},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, ErrInvalid},
+		{`{"foo":"bar"}`, `[{"op":"frobnicate","path":"/foo"}]`, ErrInvalid},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"baz","value":1}]`, ErrInvalid},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, ErrInvalid},
+	}
+
+	for _, c := range cases {
+		var operations []Operation
+		require.NoError(t, json.Unmarshal([]byte(c.patch), &operations))
+
+		_, err := Apply(decode(t, c.doc), operations)
+		require.True(t, errors.Is(err, c.err), "%v: %v", c, err)
+	}
+
+	// Ошибка во второй операции отменяет и первую.
+	doc := decode(t, `{"foo":"bar"}`)
+	_, err := Apply(doc, []Operation{
+		{Op: "add", Path: "/baz", Value: json.RawMessage(`1`)},
+		{Op: "remove", Path: "/missing"},
+	})
+	require.Error(t, err)
+	require.Equal(t, decode(t, `{"foo":"bar"}`), doc)
+}
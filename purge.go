@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// runPurge окончательно удаляет пользователей, удаленных раньше чем
+// storage.deleted_retention назад. Предполагается запуск по расписанию.
+func runPurge(ctx context.Context, config *config.Config) error {
+	if config.Storage.DeletedRetention <= 0 {
+		return fmt.Errorf("storage.deleted_retention must be positive")
+	}
+
+	storage, err := storage.Open(ctx, &config.Storage)
+	if err != nil {
+		return err
+	}
+
+	purged, err := storage.PurgeDeleted(ctx, time.Now().Add(-config.Storage.DeletedRetention))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Purged users: %d\n", purged)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+	"github.com/nkhamm-spb/red_soft_test/worker"
+)
+
+// runReenrich ставит существующих пользователей в очередь повторного
+// обогащения, задания выполняет запущенный сервис:
+//
+//	reenrich [-empty-fields] [-nationalize RU] [-created-before 2024-01-01] [-rate 5] [-run name]
+//
+// Без фильтров выбираются все пользователи. Прерванный запуск продолжается
+// с места остановки при повторе с теми же фильтрами или тем же -run.
+func runReenrich(ctx context.Context, config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("reenrich", flag.ContinueOnError)
+
+	var options worker.ReenrichOptions
+	var createdBefore string
+	flags.BoolVar(&options.Filter.EmptyFields, "empty-fields", false, "only users with empty age, gender or nationalize")
+	flags.StringVar(&options.Filter.Nationalize, "nationalize", "", "only users with this nationalize")
+	flags.StringVar(&createdBefore, "created-before", "", "only users created before this date, YYYY-MM-DD or RFC 3339")
+	flags.Float64Var(&options.Rate, "rate", 0, "users per second, default from config")
+	flags.StringVar(&options.Run, "run", "", "checkpoint name, default is made from filters")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if createdBefore != "" {
+		date, err := parseDate(createdBefore)
+		if err != nil {
+			return fmt.Errorf("Wrong created-before: %w", err)
+		}
+		options.Filter.CreatedBefore = &date
+	}
+
+	storage, err := storage.Open(ctx, &config.Storage)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	enqueued, err := worker.NewReenricher(storage, &config.Enrichment.Reenrich).Run(ctx, options)
+	fmt.Printf("Enqueued users: %d\n", enqueued)
+	return err
+}
+
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
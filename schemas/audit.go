@@ -0,0 +1,37 @@
+package schemas
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Действия, после которых в историю пользователя пишется запись.
+const (
+	AuditCreate   = "create"
+	AuditEdit     = "edit"
+	AuditDelete   = "delete"
+	AuditRestore  = "restore"
+	AuditEnrich   = "enrich"
+	AuditReenrich = "reenrich"
+	AuditPurge    = "purge"
+	// Состояние пользователя на момент включения истории.
+	AuditBaseline = "baseline"
+)
+
+// AuditRecord неизменяемая запись истории пользователя. Changes содержит
+// только измененные поля по их json именам в User.
+type AuditRecord struct {
+	ID        int64                  `json:"id"`
+	UserID    int                    `json:"user_id"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"request_id,omitempty"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange значение поля до и после изменения, null если поля не было.
+type FieldChange struct {
+	Before json.RawMessage `json:"before" swaggertype:"object"`
+	After  json.RawMessage `json:"after" swaggertype:"object"`
+}
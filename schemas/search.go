@@ -0,0 +1,18 @@
+package schemas
+
+// SearchResult найденный пользователь. Score от 0 до 1, Matches совпавшие
+// поля от лучшего совпадения к худшему.
+type SearchResult struct {
+	User    User          `json:"user"`
+	Score   float64       `json:"score"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// SearchMatch совпавшее поле: name, surname или emails. В Highlight
+// совпавшие слова значения обернуты в <mark>, остальной текст экранирован как HTML.
+type SearchMatch struct {
+	Field     string  `json:"field"`
+	Value     string  `json:"value"`
+	Highlight string  `json:"highlight"`
+	Score     float64 `json:"score"`
+}
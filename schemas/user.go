@@ -1,5 +1,7 @@
 package schemas
 
+import "time"
+
 type User struct {
 	ID          int      `json:"id"`
 	Name        string   `json:"name"`
@@ -8,19 +10,103 @@ type User struct {
 	Age         int      `json:"age"`
 	Nationalize string   `json:"nationalize"`
 	Emails      []string `json:"emails"`
+
+	// Достоверность данных от провайдеров, 0 если неизвестна.
+	GenderProbability float64       `json:"gender_probability,omitempty"`
+	AgeCount          int           `json:"age_count,omitempty"`
+	Nationalities     []Nationality `json:"nationalities,omitempty"`
+
+	// EnrichmentStatus одно из значений Enrichment*.
+	EnrichmentStatus string       `json:"enrichment_status"`
+	Sources          FieldSources `json:"sources"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// Version увеличивается при каждом изменении, отдается как ETag.
+	Version int `json:"version"`
+}
+
+// FieldSources откуда взято значение поля: SourceEnriched или SourceManual.
+// Пусто, если поле еще не заполнялось.
+type FieldSources struct {
+	Age         string `json:"age,omitempty"`
+	Gender      string `json:"gender,omitempty"`
+	Nationalize string `json:"nationalize,omitempty"`
 }
 
+const (
+	// Значение получено от провайдеров и может быть обновлено повторным обогащением.
+	SourceEnriched = "enriched"
+	// Значение задано через редактирование, обогащение его не меняет.
+	SourceManual = "manual"
+)
+
+// Nationality вариант национальности с вероятностью от 0 до 1.
+type Nationality struct {
+	Country     string  `json:"country"`
+	Probability float64 `json:"probability"`
+}
+
+// Статусы заполнения возраста, пола и национальности пользователя.
+const (
+	// Данные еще запрашиваются у провайдеров.
+	EnrichmentPending = "pending"
+	// Все провайдеры ответили.
+	EnrichmentComplete = "complete"
+	// Часть провайдеров так и не ответила, заполнены не все поля.
+	EnrichmentPartial = "partial"
+	// Ни одно поле заполнить не удалось.
+	EnrichmentFailed = "failed"
+)
+
 type NewUser struct {
-	Name    string   `json:"name"`
-	Surname string   `json:"surname"`
-	Emails  []string `json:"emails"`
+	Name    string   `json:"name" validate:"required,max=100,name"`
+	Surname string   `json:"surname" validate:"required,max=100,name"`
+	Emails  []string `json:"emails" validate:"max=10,unique,dive,max=254,email"`
 }
 
+// EditUser проверяется частично: правила применяются только к переданным полям.
 type EditUser struct {
-	Name        string   `json:"name"`
-	Surname     string   `json:"surname"`
-	Gender      string   `json:"gender"`
-	Age         int      `json:"age"`
-	Nationalize string   `json:"nationalize"`
-	Emails      []string `json:"emails"`
+	Name        string   `json:"name" validate:"required,max=100,name"`
+	Surname     string   `json:"surname" validate:"required,max=100,name"`
+	Gender      string   `json:"gender" validate:"omitempty,oneof=male female"`
+	Age         int      `json:"age" validate:"min=0,max=150"`
+	Nationalize string   `json:"nationalize" validate:"omitempty,iso3166"`
+	Emails      []string `json:"emails" validate:"max=10,unique,dive,max=254,email"`
+}
+
+// UserPatch изменения пользователя для Storage.EditUser. nil поля не меняются,
+// Emails со ссылкой на пустой список удаляет все почты.
+type UserPatch struct {
+	Name        *string
+	Surname     *string
+	Gender      *string
+	Age         *int
+	Nationalize *string
+	Emails      *[]string
+}
+
+// Empty true, если patch ничего не меняет.
+func (patch *UserPatch) Empty() bool {
+	return *patch == UserPatch{}
+}
+
+// UserPage страница списка пользователей. NextCursor пустой на последней странице.
+type UserPage struct {
+	Items      []User `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// Reenrich запрос повторного обогащения. Фильтры объединяются через И,
+// без фильтров выбираются все пользователи.
+type Reenrich struct {
+	EmptyFields   bool       `json:"empty_fields"`
+	Nationalize   string     `json:"nationalize" validate:"omitempty,iso3166"`
+	CreatedBefore *time.Time `json:"created_before"`
+	// Пользователей в секунду, 0 значение из конфига.
+	Rate float64 `json:"rate"`
+	// Имя запуска для продолжения с контрольной точки.
+	Run string `json:"run" validate:"max=100"`
 }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FindAPIKey возвращает имя действующего ключа API по sha256 ключа.
+func (storage *Storage) FindAPIKey(ctx context.Context, hash string) (string, error) {
+	var name string
+	err := storage.db.QueryRowContext(ctx,
+		`SELECT name FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL;`,
+		hash).Scan(&name)
+	if err != nil {
+		return "", wrapError("Error query", err)
+	}
+
+	return name, nil
+}
+
+// CreateAPIKey сохраняет sha256 нового ключа. Имя должно быть новым, даже
+// если прежний ключ с этим именем отозван.
+func (storage *Storage) CreateAPIKey(ctx context.Context, name string, hash string) error {
+	_, err := storage.db.ExecContext(ctx,
+		`INSERT INTO api_keys (name, key_hash) VALUES ($1, $2);`,
+		name, hash)
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	return nil
+}
+
+func (storage *Storage) RevokeAPIKey(ctx context.Context, name string) error {
+	result, err := storage.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE name = $1 AND revoked_at IS NULL;`,
+		name)
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return wrapError("Error exec", err)
+	} else if affected == 0 {
+		return fmt.Errorf("Api key not found: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+type memoryAPIKey struct {
+	hash      string
+	revokedAt *time.Time
+}
+
+func (memory *Memory) FindAPIKey(ctx context.Context, hash string) (string, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	for name, key := range memory.apiKeys {
+		if key.hash == hash && key.revokedAt == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Api key not found: %w", ErrNotFound)
+}
+
+func (memory *Memory) CreateAPIKey(ctx context.Context, name string, hash string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	for existing, key := range memory.apiKeys {
+		if existing == name || key.hash == hash {
+			return fmt.Errorf("Api key already exists: %w", ErrConflict)
+		}
+	}
+	memory.apiKeys[name] = &memoryAPIKey{hash: hash}
+	return nil
+}
+
+func (memory *Memory) RevokeAPIKey(ctx context.Context, name string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	key, ok := memory.apiKeys[name]
+	if !ok || key.revokedAt != nil {
+		return fmt.Errorf("Api key not found: %w", ErrNotFound)
+	}
+	now := time.Now()
+	key.revokedAt = &now
+	return nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	findQuery := regexp.QuoteMeta(`SELECT name FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL;`)
+	mock.ExpectQuery(findQuery).WithArgs("hash").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("reports"))
+	mock.ExpectQuery(findQuery).WithArgs("other").WillReturnError(sql.ErrNoRows)
+
+	name, err := storage.FindAPIKey(context.Background(), "hash")
+	require.NoError(t, err)
+	require.Equal(t, "reports", name)
+
+	_, err = storage.FindAPIKey(context.Background(), "other")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	revokeQuery := regexp.QuoteMeta(`UPDATE api_keys SET revoked_at = now() WHERE name = $1 AND revoked_at IS NULL;`)
+	mock.ExpectExec(revokeQuery).WithArgs("reports").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(revokeQuery).WithArgs("reports").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, storage.RevokeAPIKey(context.Background(), "reports"))
+	require.True(t, errors.Is(storage.RevokeAPIKey(context.Background(), "reports"), ErrNotFound))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
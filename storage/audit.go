@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// Автор изменений, сделанных не из запроса, например фоновым обогащением.
+const systemActor = "system"
+
+type auditKey struct{}
+
+// AuditInfo кто и в каком запросе меняет пользователя, попадает в историю.
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+}
+
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditKey{}, info)
+}
+
+func auditInfo(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditKey{}).(AuditInfo)
+	if info.Actor == "" {
+		info.Actor = systemActor
+	}
+	return info
+}
+
+// diffUsers сравнивает json представления пользователя до и после изменения.
+// nil означает, что пользователя не было.
+func diffUsers(before *schemas.User, after *schemas.User) (map[string]schemas.FieldChange, error) {
+	beforeFields, err := userFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := userFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	null := json.RawMessage("null")
+	changes := make(map[string]schemas.FieldChange)
+	for field, value := range afterFields {
+		if previous, ok := beforeFields[field]; !ok {
+			changes[field] = schemas.FieldChange{Before: null, After: value}
+		} else if !bytes.Equal(previous, value) {
+			changes[field] = schemas.FieldChange{Before: previous, After: value}
+		}
+	}
+	for field, value := range beforeFields {
+		if _, ok := afterFields[field]; !ok {
+			changes[field] = schemas.FieldChange{Before: value, After: null}
+		}
+	}
+
+	return changes, nil
+}
+
+func userFields(user *schemas.User) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if user == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("Error encode user: %w", err)
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("Error encode user: %w", err)
+	}
+
+	for field, value := range fields {
+		if bytes.Equal(value, []byte("null")) {
+			delete(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// replayAudit восстанавливает пользователя, применяя записи истории по
+// порядку. Удаленный к этому моменту пользователь не найден, как и в GetUserById.
+func replayAudit(records []schemas.AuditRecord) (*schemas.User, error) {
+	fields := make(map[string]json.RawMessage)
+	for _, record := range records {
+		for field, change := range record.Changes {
+			if change.After == nil || bytes.Equal(change.After, []byte("null")) {
+				delete(fields, field)
+			} else {
+				fields[field] = change.After
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("Error decode history: %w", err)
+	}
+
+	var user schemas.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("Error decode history: %w", err)
+	}
+	if user.DeletedAt != nil {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	return &user, nil
+}
+
+// execer общая часть *sql.DB и *sql.Tx для записи.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// writeAudit пишет запись истории в той же транзакции, что и само изменение.
+func writeAudit(ctx context.Context, tx execer, action string, before *schemas.User, after *schemas.User) error {
+	changes, err := diffUsers(before, after)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("Error encode changes: %w", err)
+	}
+
+	id := 0
+	if after != nil {
+		id = after.ID
+	} else if before != nil {
+		id = before.ID
+	}
+
+	info := auditInfo(ctx)
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_audit (user_id, action, actor, request_id, changes) VALUES ($1, $2, $3, $4, $5);`,
+		id, action, info.Actor, info.RequestID, data)
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	return nil
+}
+
+// redactAudit разрешает до конца транзакции очистку changes в истории, см.
+// триггер user_audit_immutable. Нужна только окончательному удалению.
+func redactAudit(ctx context.Context, tx execer) error {
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.audit_redact', 'on', true);`); err != nil {
+		return wrapError("Error exec", err)
+	}
+	return nil
+}
+
+// checkPurged возвращает ErrPurged, если пользователь окончательно удален:
+// его история очищена и не должна отдаваться.
+func checkPurged(records []schemas.AuditRecord) error {
+	for _, record := range records {
+		if record.Action == schemas.AuditPurge {
+			return fmt.Errorf("User purged: %w", ErrPurged)
+		}
+	}
+	return nil
+}
+
+const auditColumns = `id, user_id, action, actor, request_id, changed_at, changes`
+
+func queryAudit(ctx context.Context, db querier, query string, args ...interface{}) ([]schemas.AuditRecord, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError("Error query", err)
+	}
+	defer rows.Close()
+
+	records := make([]schemas.AuditRecord, 0)
+	for rows.Next() {
+		var record schemas.AuditRecord
+		var changes []byte
+
+		err := rows.Scan(&record.ID, &record.UserID, &record.Action, &record.Actor, &record.RequestID, &record.ChangedAt, &changes)
+		if err != nil {
+			return nil, wrapError("Error query", err)
+		}
+
+		if err := json.Unmarshal(changes, &record.Changes); err != nil {
+			return nil, fmt.Errorf("Error decode changes: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("Error query", err)
+	}
+
+	return records, nil
+}
+
+// History возвращает историю пользователя от старых записей к новым. После
+// окончательного удаления история очищена и возвращается ErrPurged.
+func (storage *Storage) History(ctx context.Context, id int) ([]schemas.AuditRecord, error) {
+	records, err := queryAudit(ctx, storage.db,
+		`SELECT `+auditColumns+` FROM user_audit WHERE user_id = $1 ORDER BY id;`,
+		id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+	if err := checkPurged(records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetUserAsOf восстанавливает пользователя по истории на момент asOf. Для
+// окончательно удаленного пользователя возвращается ErrPurged при любом asOf.
+func (storage *Storage) GetUserAsOf(ctx context.Context, id int, asOf time.Time) (*schemas.User, error) {
+	records, err := queryAudit(ctx, storage.db,
+		`SELECT `+auditColumns+` FROM user_audit WHERE user_id = $1 ORDER BY id;`,
+		id)
+	if err != nil {
+		return nil, err
+	}
+
+	return replayAsOf(records, asOf)
+}
+
+// replayAsOf восстанавливает пользователя по записям до asOf включительно.
+func replayAsOf(records []schemas.AuditRecord, asOf time.Time) (*schemas.User, error) {
+	if err := checkPurged(records); err != nil {
+		return nil, err
+	}
+
+	var before []schemas.AuditRecord
+	for _, record := range records {
+		if !record.ChangedAt.After(asOf) {
+			before = append(before, record)
+		}
+	}
+	return replayAudit(before)
+}
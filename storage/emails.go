@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"golang.org/x/net/idna"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// EmailConflictError адрес уже принадлежит другому пользователю, в том числе
+// удаленному, но еще не удаленному окончательно.
+type EmailConflictError struct {
+	Email  string
+	UserID int
+}
+
+func (e *EmailConflictError) Error() string {
+	return fmt.Sprintf("Email %s is already used by user %d", e.Email, e.UserID)
+}
+
+func (e *EmailConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// NormalizeEmail приводит адрес к виду, в котором он хранится: без пробелов
+// по краям, домен в нижнем регистре и в IDNA (punycode). Локальная часть не
+// меняется, но адреса сравниваются без учета регистра.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", fmt.Errorf("Wrong email: %s", email)
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.ToLower(email[at+1:]))
+	if err != nil {
+		return "", fmt.Errorf("Wrong email domain: %w", err)
+	}
+
+	return email[:at] + "@" + domain, nil
+}
+
+// normalizeEmails нормализует все адреса пользователя. Адреса, совпавшие
+// только после нормализации, тоже считаются повторами.
+func normalizeEmails(emails []string) ([]string, error) {
+	if len(emails) == 0 {
+		return emails, nil
+	}
+
+	normalized := make([]string, len(emails))
+	seen := make(map[string]bool, len(emails))
+	var fields []FieldError
+
+	for i, email := range emails {
+		var err error
+		if normalized[i], err = NormalizeEmail(email); err != nil {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("emails[%d]", i), Message: "must be a valid email address"})
+			continue
+		}
+
+		key := strings.ToLower(normalized[i])
+		if seen[key] {
+			fields = append(fields, FieldError{Field: "emails", Message: "must not contain duplicates"})
+		}
+		seen[key] = true
+	}
+
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+	return normalized, nil
+}
+
+// checkEmails возвращает *EmailConflictError, если один из адресов уже есть
+// у другого пользователя. Уникальный индекс все равно защищает от гонки, но
+// без владельца в ответе.
+func checkEmails(ctx context.Context, tx *sql.Tx, id int, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+
+	var conflict EmailConflictError
+	err := tx.QueryRowContext(ctx,
+		`SELECT e.email, e.user_id FROM emails e WHERE lower(e.email) = ANY($1) AND e.user_id <> $2 ORDER BY e.id LIMIT 1;`,
+		pq.Array(lowered), id).Scan(&conflict.Email, &conflict.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return wrapError("Error query", err)
+	}
+
+	return &conflict
+}
+
+// insertEmails добавляет все почты одним запросом в порядке emails.
+func insertEmails(ctx context.Context, tx *sql.Tx, id int, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO emails (user_id, email)
+		SELECT $1, e.email FROM unnest($2::text[]) WITH ORDINALITY AS e (email, n) ORDER BY e.n;`,
+		id, pq.Array(emails))
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+	return nil
+}
+
+// GetUserByEmail ищет пользователя по адресу без учета регистра.
+func (storage *Storage) GetUserByEmail(ctx context.Context, email string) (*schemas.User, error) {
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, newValidationError("email", "must be a valid email address")
+	}
+
+	return getUser(ctx, storage.db,
+		`SELECT `+userColumns+` FROM users u
+		WHERE u.id = (SELECT e.user_id FROM emails e WHERE lower(e.email) = lower($1)) AND u.deleted_at IS NULL;`,
+		normalized)
+}
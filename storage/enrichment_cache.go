@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+)
+
+// EnrichmentCache кэш результатов обогащения в таблице enrichment_cache.
+// Ошибки базы только логируются: недоступный кэш не должен ломать обогащение.
+type EnrichmentCache struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewEnrichmentCache возвращает кэш в базе, если хранилище его поддерживает.
+func NewEnrichmentCache(storage StorageInterface, ttl time.Duration) (*EnrichmentCache, bool) {
+	postgres, ok := storage.(*Storage)
+	if !ok {
+		return nil, false
+	}
+	return &EnrichmentCache{db: postgres.db, ttl: ttl}, true
+}
+
+func (cache *EnrichmentCache) Get(ctx context.Context, key string) (*metadata.Result, bool) {
+	var raw []byte
+	err := cache.db.QueryRowContext(ctx,
+		`SELECT result FROM enrichment_cache WHERE key = $1 AND ($2 = 0 OR updated_at > now() - $2 * interval '1 second');`,
+		key, int64(cache.ttl/time.Second)).Scan(&raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error read enrichment cache: %v", err)
+		}
+		return nil, false
+	}
+
+	var result metadata.Result
+	if err := json.Unmarshal(raw, &result); err != nil {
+		log.Printf("Error decode enrichment cache: %v", err)
+		return nil, false
+	}
+
+	return &result, true
+}
+
+func (cache *EnrichmentCache) Set(ctx context.Context, key string, result *metadata.Result) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error encode enrichment cache: %v", err)
+		return
+	}
+
+	_, err = cache.db.ExecContext(ctx,
+		`INSERT INTO enrichment_cache (key, result) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET result = EXCLUDED.result, updated_at = now();`,
+		key, raw)
+	if err != nil {
+		log.Printf("Error write enrichment cache: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// EnrichmentJob задание на заполнение данных пользователя. Attempts учитывает
+// и текущую попытку. Refresh задания повторного обогащения, их ответы
+// берутся от провайдеров мимо кэша, см. metadata.WithRefresh.
+type EnrichmentJob struct {
+	UserID   int
+	Name     string
+	Surname  string
+	Attempts int
+	Refresh  bool
+}
+
+// ClaimEnrichmentJobs забирает до limit готовых к выполнению заданий. Задание
+// не выдается другим обработчикам lease, после этого оно считается брошенным
+// и выдается снова.
+func (storage *Storage) ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]EnrichmentJob, error) {
+	rows, err := storage.db.QueryContext(ctx,
+		`WITH j AS (
+			SELECT user_id FROM enrichment_jobs WHERE run_at <= now()
+			ORDER BY run_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		UPDATE enrichment_jobs SET attempts = enrichment_jobs.attempts + 1, run_at = now() + $2 * interval '1 millisecond'
+		FROM j, users u WHERE enrichment_jobs.user_id = j.user_id AND u.id = j.user_id
+		RETURNING u.id, u.name, u.surname, enrichment_jobs.attempts, enrichment_jobs.refresh;`,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, wrapError("Error query", err)
+	}
+	defer rows.Close()
+
+	var jobs []EnrichmentJob
+	for rows.Next() {
+		var job EnrichmentJob
+		if err := rows.Scan(&job.UserID, &job.Name, &job.Surname, &job.Attempts, &job.Refresh); err != nil {
+			return nil, wrapError("Error query", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("Error query", err)
+	}
+
+	return jobs, nil
+}
+
+// CompleteEnrichment удаляет задание и записывает определенные поля из
+// result. Поля, заданные вручную, не меняются, см. schemas.FieldSources.
+// Список национальностей заменяется целиком.
+func (storage *Storage) CompleteEnrichment(ctx context.Context, id int, result *metadata.Result, status string) error {
+	return storage.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM enrichment_jobs WHERE user_id = $1;`, id); err != nil {
+			return wrapError("Error exec", err)
+		}
+
+		before, err := getUser(ctx, tx,
+			`SELECT `+userColumns+` FROM users u WHERE u.id = $1 FOR UPDATE;`,
+			id)
+		if err != nil {
+			return err
+		}
+
+		// В SET справа видны старые значения строки, поэтому все условия
+		// проверяют источник до обновления. Оценки достоверности пишутся и для
+		// значений ниже порога, как в metadata.Result.Apply.
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users SET
+				age_count = CASE WHEN age_source <> 'manual' AND $3 <> 0 THEN $3 ELSE age_count END,
+				age = CASE WHEN age_source <> 'manual' AND $2 <> 0 THEN $2 ELSE age END,
+				age_source = CASE WHEN age_source <> 'manual' AND $2 <> 0 THEN 'enriched' ELSE age_source END,
+				gender_probability = CASE WHEN gender_source <> 'manual' AND $5 <> 0 THEN $5 ELSE gender_probability END,
+				gender = CASE WHEN gender_source <> 'manual' AND $4 <> '' THEN $4 ELSE gender END,
+				gender_source = CASE WHEN gender_source <> 'manual' AND $4 <> '' THEN 'enriched' ELSE gender_source END,
+				nationalize = CASE WHEN nationalize_source <> 'manual' AND $6 <> '' THEN $6 ELSE nationalize END,
+				nationalize_source = CASE WHEN nationalize_source <> 'manual' AND $6 <> '' THEN 'enriched' ELSE nationalize_source END,
+				enrichment_status = $7,
+				version = version + 1
+			WHERE id = $1;`,
+			id, result.Age, result.AgeCount, result.Gender, result.GenderProbability, result.Nationalize, status)
+		if err != nil {
+			return wrapError("Error exec", err)
+		}
+
+		// Как и в metadata.Result.Apply, пустой ответ или ручная национальность
+		// не стирают сохраненный список.
+		if len(result.Nationalities) > 0 && before.Sources.Nationalize != schemas.SourceManual {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM user_nationalities WHERE user_id = $1;`, id); err != nil {
+				return wrapError("Error exec", err)
+			}
+
+			countries := make([]string, len(result.Nationalities))
+			probabilities := make([]float64, len(result.Nationalities))
+			for i, nationality := range result.Nationalities {
+				countries[i] = nationality.Country
+				probabilities[i] = nationality.Probability
+			}
+
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO user_nationalities (user_id, country, probability, rank)
+				SELECT $1, n.country, n.probability, n.rank
+				FROM unnest($2::text[], $3::float8[]) WITH ORDINALITY AS n (country, probability, rank);`,
+				id, pq.Array(countries), pq.Array(probabilities))
+			if err != nil {
+				return wrapError("Error exec", err)
+			}
+		}
+
+		_, err = auditUser(ctx, tx, schemas.AuditEnrich, before)
+		return err
+	})
+}
+
+// RetryEnrichment откладывает задание на delay.
+func (storage *Storage) RetryEnrichment(ctx context.Context, id int, delay time.Duration, lastError string) error {
+	_, err := storage.db.ExecContext(ctx,
+		`UPDATE enrichment_jobs SET run_at = now() + $2 * interval '1 millisecond', last_error = $3 WHERE user_id = $1;`,
+		id, delay.Milliseconds(), lastError)
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	return nil
+}
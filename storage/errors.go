@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Ошибки хранилища, по которым обработчики выбирают HTTP статус.
+// Проверяются через errors.Is, так как всегда возвращаются обернутыми.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+	// ErrVersionMismatch версия пользователя не совпала с ожидаемой.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrPurged пользователь окончательно удален, его история очищена.
+	ErrPurged = errors.New("purged")
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError ошибка входных данных с описанием каждого неверного поля.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = fmt.Sprintf("%s: %s", field.Field, field.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrValidation, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+func newValidationError(field string, format string, args ...interface{}) error {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: fmt.Sprintf(format, args...)}}}
+}
+
+// Коды ошибок Postgres, которые переводятся в ошибки хранилища.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// wrapError оборачивает ошибку базы, заменяя известные случаи на ошибки хранилища.
+func wrapError(action string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", action, ErrNotFound)
+	}
+
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation, pgForeignKeyViolation:
+			return fmt.Errorf("%s: %w: %v", action, ErrConflict, err)
+		}
+	}
+
+	return fmt.Errorf("%s: %w", action, err)
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// exportBatchSize строк за один FETCH из курсора выгрузки.
+const exportBatchSize = 500
+
+// Export передает fn пользователей, подходящих под фильтры options, в порядке
+// options.Sort. Строки читаются из курсора на стороне базы пакетами, так что
+// память не зависит от числа пользователей. Все строки берутся из одного
+// снимка базы. Ошибка fn прерывает выгрузку и возвращается как есть.
+func (storage *Storage) Export(ctx context.Context, options *ListOptions, fn func(user *schemas.User) error) error {
+	query, args, err := buildExportQuery(options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := storage.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("Error begin transaction: %w", err)
+	}
+	// Транзакция только читает, курсор закрывается вместе с ней.
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DECLARE export_users NO SCROLL CURSOR FOR `+query+`;`, args...); err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH %d FROM export_users;`, exportBatchSize))
+		if err != nil {
+			return wrapError("Error query", err)
+		}
+
+		users, err := scanUsers(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for i := range users {
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(users) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// Export выгружает снимок подходящих пользователей, fn вызывается без блокировки.
+func (memory *Memory) Export(ctx context.Context, options *ListOptions, fn func(user *schemas.User) error) error {
+	sortFields, err := options.normalize()
+	if err != nil {
+		return err
+	}
+
+	memory.mu.RLock()
+	var matched []*schemas.User
+	for _, user := range memory.users {
+		if user.DeletedAt == nil && matchesList(user, options) {
+			matched = append(matched, copyUser(user))
+		}
+	}
+	memory.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return compareUsers(matched[i], sortValues(matched[j], sortFields), sortFields) < 0
+	})
+
+	for _, user := range matched {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func TestExport(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	userRows := func(from int, to int) *sqlmock.Rows {
+		rows := sqlmock.NewRows(userColumnNames)
+		for id := from; id < to; id++ {
+			rows.AddRow(id, "Test", "Testovich", 20, "female", "RU", "complete", nil, "{test@test.com}", 0, 0,
+				"", "", "", createdAt, 1, nil)
+		}
+		return rows
+	}
+	fetch := regexp.QuoteMeta(fmt.Sprintf(`FETCH %d FROM export_users;`, exportBatchSize))
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec(regexp.QuoteMeta(`DECLARE export_users NO SCROLL CURSOR FOR SELECT ` + userColumns + ` FROM users u ` +
+			`WHERE u.deleted_at IS NULL AND u.gender = $1 ORDER BY u.age DESC, u.id;`)).
+		WithArgs("female").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(fetch).WillReturnRows(userRows(1, exportBatchSize+1))
+	mock.ExpectQuery(fetch).WillReturnRows(userRows(exportBatchSize+1, exportBatchSize+3))
+	mock.ExpectRollback()
+
+	options := ListOptions{Gender: "female", Sort: []SortField{{Field: "age", Desc: true}}}
+	var ids []int
+	err = storage.Export(context.Background(), &options, func(user *schemas.User) error {
+		ids = append(ids, user.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, ids, exportBatchSize+2)
+	require.Equal(t, exportBatchSize+2, ids[len(ids)-1])
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	stop := errors.New("stop")
+	mock.ExpectBegin()
+	mock.ExpectExec(`DECLARE export_users`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(fetch).WillReturnRows(userRows(1, 3))
+	mock.ExpectRollback()
+
+	err = storage.Export(context.Background(), &ListOptions{}, func(user *schemas.User) error {
+		return stop
+	})
+	require.True(t, errors.Is(err, stop))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// UserImport пакетное добавление пользователей. В атомарном режиме все пакеты
+// пишутся в одной транзакции и сохраняются только после Commit, иначе каждый
+// пакет сохраняется сразу, а Commit и Rollback ничего не делают.
+type UserImport interface {
+	// Add добавляет пакет пользователей и возвращает ошибку для каждого из них:
+	// nil для созданных, *ValidationError или *EmailConflictError для
+	// отклоненных. Отклоненные пользователи не мешают остальным. Ошибка
+	// вторым значением означает, что пакет не записан.
+	Add(ctx context.Context, users []*schemas.User) ([]error, error)
+	Commit() error
+	Rollback() error
+}
+
+// rowError ошибка, из-за которой отклоняется только один пользователь пакета.
+func rowError(err error) bool {
+	return errors.Is(err, ErrValidation) || errors.Is(err, ErrConflict)
+}
+
+type userImport struct {
+	storage *Storage
+	// tx общая транзакция атомарного импорта.
+	tx *sql.Tx
+}
+
+func (storage *Storage) BeginImport(ctx context.Context, atomic bool) (UserImport, error) {
+	userImport := &userImport{storage: storage}
+	if !atomic {
+		return userImport, nil
+	}
+
+	tx, err := storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error begin transaction: %w", err)
+	}
+	userImport.tx = tx
+
+	return userImport, nil
+}
+
+func (userImport *userImport) Add(ctx context.Context, users []*schemas.User) ([]error, error) {
+	if userImport.tx != nil {
+		return addUsers(ctx, userImport.tx, users)
+	}
+
+	var errs []error
+	err := userImport.storage.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		errs, err = addUsers(ctx, tx, users)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+func (userImport *userImport) Commit() error {
+	if userImport.tx == nil {
+		return nil
+	}
+	if err := userImport.tx.Commit(); err != nil {
+		return wrapError("Error commit", err)
+	}
+	return nil
+}
+
+func (userImport *userImport) Rollback() error {
+	if userImport.tx == nil {
+		return nil
+	}
+	if err := userImport.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return wrapError("Error rollback", err)
+	}
+	return nil
+}
+
+// addUsers добавляет каждого пользователя в своей точке сохранения, что бы
+// отклоненный пользователь не прерывал транзакцию для остальных.
+func addUsers(ctx context.Context, tx *sql.Tx, users []*schemas.User) ([]error, error) {
+	errs := make([]error, len(users))
+
+	for i, user := range users {
+		if user.EnrichmentStatus == "" {
+			user.EnrichmentStatus = schemas.EnrichmentComplete
+		}
+
+		emails, err := normalizeEmails(user.Emails)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		user.Emails = emails
+
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT import_user;`); err != nil {
+			return nil, wrapError("Error exec", err)
+		}
+
+		err = addUser(ctx, tx, user)
+		if err != nil && !rowError(err) {
+			return nil, err
+		}
+
+		if err != nil {
+			errs[i] = err
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_user;`); err != nil {
+				return nil, wrapError("Error exec", err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_user;`); err != nil {
+			return nil, wrapError("Error exec", err)
+		}
+	}
+
+	return errs, nil
+}
+
+// memoryImport добавляет пользователей через Memory.AddUser. Атомарный
+// импорт только проверяет пользователей и резервирует id, а записывает их
+// вместе с заданиями и историей под одной блокировкой в Commit.
+type memoryImport struct {
+	memory *Memory
+	atomic bool
+	// ctx из BeginImport, как у транзакции Postgres, из него берется автор
+	// записей истории в Commit.
+	ctx    context.Context
+	staged []*schemas.User
+}
+
+func (memory *Memory) BeginImport(ctx context.Context, atomic bool) (UserImport, error) {
+	return &memoryImport{memory: memory, atomic: atomic, ctx: ctx}, nil
+}
+
+func (memoryImport *memoryImport) Add(ctx context.Context, users []*schemas.User) ([]error, error) {
+	if memoryImport.atomic {
+		return memoryImport.stage(users), nil
+	}
+
+	errs := make([]error, len(users))
+	for i, user := range users {
+		if _, err := memoryImport.memory.AddUser(ctx, user); err != nil {
+			if !rowError(err) {
+				return nil, err
+			}
+			errs[i] = err
+		}
+	}
+	return errs, nil
+}
+
+// stage проверяет почты по сохраненным и уже отложенным пользователям.
+func (memoryImport *memoryImport) stage(users []*schemas.User) []error {
+	memory := memoryImport.memory
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	errs := make([]error, len(users))
+	for i, user := range users {
+		if user.EnrichmentStatus == "" {
+			user.EnrichmentStatus = schemas.EnrichmentComplete
+		}
+
+		emails, err := normalizeEmails(user.Emails)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if err := memory.checkEmails(0, emails); err != nil {
+			errs[i] = err
+			continue
+		}
+		if err := memoryImport.checkStaged(emails); err != nil {
+			errs[i] = err
+			continue
+		}
+		user.Emails = emails
+
+		// id не возвращаются при откате, как значения sequence в Postgres.
+		memory.lastID++
+		user.ID = memory.lastID
+		user.Version = 1
+		memoryImport.staged = append(memoryImport.staged, copyUser(user))
+	}
+	return errs
+}
+
+func (memoryImport *memoryImport) checkStaged(emails []string) error {
+	for _, email := range emails {
+		for _, user := range memoryImport.staged {
+			for _, owned := range user.Emails {
+				if strings.EqualFold(owned, email) {
+					return &EmailConflictError{Email: email, UserID: user.ID}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Commit заново проверяет почты, их могли занять после Add, и записывает
+// всех пользователей или никого.
+func (memoryImport *memoryImport) Commit() error {
+	memory := memoryImport.memory
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	staged := memoryImport.staged
+	memoryImport.staged = nil
+
+	for _, user := range staged {
+		if err := memory.checkEmails(0, user.Emails); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, user := range staged {
+		user.CreatedAt = now
+		if err := memory.writeAudit(memoryImport.ctx, schemas.AuditCreate, user.ID, nil, user); err != nil {
+			return err
+		}
+		memory.users[user.ID] = user
+
+		if user.EnrichmentStatus == schemas.EnrichmentPending {
+			memory.jobs[user.ID] = &memoryJob{runAt: now}
+		}
+	}
+
+	return nil
+}
+
+func (memoryImport *memoryImport) Rollback() error {
+	memoryImport.staged = nil
+	return nil
+}
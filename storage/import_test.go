@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func TestImportSavepoints(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	checkQuery := regexp.QuoteMeta(`SELECT e.email, e.user_id FROM emails e WHERE lower(e.email) = ANY($1) AND e.user_id <> $2`)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT import_user;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(checkQuery).
+		WithArgs(`{"taken@test.com"}`, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}).AddRow("taken@test.com", 5))
+	mock.ExpectExec(regexp.QuoteMeta(`ROLLBACK TO SAVEPOINT import_user;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`RELEASE SAVEPOINT import_user;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT import_user;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(checkQuery).
+		WithArgs(`{"free@test.com"}`, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users`)).
+		WithArgs("Ivan", "Petrov", 0, "", "", "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).AddRow(12, createdAt, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO emails`)).
+		WithArgs(12, `{"free@test.com"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO enrichment_jobs (user_id) VALUES ($1);`)).
+		WithArgs(12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_audit`)).
+		WithArgs(12, "create", systemActor, "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`RELEASE SAVEPOINT import_user;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	session, err := storage.BeginImport(context.Background(), true)
+	require.NoError(t, err)
+
+	errs, err := session.Add(context.Background(), []*schemas.User{
+		{Name: "Petr", Surname: "Ivanov", Emails: []string{"taken@test.com"}, EnrichmentStatus: schemas.EnrichmentPending},
+		{Name: "Anna", Surname: "Sidorova", Emails: []string{"a@test.com", "A@TEST.COM"}, EnrichmentStatus: schemas.EnrichmentPending},
+		{Name: "Ivan", Surname: "Petrov", Emails: []string{"free@test.com"}, EnrichmentStatus: schemas.EnrichmentPending},
+	})
+	require.NoError(t, err)
+
+	var conflictErr *EmailConflictError
+	require.True(t, errors.As(errs[0], &conflictErr))
+	require.Equal(t, 5, conflictErr.UserID)
+	require.True(t, errors.Is(errs[1], ErrValidation))
+	require.NoError(t, errs[2])
+
+	require.NoError(t, session.Rollback())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemoryImportStaging(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Old", Surname: "Owner"})
+	require.NoError(t, err)
+	audit := append([]schemas.AuditRecord(nil), memory.audit...)
+
+	session, err := memory.BeginImport(ctx, true)
+	require.NoError(t, err)
+	errs, err := session.Add(ctx, []*schemas.User{
+		{Name: "Ivan", Surname: "Petrov", Emails: []string{"ivan@test.com"}, EnrichmentStatus: schemas.EnrichmentPending},
+		{Name: "Petr", Surname: "Ivanov", Emails: []string{"IVAN@test.com"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	var emailErr *EmailConflictError
+	require.True(t, errors.As(errs[1], &emailErr))
+	require.Equal(t, 2, emailErr.UserID)
+
+	// До Commit отложенные пользователи, задания и история не видны.
+	_, err = memory.GetUserById(ctx, 2)
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.Empty(t, memory.jobs)
+	require.Equal(t, audit, memory.audit)
+
+	require.NoError(t, session.Rollback())
+	require.Equal(t, audit, memory.audit)
+
+	session, err = memory.BeginImport(ctx, true)
+	require.NoError(t, err)
+	_, err = session.Add(ctx, []*schemas.User{{Name: "Ivan", Surname: "Petrov", EnrichmentStatus: schemas.EnrichmentPending}})
+	require.NoError(t, err)
+	require.NoError(t, session.Commit())
+
+	user, err := memory.GetUserById(ctx, 3)
+	require.NoError(t, err)
+	require.Equal(t, "Ivan", user.Name)
+	require.Contains(t, memory.jobs, 3)
+	require.Len(t, memory.audit, 2)
+	require.Equal(t, int64(2), memory.audit[1].ID)
+}
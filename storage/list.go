@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 1000
+)
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListOptions описывает выборку страницы пользователей. Пустые поля фильтров
+// не применяются, сортировка всегда дополняется id для стабильного курсора.
+type ListOptions struct {
+	Cursor string
+	Limit  int
+
+	MinAge        *int
+	MaxAge        *int
+	Gender        string
+	Nationalize   string
+	NamePrefix    string
+	SurnamePrefix string
+	// Surname точное совпадение фамилии с учетом регистра, как в GetUsersBySurname.
+	Surname     string
+	EmailDomain string
+
+	Sort      []SortField
+	WithTotal bool
+}
+
+type listField struct {
+	column  string
+	numeric bool
+}
+
+var listFields = map[string]listField{
+	"id":          {column: "u.id", numeric: true},
+	"name":        {column: "u.name"},
+	"surname":     {column: "u.surname"},
+	"age":         {column: "u.age", numeric: true},
+	"gender":      {column: "u.gender"},
+	"nationalize": {column: "u.nationalize"},
+}
+
+// ParseSort разбирает строку вида "-age,name": поля через запятую, минус
+// означает сортировку по убыванию.
+func ParseSort(value string) ([]SortField, error) {
+	var sort []SortField
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		field := SortField{Field: strings.TrimPrefix(item, "-"), Desc: strings.HasPrefix(item, "-")}
+		if _, ok := listFields[field.Field]; !ok {
+			return nil, newValidationError("sort", "unknown field %s", field.Field)
+		}
+		sort = append(sort, field)
+	}
+
+	return sort, nil
+}
+
+// normalize проверяет опции и возвращает сортировку с id в конце.
+func (options *ListOptions) normalize() ([]SortField, error) {
+	if options.Limit <= 0 {
+		options.Limit = DefaultListLimit
+	}
+	if options.Limit > MaxListLimit {
+		options.Limit = MaxListLimit
+	}
+
+	sort := make([]SortField, 0, len(options.Sort)+1)
+	seen := make(map[string]bool)
+	for _, field := range options.Sort {
+		if _, ok := listFields[field.Field]; !ok {
+			return nil, newValidationError("sort", "unknown field %s", field.Field)
+		}
+		if seen[field.Field] {
+			return nil, newValidationError("sort", "duplicate field %s", field.Field)
+		}
+		seen[field.Field] = true
+		sort = append(sort, field)
+		if field.Field == "id" {
+			break
+		}
+	}
+
+	if !seen["id"] {
+		sort = append(sort, SortField{Field: "id"})
+	}
+
+	return sort, nil
+}
+
+type cursorData struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func sortKey(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, field := range sort {
+		parts[i] = field.Field
+		if field.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortValue(user *schemas.User, field string) interface{} {
+	switch field {
+	case "id":
+		return user.ID
+	case "name":
+		return user.Name
+	case "surname":
+		return user.Surname
+	case "age":
+		return user.Age
+	case "gender":
+		return user.Gender
+	case "nationalize":
+		return user.Nationalize
+	}
+	return nil
+}
+
+// encodeCursor запоминает значения полей сортировки последнего пользователя страницы.
+func encodeCursor(sort []SortField, user *schemas.User) (string, error) {
+	data := cursorData{Sort: sortKey(sort)}
+	for _, field := range sort {
+		data.Values = append(data.Values, sortValue(user, field.Field))
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor возвращает значения курсора, приведенные к типам полей сортировки.
+// Курсор, выданный для другой сортировки, считается неверным.
+func decodeCursor(cursor string, sort []SortField) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, newValidationError("cursor", "wrong cursor")
+	}
+
+	var data cursorData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, newValidationError("cursor", "wrong cursor")
+	}
+
+	if data.Sort != sortKey(sort) || len(data.Values) != len(sort) {
+		return nil, newValidationError("cursor", "cursor does not match sort")
+	}
+
+	values := make([]interface{}, len(sort))
+	for i, field := range sort {
+		switch value := data.Values[i].(type) {
+		case float64:
+			if !listFields[field.Field].numeric {
+				return nil, newValidationError("cursor", "wrong cursor")
+			}
+			values[i] = int(value)
+		case string:
+			if listFields[field.Field].numeric {
+				return nil, newValidationError("cursor", "wrong cursor")
+			}
+			values[i] = value
+		default:
+			return nil, newValidationError("cursor", "wrong cursor")
+		}
+	}
+
+	return values, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+type listQuery struct {
+	args []interface{}
+}
+
+func (query *listQuery) arg(value interface{}) string {
+	query.args = append(query.args, value)
+	return fmt.Sprintf("$%d", len(query.args))
+}
+
+// filterConditions строит условия WHERE по фильтрам опций, без учета курсора.
+func (query *listQuery) filterConditions(options *ListOptions) []string {
+	conditions := []string{"u.deleted_at IS NULL"}
+
+	if options.MinAge != nil {
+		conditions = append(conditions, "u.age >= "+query.arg(*options.MinAge))
+	}
+	if options.MaxAge != nil {
+		conditions = append(conditions, "u.age <= "+query.arg(*options.MaxAge))
+	}
+	if options.Gender != "" {
+		conditions = append(conditions, "u.gender = "+query.arg(options.Gender))
+	}
+	if options.Nationalize != "" {
+		conditions = append(conditions, "u.nationalize = "+query.arg(options.Nationalize))
+	}
+	if options.NamePrefix != "" {
+		conditions = append(conditions, "u.name ILIKE "+query.arg(escapeLike(options.NamePrefix)+"%"))
+	}
+	if options.SurnamePrefix != "" {
+		conditions = append(conditions, "u.surname ILIKE "+query.arg(escapeLike(options.SurnamePrefix)+"%"))
+	}
+	if options.Surname != "" {
+		conditions = append(conditions, "u.surname = "+query.arg(options.Surname))
+	}
+	if options.EmailDomain != "" {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM emails e WHERE e.user_id = u.id AND lower(e.email) LIKE "+
+				query.arg("%@"+escapeLike(strings.ToLower(options.EmailDomain)))+")")
+	}
+
+	return conditions
+}
+
+// cursorCondition строит условие "строка после курсора" для сортировки с
+// разными направлениями полей: (f1 > v1) OR (f1 = v1 AND f2 < v2) OR ...
+func (query *listQuery) cursorCondition(sort []SortField, values []interface{}) string {
+	var alternatives []string
+
+	for i, field := range sort {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("%s = %s", listFields[sort[j].Field].column, query.arg(values[j])))
+		}
+
+		operator := ">"
+		if field.Desc {
+			operator = "<"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", listFields[field.Field].column, operator, query.arg(values[i])))
+
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+func orderBy(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, field := range sort {
+		parts[i] = listFields[field.Field].column
+		if field.Desc {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type listSQL struct {
+	sort []SortField
+
+	pageSQL  string
+	pageArgs []interface{}
+
+	countSQL  string
+	countArgs []interface{}
+}
+
+// buildListQuery строит запрос страницы (на одну строку больше limit, что бы
+// узнать о следующей странице) и, если нужен, запрос общего количества.
+func buildListQuery(options *ListOptions) (*listSQL, error) {
+	sort, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	result := listSQL{sort: sort}
+
+	if options.WithTotal {
+		count := listQuery{}
+		result.countSQL = fmt.Sprintf("SELECT count(*) FROM users u WHERE %s;",
+			strings.Join(count.filterConditions(options), " AND "))
+		result.countArgs = count.args
+	}
+
+	query := listQuery{}
+	conditions := query.filterConditions(options)
+
+	if options.Cursor != "" {
+		values, err := decodeCursor(options.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, query.cursorCondition(sort, values))
+	}
+
+	result.pageSQL = fmt.Sprintf(
+		"SELECT %s FROM users u WHERE %s ORDER BY %s LIMIT %s;", userColumns,
+		strings.Join(conditions, " AND "), orderBy(sort), query.arg(options.Limit+1))
+	result.pageArgs = query.args
+
+	return &result, nil
+}
+
+// buildExportQuery строит запрос всех пользователей по фильтрам и сортировке
+// опций. Курсор, limit и with_total не используются.
+func buildExportQuery(options *ListOptions) (string, []interface{}, error) {
+	sort, err := options.normalize()
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := listQuery{}
+	sql := fmt.Sprintf("SELECT %s FROM users u WHERE %s ORDER BY %s", userColumns,
+		strings.Join(query.filterConditions(options), " AND "), orderBy(sort))
+
+	return sql, query.args, nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func TestBuildListQuery(t *testing.T) {
+	minAge := 18
+	options := ListOptions{
+		Limit:       10,
+		MinAge:      &minAge,
+		Gender:      "male",
+		NamePrefix:  "Iv_",
+		EmailDomain: "Test.com",
+		Sort:        []SortField{{Field: "age", Desc: true}},
+		WithTotal:   true,
+	}
+
+	query, err := buildListQuery(&options)
+	require.NoError(t, err)
+	require.Equal(t,
+		`SELECT `+userColumns+` FROM users u `+
+			`WHERE u.deleted_at IS NULL AND u.age >= $1 AND u.gender = $2 AND u.name ILIKE $3 `+
+			`AND EXISTS (SELECT 1 FROM emails e WHERE e.user_id = u.id AND lower(e.email) LIKE $4) `+
+			`ORDER BY u.age DESC, u.id LIMIT $5;`,
+		query.pageSQL)
+	require.Equal(t, []interface{}{18, "male", `Iv\_%`, "%@test.com", 11}, query.pageArgs)
+	require.Equal(t,
+		`SELECT count(*) FROM users u WHERE u.deleted_at IS NULL AND u.age >= $1 AND u.gender = $2 `+
+			`AND u.name ILIKE $3 AND EXISTS (SELECT 1 FROM emails e WHERE e.user_id = u.id AND lower(e.email) LIKE $4);`,
+		query.countSQL)
+	require.Equal(t, []interface{}{18, "male", `Iv\_%`, "%@test.com"}, query.countArgs)
+
+	cursor, err := encodeCursor(query.sort, &schemas.User{ID: 7, Age: 30})
+	require.NoError(t, err)
+
+	options.Cursor = cursor
+	options.WithTotal = false
+	query, err = buildListQuery(&options)
+	require.NoError(t, err)
+	require.Contains(t, query.pageSQL, `AND ((u.age < $5) OR (u.age = $6 AND u.id > $7)) ORDER BY`)
+	require.Equal(t, []interface{}{18, "male", `Iv\_%`, "%@test.com", 30, 30, 7, 11}, query.pageArgs)
+
+	query, err = buildListQuery(&ListOptions{Limit: 10, Surname: "Petrov"})
+	require.NoError(t, err)
+	require.Contains(t, query.pageSQL, `WHERE u.deleted_at IS NULL AND u.surname = $1 ORDER BY`)
+	require.Equal(t, []interface{}{"Petrov", 11}, query.pageArgs)
+}
+
+func TestListCursorMismatch(t *testing.T) {
+	cursor, err := encodeCursor([]SortField{{Field: "id"}}, &schemas.User{ID: 7})
+	require.NoError(t, err)
+
+	_, err = buildListQuery(&ListOptions{Cursor: cursor, Sort: []SortField{{Field: "name"}}})
+	require.Error(t, err)
+
+	_, err = buildListQuery(&ListOptions{Cursor: "not a cursor"})
+	require.Error(t, err)
+}
+
+func TestParseSort(t *testing.T) {
+	sort, err := ParseSort("-age, name")
+	require.NoError(t, err)
+	require.Equal(t, []SortField{{Field: "age", Desc: true}, {Field: "name"}}, sort)
+
+	_, err = ParseSort("password")
+	require.Error(t, err)
+}
+
+func TestMemoryList(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	for _, user := range []schemas.User{
+		{Name: "Ivan", Surname: "Petrov", Age: 30, Gender: "male", Emails: []string{"ivan@test.com"}},
+		{Name: "Irina", Surname: "Petrova", Age: 25, Gender: "female", Emails: []string{"irina@other.com"}},
+		{Name: "Petr", Age: 30, Gender: "male", Emails: []string{"petr@TEST.com"}},
+		{Name: "Igor", Age: 40, Gender: "male"},
+	} {
+		_, err := memory.AddUser(ctx, &user)
+		require.NoError(t, err)
+	}
+
+	options := ListOptions{Limit: 2, Sort: []SortField{{Field: "age", Desc: true}}, WithTotal: true}
+	page, err := memory.List(ctx, &options)
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 1}, pageIds(page))
+	require.Equal(t, 4, *page.Total)
+	require.NotEmpty(t, page.NextCursor)
+
+	options.Cursor = page.NextCursor
+	page, err = memory.List(ctx, &options)
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 2}, pageIds(page))
+	require.Empty(t, page.NextCursor)
+
+	page, err = memory.List(ctx, &ListOptions{EmailDomain: "test.com"})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3}, pageIds(page))
+
+	page, err = memory.List(ctx, &ListOptions{NamePrefix: "i", Gender: "male"})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 4}, pageIds(page))
+
+	page, err = memory.List(ctx, &ListOptions{Surname: "Petrov"})
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, pageIds(page))
+}
+
+func pageIds(page *schemas.UserPage) []int {
+	ids := make([]int, len(page.Items))
+	for i, user := range page.Items {
+		ids[i] = user.ID
+	}
+	return ids
+}
@@ -0,0 +1,666 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// Memory хранит пользователей в памяти процесса. Используется в тестах и
+// для локального запуска без Postgres, поведение повторяет Storage.
+type Memory struct {
+	mu     sync.RWMutex
+	lastID int
+	users  map[int]*schemas.User
+	jobs   map[int]*memoryJob
+
+	checkpoints map[string]int
+	apiKeys     map[string]*memoryAPIKey
+	audit       []schemas.AuditRecord
+}
+
+type memoryJob struct {
+	attempts  int
+	runAt     time.Time
+	lastError string
+	refresh   bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:       make(map[int]*schemas.User),
+		jobs:        make(map[int]*memoryJob),
+		checkpoints: make(map[string]int),
+		apiKeys:     make(map[string]*memoryAPIKey),
+	}
+}
+
+func copyUser(user *schemas.User) *schemas.User {
+	copied := *user
+	if user.Emails != nil {
+		copied.Emails = append([]string(nil), user.Emails...)
+	}
+	if user.Nationalities != nil {
+		copied.Nationalities = append([]schemas.Nationality(nil), user.Nationalities...)
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+	return &copied
+}
+
+// writeAudit добавляет запись в историю, вызывается под memory.mu.
+func (memory *Memory) writeAudit(ctx context.Context, action string, id int, before *schemas.User, after *schemas.User) error {
+	changes, err := diffUsers(before, after)
+	if err != nil {
+		return err
+	}
+
+	// Записи не удаляются, поэтому id продолжают последний.
+	recordID := int64(1)
+	if last := len(memory.audit); last > 0 {
+		recordID = memory.audit[last-1].ID + 1
+	}
+
+	info := auditInfo(ctx)
+	memory.audit = append(memory.audit, schemas.AuditRecord{
+		ID:        recordID,
+		UserID:    id,
+		Action:    action,
+		Actor:     info.Actor,
+		RequestID: info.RequestID,
+		ChangedAt: time.Now(),
+		Changes:   changes,
+	})
+	return nil
+}
+
+func (memory *Memory) History(ctx context.Context, id int) ([]schemas.AuditRecord, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var records []schemas.AuditRecord
+	for _, record := range memory.audit {
+		if record.UserID == id {
+			records = append(records, record)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+	if err := checkPurged(records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (memory *Memory) GetUserAsOf(ctx context.Context, id int, asOf time.Time) (*schemas.User, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var records []schemas.AuditRecord
+	for _, record := range memory.audit {
+		if record.UserID == id {
+			records = append(records, record)
+		}
+	}
+
+	return replayAsOf(records, asOf)
+}
+
+// redactAudit очищает changes в истории пользователя, как purge в Postgres.
+func (memory *Memory) redactAudit(id int) {
+	for i := range memory.audit {
+		if memory.audit[i].UserID == id {
+			memory.audit[i].Changes = map[string]schemas.FieldChange{}
+		}
+	}
+}
+
+func (memory *Memory) GetUserById(ctx context.Context, id int) (*schemas.User, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	user, ok := memory.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+func (memory *Memory) GetUsersBySurname(ctx context.Context, surname string) ([]schemas.User, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var users []schemas.User
+	for _, id := range memory.sortedIds() {
+		if user := memory.users[id]; user.Surname == surname && user.DeletedAt == nil {
+			users = append(users, *copyUser(user))
+		}
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+	return users, nil
+}
+
+// Search оценивает каждого пользователя так же, как подсветка в Storage.Search.
+func (memory *Memory) Search(ctx context.Context, query string, limit int) ([]schemas.SearchResult, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	tokens := searchTokens(query)
+	results := make([]schemas.SearchResult, 0)
+	if len(tokens) == 0 {
+		return results, nil
+	}
+
+	for _, id := range memory.sortedIds() {
+		user := memory.users[id]
+		if user.DeletedAt != nil {
+			continue
+		}
+		if result := searchResult(copyUser(user), tokens); result.Score >= searchThreshold {
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results[:min(len(results), searchLimit(limit))], nil
+}
+
+// checkEmails как checkEmails для Storage, вызывается под блокировкой.
+func (memory *Memory) checkEmails(id int, emails []string) error {
+	for _, email := range emails {
+		if owner := memory.emailOwner(email); owner != 0 && owner != id {
+			return &EmailConflictError{Email: email, UserID: owner}
+		}
+	}
+	return nil
+}
+
+func (memory *Memory) emailOwner(email string) int {
+	for _, id := range memory.sortedIds() {
+		for _, owned := range memory.users[id].Emails {
+			if strings.EqualFold(owned, email) {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+func (memory *Memory) GetUserByEmail(ctx context.Context, email string) (*schemas.User, error) {
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, newValidationError("email", "must be a valid email address")
+	}
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	user, ok := memory.users[memory.emailOwner(normalized)]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+func (memory *Memory) AddUser(ctx context.Context, user *schemas.User) (*schemas.User, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if user.EnrichmentStatus == "" {
+		user.EnrichmentStatus = schemas.EnrichmentComplete
+	}
+
+	emails, err := normalizeEmails(user.Emails)
+	if err != nil {
+		return nil, err
+	}
+	if err := memory.checkEmails(0, emails); err != nil {
+		return nil, err
+	}
+	user.Emails = emails
+
+	memory.lastID++
+	user.ID = memory.lastID
+	user.CreatedAt = time.Now()
+	user.Version = 1
+	if err := memory.writeAudit(ctx, schemas.AuditCreate, user.ID, nil, user); err != nil {
+		return nil, err
+	}
+	memory.users[user.ID] = copyUser(user)
+
+	if user.EnrichmentStatus == schemas.EnrichmentPending {
+		memory.jobs[user.ID] = &memoryJob{runAt: time.Now()}
+	}
+
+	return user, nil
+}
+
+func (memory *Memory) GetAll(ctx context.Context) ([]schemas.User, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	users := make([]schemas.User, 0, len(memory.users))
+	for _, id := range memory.sortedIds() {
+		if user := memory.users[id]; user.DeletedAt == nil {
+			users = append(users, *copyUser(user))
+		}
+	}
+
+	return users, nil
+}
+
+func (memory *Memory) List(ctx context.Context, options *ListOptions) (*schemas.UserPage, error) {
+	sortFields, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var after []interface{}
+	if options.Cursor != "" {
+		if after, err = decodeCursor(options.Cursor, sortFields); err != nil {
+			return nil, err
+		}
+	}
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var matched []*schemas.User
+	for _, user := range memory.users {
+		if user.DeletedAt == nil && matchesList(user, options) {
+			matched = append(matched, user)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return compareUsers(matched[i], sortValues(matched[j], sortFields), sortFields) < 0
+	})
+
+	page := schemas.UserPage{Items: make([]schemas.User, 0, options.Limit)}
+	if options.WithTotal {
+		total := len(matched)
+		page.Total = &total
+	}
+
+	for _, user := range matched {
+		if after != nil && compareUsers(user, after, sortFields) <= 0 {
+			continue
+		}
+
+		if len(page.Items) == options.Limit {
+			if page.NextCursor, err = encodeCursor(sortFields, &page.Items[len(page.Items)-1]); err != nil {
+				return nil, err
+			}
+			break
+		}
+		page.Items = append(page.Items, *copyUser(user))
+	}
+
+	return &page, nil
+}
+
+func matchesList(user *schemas.User, options *ListOptions) bool {
+	if options.MinAge != nil && user.Age < *options.MinAge {
+		return false
+	}
+	if options.MaxAge != nil && user.Age > *options.MaxAge {
+		return false
+	}
+	if options.Gender != "" && user.Gender != options.Gender {
+		return false
+	}
+	if options.Nationalize != "" && user.Nationalize != options.Nationalize {
+		return false
+	}
+	if options.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(user.Name), strings.ToLower(options.NamePrefix)) {
+		return false
+	}
+	if options.SurnamePrefix != "" && !strings.HasPrefix(strings.ToLower(user.Surname), strings.ToLower(options.SurnamePrefix)) {
+		return false
+	}
+	if options.Surname != "" && user.Surname != options.Surname {
+		return false
+	}
+	if options.EmailDomain != "" {
+		suffix := "@" + strings.ToLower(options.EmailDomain)
+		found := false
+		for _, email := range user.Emails {
+			if strings.HasSuffix(strings.ToLower(email), suffix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sortValues(user *schemas.User, sortFields []SortField) []interface{} {
+	values := make([]interface{}, len(sortFields))
+	for i, field := range sortFields {
+		values[i] = sortValue(user, field.Field)
+	}
+	return values
+}
+
+// compareUsers сравнивает пользователя со значениями полей сортировки с учетом
+// направления каждого поля, так же как ORDER BY в Storage.
+func compareUsers(user *schemas.User, values []interface{}, sortFields []SortField) int {
+	for i, field := range sortFields {
+		result := 0
+		switch value := sortValue(user, field.Field).(type) {
+		case int:
+			other := values[i].(int)
+			if value < other {
+				result = -1
+			} else if value > other {
+				result = 1
+			}
+		case string:
+			result = strings.Compare(value, values[i].(string))
+		}
+
+		if field.Desc {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func (memory *Memory) EditUser(ctx context.Context, id int, patch *schemas.UserPatch, version int) (*schemas.User, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	stored, ok := memory.users[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+	if version != 0 && version != stored.Version {
+		return nil, fmt.Errorf("User version is %d, expected %d: %w", stored.Version, version, ErrVersionMismatch)
+	}
+
+	user := copyUser(stored)
+
+	if patch.Emails != nil {
+		emails, err := normalizeEmails(*patch.Emails)
+		if err != nil {
+			return nil, err
+		}
+		if err := memory.checkEmails(id, emails); err != nil {
+			return nil, err
+		}
+		user.Emails = emails
+	}
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	if patch.Surname != nil {
+		user.Surname = *patch.Surname
+	}
+	if patch.Gender != nil {
+		user.Gender = *patch.Gender
+		user.Sources.Gender = schemas.SourceManual
+	}
+	if patch.Age != nil {
+		user.Age = *patch.Age
+		user.Sources.Age = schemas.SourceManual
+	}
+	if patch.Nationalize != nil {
+		user.Nationalize = *patch.Nationalize
+		user.Sources.Nationalize = schemas.SourceManual
+	}
+	user.Version++
+
+	if err := memory.writeAudit(ctx, schemas.AuditEdit, id, stored, user); err != nil {
+		return nil, err
+	}
+	memory.users[id] = user
+
+	return copyUser(user), nil
+}
+
+func (memory *Memory) DeleteUser(ctx context.Context, id int, version int) (*schemas.User, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	user, ok := memory.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+	if version != 0 && version != user.Version {
+		return nil, fmt.Errorf("User version is %d, expected %d: %w", user.Version, version, ErrVersionMismatch)
+	}
+
+	before := copyUser(user)
+	deletedAt := time.Now()
+	user.DeletedAt = &deletedAt
+	user.Version++
+
+	if err := memory.writeAudit(ctx, schemas.AuditDelete, id, before, user); err != nil {
+		return nil, err
+	}
+
+	return copyUser(user), nil
+}
+
+func (memory *Memory) RestoreUser(ctx context.Context, id int) (*schemas.User, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	user, ok := memory.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	before := copyUser(user)
+	user.DeletedAt = nil
+	user.Version++
+
+	if err := memory.writeAudit(ctx, schemas.AuditRestore, id, before, user); err != nil {
+		return nil, err
+	}
+
+	return copyUser(user), nil
+}
+
+func (memory *Memory) PurgeUser(ctx context.Context, id int) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	user, ok := memory.users[id]
+	if !ok {
+		return fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+	if user.DeletedAt == nil {
+		return fmt.Errorf("User is not deleted: %w", ErrConflict)
+	}
+
+	delete(memory.users, id)
+	delete(memory.jobs, id)
+	memory.redactAudit(id)
+
+	return memory.writeAudit(ctx, schemas.AuditPurge, id, nil, nil)
+}
+
+func (memory *Memory) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	purged := 0
+	for id, user := range memory.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(before) {
+			delete(memory.users, id)
+			delete(memory.jobs, id)
+			memory.redactAudit(id)
+			if err := memory.writeAudit(ctx, schemas.AuditPurge, id, nil, nil); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (memory *Memory) ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]EnrichmentJob, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	now := time.Now()
+
+	var ids []int
+	for id, job := range memory.jobs {
+		if !job.runAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return memory.jobs[ids[i]].runAt.Before(memory.jobs[ids[j]].runAt)
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	jobs := make([]EnrichmentJob, 0, len(ids))
+	for _, id := range ids {
+		job := memory.jobs[id]
+		job.attempts++
+		job.runAt = now.Add(lease)
+
+		user := memory.users[id]
+		jobs = append(jobs, EnrichmentJob{UserID: id, Name: user.Name, Surname: user.Surname,
+			Attempts: job.attempts, Refresh: job.refresh})
+	}
+
+	return jobs, nil
+}
+
+func (memory *Memory) CompleteEnrichment(ctx context.Context, id int, result *metadata.Result, status string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	delete(memory.jobs, id)
+
+	user, ok := memory.users[id]
+	if !ok {
+		return fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	before := copyUser(user)
+	result.Apply(user)
+	user.EnrichmentStatus = status
+	user.Version++
+
+	return memory.writeAudit(ctx, schemas.AuditEnrich, id, before, user)
+}
+
+func (memory *Memory) RetryEnrichment(ctx context.Context, id int, delay time.Duration, lastError string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if job, ok := memory.jobs[id]; ok {
+		job.runAt = time.Now().Add(delay)
+		job.lastError = lastError
+	}
+
+	return nil
+}
+
+func (memory *Memory) SelectForReenrichment(ctx context.Context, filter *ReenrichFilter, afterID int, limit int) ([]int, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var ids []int
+	for _, id := range memory.sortedIds() {
+		if id > afterID && filter.matches(memory.users[id]) {
+			ids = append(ids, id)
+			if len(ids) == limit {
+				break
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func (memory *Memory) EnqueueEnrichment(ctx context.Context, ids []int) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	for _, id := range ids {
+		user, ok := memory.users[id]
+		if !ok || user.DeletedAt != nil {
+			continue
+		}
+
+		before := copyUser(user)
+		user.EnrichmentStatus = schemas.EnrichmentPending
+		user.Version++
+		if err := memory.writeAudit(ctx, schemas.AuditReenrich, id, before, user); err != nil {
+			return err
+		}
+		if job, ok := memory.jobs[id]; ok {
+			job.refresh = true
+		} else {
+			memory.jobs[id] = &memoryJob{runAt: time.Now(), refresh: true}
+		}
+	}
+
+	return nil
+}
+
+func (memory *Memory) GetCheckpoint(ctx context.Context, run string) (int, bool, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	lastID, ok := memory.checkpoints[run]
+	return lastID, ok, nil
+}
+
+func (memory *Memory) SaveCheckpoint(ctx context.Context, run string, lastID int) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	memory.checkpoints[run] = lastID
+	return nil
+}
+
+func (memory *Memory) DeleteCheckpoint(ctx context.Context, run string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	delete(memory.checkpoints, run)
+	return nil
+}
+
+func (memory *Memory) sortedIds() []int {
+	ids := make([]int, 0, len(memory.users))
+	for id := range memory.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
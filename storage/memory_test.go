@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func TestMemoryAddAndGet(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	user := schemas.User{Name: "Test", Surname: "Testovich",
+		Age: 20, Gender: "Male", Nationalize: "Russian",
+		Emails: []string{"test_testovich@test.com"}}
+
+	added, err := memory.AddUser(ctx, &user)
+	require.NoError(t, err)
+	require.Equal(t, 1, added.ID)
+
+	second, err := memory.AddUser(ctx, &schemas.User{Name: "Second", Surname: "Testovich"})
+	require.NoError(t, err)
+	require.Equal(t, 2, second.ID)
+
+	got, err := memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, user, *got)
+
+	bySurname, err := memory.GetUsersBySurname(ctx, "Testovich")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, []int{bySurname[0].ID, bySurname[1].ID})
+
+	all, err := memory.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	require.Equal(t, []int{1, 2}, []int{all[0].ID, all[1].ID})
+
+	_, err = memory.GetUserById(ctx, 3)
+	require.Error(t, err)
+}
+
+func TestMemoryReturnsCopies(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	user := schemas.User{Name: "Test", Emails: []string{"a@test.com"}}
+	_, err := memory.AddUser(ctx, &user)
+	require.NoError(t, err)
+
+	user.Emails[0] = "changed@test.com"
+	got, err := memory.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a@test.com"}, got.Emails)
+
+	got.Name = "Changed"
+	got.Emails[0] = "changed@test.com"
+	again, err := memory.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Test", again.Name)
+	require.Equal(t, []string{"a@test.com"}, again.Emails)
+}
+
+func TestMemoryEditUser(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Test", Surname: "Testovich",
+		Age: 20, Gender: "Male", Nationalize: "Russian",
+		Emails: []string{"test_testovich@test.com"}})
+	require.NoError(t, err)
+
+	name, age := "Edited", 30
+	emails := []string{"new@test.com", "other@test.com"}
+	edited, err := memory.EditUser(ctx, 1, &schemas.UserPatch{Name: &name, Age: &age, Emails: &emails}, 1)
+	require.NoError(t, err)
+	require.Equal(t, schemas.User{ID: 1, Name: "Edited", Surname: "Testovich",
+		Age: 30, Gender: "Male", Nationalize: "Russian",
+		Emails: []string{"new@test.com", "other@test.com"}, EnrichmentStatus: schemas.EnrichmentComplete,
+		Sources: schemas.FieldSources{Age: schemas.SourceManual}, CreatedAt: edited.CreatedAt, Version: 2}, *edited)
+
+	emails[0] = "changed@test.com"
+	got, err := memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"new@test.com", "other@test.com"}, got.Emails)
+
+	edited, err = memory.EditUser(ctx, 1, &schemas.UserPatch{Emails: &[]string{}}, 0)
+	require.NoError(t, err)
+	require.Empty(t, edited.Emails)
+	require.Equal(t, 3, edited.Version)
+
+	_, err = memory.EditUser(ctx, 1, &schemas.UserPatch{Name: &name}, 2)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+
+	_, err = memory.EditUser(ctx, 2, &schemas.UserPatch{Name: &name}, 0)
+	require.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestMemoryConcurrentAdd(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := memory.AddUser(ctx, &schemas.User{Name: "Test"})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	all, err := memory.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 50)
+	require.Equal(t, 50, all[49].ID)
+}
+
+func TestMemorySoftDelete(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Test", Surname: "Testovich"})
+	require.NoError(t, err)
+
+	deleted, err := memory.DeleteUser(ctx, 1, 0)
+	require.NoError(t, err)
+	require.NotNil(t, deleted.DeletedAt)
+
+	_, err = memory.GetUserById(ctx, 1)
+	require.Error(t, err)
+	_, err = memory.GetUsersBySurname(ctx, "Testovich")
+	require.Error(t, err)
+	all, err := memory.GetAll(ctx)
+	require.NoError(t, err)
+	require.Empty(t, all)
+
+	_, err = memory.DeleteUser(ctx, 1, 0)
+	require.Error(t, err)
+
+	restored, err := memory.RestoreUser(ctx, 1)
+	require.NoError(t, err)
+	require.Nil(t, restored.DeletedAt)
+
+	_, err = memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+
+	err = memory.PurgeUser(ctx, 1)
+	require.True(t, errors.Is(err, ErrConflict))
+
+	_, err = memory.DeleteUser(ctx, 1, 0)
+	require.NoError(t, err)
+
+	purged, err := memory.PurgeDeleted(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+
+	_, err = memory.RestoreUser(ctx, 1)
+	require.Error(t, err)
+}
+
+func TestMemoryEnrichmentJobs(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Test", Surname: "Testovich", Age: 30,
+		Gender: "female", Sources: schemas.FieldSources{Age: schemas.SourceManual, Gender: schemas.SourceEnriched},
+		EnrichmentStatus: schemas.EnrichmentPending})
+	require.NoError(t, err)
+	_, err = memory.AddUser(ctx, &schemas.User{Name: "Done", Surname: "Testovich"})
+	require.NoError(t, err)
+
+	jobs, err := memory.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []EnrichmentJob{{UserID: 1, Name: "Test", Surname: "Testovich", Attempts: 1}}, jobs)
+
+	// Задание выдано и до истечения lease повторно не выдается.
+	jobs, err = memory.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+
+	require.NoError(t, memory.RetryEnrichment(ctx, 1, 0, "timeout"))
+	jobs, err = memory.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 2, jobs[0].Attempts)
+
+	require.NoError(t, memory.CompleteEnrichment(ctx, 1,
+		&metadata.Result{Age: 42, Gender: "male"}, schemas.EnrichmentPartial))
+
+	got, err := memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 30, got.Age)
+	require.Equal(t, "male", got.Gender)
+	require.Equal(t, schemas.FieldSources{Age: schemas.SourceManual, Gender: schemas.SourceEnriched}, got.Sources)
+	require.Equal(t, schemas.EnrichmentPartial, got.EnrichmentStatus)
+
+	// Пустой список и ручная национальность не стирают сохраненные страны.
+	nationalities := []schemas.Nationality{{Country: "RU", Probability: 0.7}}
+	require.NoError(t, memory.CompleteEnrichment(ctx, 1,
+		&metadata.Result{Nationalize: "RU", Nationalities: nationalities}, schemas.EnrichmentComplete))
+	require.NoError(t, memory.CompleteEnrichment(ctx, 1, &metadata.Result{Age: 42}, schemas.EnrichmentPartial))
+
+	got, err = memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, nationalities, got.Nationalities)
+
+	memory.users[1].Sources.Nationalize = schemas.SourceManual
+	require.NoError(t, memory.CompleteEnrichment(ctx, 1,
+		&metadata.Result{Nationalize: "BY", Nationalities: []schemas.Nationality{{Country: "BY", Probability: 0.9}}},
+		schemas.EnrichmentComplete))
+
+	got, err = memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "RU", got.Nationalize)
+	require.Equal(t, nationalities, got.Nationalities)
+
+	jobs, err = memory.ClaimEnrichmentJobs(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+}
+
+func TestMemoryEnrichmentConfidence(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Test", Surname: "Testovich", Age: 30,
+		Sources: schemas.FieldSources{Age: schemas.SourceManual}, EnrichmentStatus: schemas.EnrichmentPending})
+	require.NoError(t, err)
+
+	// Пол ниже порога не записывается, но его вероятность сохраняется.
+	result := &metadata.Result{Gender: "male", GenderProbability: 0.6, Age: 42, AgeCount: 3}
+	result.Filter(&config.MinConfidence{Gender: 0.8, AgeCount: 5})
+	require.NoError(t, memory.CompleteEnrichment(ctx, 1, result, schemas.EnrichmentComplete))
+
+	got, err := memory.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "", got.Gender)
+	require.Equal(t, 0.6, got.GenderProbability)
+	require.Empty(t, got.Sources.Gender)
+	// Возраст задан вручную, поэтому не меняется и число выборок.
+	require.Equal(t, 30, got.Age)
+	require.Equal(t, 0, got.AgeCount)
+}
+
+func TestMemoryReenrichment(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	for _, user := range []schemas.User{
+		{Name: "Full", Age: 20, Gender: "male", Nationalize: "RU"},
+		{Name: "Empty", Gender: "male", Nationalize: "RU"},
+		{Name: "Other", Age: 20, Gender: "male", Nationalize: "UA"},
+	} {
+		_, err := memory.AddUser(ctx, &user)
+		require.NoError(t, err)
+	}
+
+	ids, err := memory.SelectForReenrichment(ctx, &ReenrichFilter{}, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, ids)
+
+	ids, err = memory.SelectForReenrichment(ctx, &ReenrichFilter{}, 2, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{3}, ids)
+
+	ids, err = memory.SelectForReenrichment(ctx, &ReenrichFilter{EmptyFields: true}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, ids)
+
+	ids, err = memory.SelectForReenrichment(ctx, &ReenrichFilter{Nationalize: "RU"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, ids)
+
+	past := time.Now().Add(-time.Hour)
+	ids, err = memory.SelectForReenrichment(ctx, &ReenrichFilter{CreatedBefore: &past}, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	require.NoError(t, memory.EnqueueEnrichment(ctx, []int{2, 3}))
+	jobs, err := memory.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+
+	got, err := memory.GetUserById(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, schemas.EnrichmentPending, got.EnrichmentStatus)
+}
+
+func TestMemoryHistory(t *testing.T) {
+	memory := NewMemory()
+	ctx := WithAuditInfo(context.Background(), AuditInfo{Actor: "operator", RequestID: "request-1"})
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Ivan", Surname: "Petrov", Nationalize: "RU"})
+	require.NoError(t, err)
+	created := time.Now()
+
+	nationalize := "BY"
+	_, err = memory.EditUser(ctx, 1, &schemas.UserPatch{Nationalize: &nationalize}, 0)
+	require.NoError(t, err)
+	edited := time.Now()
+
+	_, err = memory.DeleteUser(context.Background(), 1, 0)
+	require.NoError(t, err)
+
+	records, err := memory.History(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, []string{schemas.AuditCreate, schemas.AuditEdit, schemas.AuditDelete},
+		[]string{records[0].Action, records[1].Action, records[2].Action})
+	require.Equal(t, "operator", records[1].Actor)
+	require.Equal(t, "request-1", records[1].RequestID)
+	require.Equal(t, "system", records[2].Actor)
+	require.JSONEq(t, `{"before":"RU","after":"BY"}`, marshal(t, records[1].Changes["nationalize"]))
+	require.JSONEq(t, `{"before":{},"after":{"nationalize":"manual"}}`, marshal(t, records[1].Changes["sources"]))
+
+	user, err := memory.GetUserAsOf(ctx, 1, created)
+	require.NoError(t, err)
+	require.Equal(t, "RU", user.Nationalize)
+	require.Equal(t, 1, user.Version)
+
+	user, err = memory.GetUserAsOf(ctx, 1, edited)
+	require.NoError(t, err)
+	require.Equal(t, "BY", user.Nationalize)
+	require.Equal(t, schemas.SourceManual, user.Sources.Nationalize)
+
+	_, err = memory.GetUserAsOf(ctx, 1, time.Now())
+	require.True(t, errors.Is(err, ErrNotFound))
+	_, err = memory.GetUserAsOf(ctx, 1, created.Add(-time.Hour))
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	require.NoError(t, memory.PurgeUser(ctx, 1))
+	_, err = memory.History(ctx, 1)
+	require.True(t, errors.Is(err, ErrPurged))
+	_, err = memory.GetUserAsOf(ctx, 1, edited)
+	require.True(t, errors.Is(err, ErrPurged))
+
+	// Действия и авторы остаются, данные пользователя стерты.
+	require.Len(t, memory.audit, 4)
+	for _, record := range memory.audit {
+		require.Empty(t, record.Changes)
+	}
+	require.Equal(t, "operator", memory.audit[1].Actor)
+	require.Equal(t, schemas.AuditPurge, memory.audit[3].Action)
+}
+
+func marshal(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestMemoryEmails(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	_, err := memory.AddUser(ctx, &schemas.User{Name: "Ivan", Surname: "Petrov", Emails: []string{" Ivan@Почта.РФ"}})
+	require.NoError(t, err)
+
+	got, err := memory.GetUserByEmail(ctx, "ivan@xn--80a1acny.xn--p1ai")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Ivan@xn--80a1acny.xn--p1ai"}, got.Emails)
+
+	_, err = memory.AddUser(ctx, &schemas.User{Name: "Petr", Surname: "Ivanov", Emails: []string{"IVAN@почта.рф"}})
+	var conflictErr *EmailConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Equal(t, 1, conflictErr.UserID)
+
+	_, err = memory.AddUser(ctx, &schemas.User{Name: "Petr", Surname: "Ivanov", Emails: []string{"a@test.com", "A@TEST.com"}})
+	require.True(t, errors.Is(err, ErrValidation))
+
+	// Свои адреса не конфликтуют при редактировании.
+	_, err = memory.EditUser(ctx, 1, &schemas.UserPatch{Emails: &[]string{"ivan@почта.рф", "ivan@test.com"}}, 0)
+	require.NoError(t, err)
+
+	_, err = memory.GetUserByEmail(ctx, "nobody@test.com")
+	require.True(t, errors.Is(err, ErrNotFound))
+}
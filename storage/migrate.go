@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory lock, под которым выполняются миграции. Пока он захвачен
+// одной репликой, остальные ждут, а не применяют те же миграции параллельно.
+const migrationLockKey = 7_242_317_001
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// OpenMigrator подключается к базе без применения миграций, для команды migrate.
+func OpenMigrator(ctx context.Context, config *config.Storage) (*Migrator, error) {
+	db, err := connect(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return migrator, nil
+}
+
+func (migrator *Migrator) Close() error {
+	return migrator.db.Close()
+}
+
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Wrong migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(files, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("Error read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("Different names for migration %d: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("Migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Version возвращает номер последней примененной миграции, 0 для пустой базы.
+func (migrator *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if len(applied) > 0 {
+			version = applied[len(applied)-1]
+		}
+		return nil
+	})
+
+	return version, err
+}
+
+// Pending возвращает еще не примененные миграции в порядке применения.
+func (migrator *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	var pending []Migration
+
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		pending = migrator.pending(applied)
+		return nil
+	})
+
+	return pending, err
+}
+
+// Up применяет все недостающие миграции и возвращает их количество.
+func (migrator *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.pending(applied) {
+			log.Printf("Applying migration %d_%s", migration.Version, migration.Name)
+
+			err := runMigration(ctx, conn, migration.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`,
+				migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("Error apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Down откатывает последние steps примененных миграций.
+func (migrator *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && count < steps; i-- {
+			migration, ok := migrator.find(applied[i])
+			if !ok {
+				return fmt.Errorf("Unknown applied migration %d", applied[i])
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("Migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+
+			log.Printf("Reverting migration %d_%s", migration.Version, migration.Name)
+
+			err := runMigration(ctx, conn, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = $1;`,
+				migration.Version)
+			if err != nil {
+				return fmt.Errorf("Error revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+func (migrator *Migrator) pending(applied []int) []Migration {
+	isApplied := make(map[int]bool, len(applied))
+	for _, version := range applied {
+		isApplied[version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range migrator.migrations {
+		if !isApplied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+func (migrator *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range migrator.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock выполняет fn на отдельном соединении с захваченным advisory lock,
+// так как блокировка принадлежит сессии, а не пулу.
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("Error get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLockKey); err != nil {
+		return fmt.Errorf("Error lock migrations: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockKey); err != nil {
+			log.Printf("Error unlock migrations: %v", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version     BIGINT PRIMARY KEY,
+			name        TEXT NOT NULL,
+			applied_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);`)
+	if err != nil {
+		return fmt.Errorf("Error create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) ([]int, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version;`)
+	if err != nil {
+		return nil, wrapError("Error query", err)
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// runMigration выполняет скрипт и изменение schema_migrations в одной транзакции.
+func runMigration(ctx context.Context, conn *sql.Conn, script string, track string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Error begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, track, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+		"migrations/0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+		"migrations/0001_first.down.sql":  {Data: []byte("SELECT -1;")},
+		"migrations/0002_second.down.sql": {Data: []byte("SELECT -2;")},
+	}
+
+	migrations, err := loadMigrations(files, "migrations")
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "first", Up: "SELECT 1;", Down: "SELECT -1;"},
+		{Version: 2, Name: "second", Up: "SELECT 2;", Down: "SELECT -2;"},
+	}, migrations)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/0001_first.down.sql": {Data: []byte("SELECT -1;")},
+	}, "migrations")
+	require.Error(t, err)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/first.sql": {Data: []byte("SELECT 1;")},
+	}, "migrations")
+	require.Error(t, err)
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		require.Equal(t, i+1, migration.Version)
+		require.NotEmpty(t, migration.Down)
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator := Migrator{db: db, migrations: []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE first ();"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE second ();"},
+	}}
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1);`)).
+		WithArgs(migrationLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version FROM schema_migrations ORDER BY version;`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE second ();`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`)).
+		WithArgs(2, "second").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1);`)).
+		WithArgs(migrationLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, applied)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,14 @@
+-- IF NOT EXISTS оставлен для баз, созданных до появления миграций.
+CREATE TABLE IF NOT EXISTS users (
+	id           SERIAL PRIMARY KEY,
+	name         TEXT NOT NULL,
+	surname      TEXT NOT NULL,
+	age          INT NOT NULL,
+	gender       TEXT NOT NULL,
+	nationalize  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS emails (
+	user_id    INT NOT NULL,
+	email      TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE enrichment_cache (
+	key         TEXT PRIMARY KEY,
+	result      JSONB NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,11 @@
+-- Пользователи, созданные до асинхронного обогащения, уже заполнены.
+ALTER TABLE users ADD COLUMN enrichment_status TEXT NOT NULL DEFAULT 'complete';
+
+CREATE TABLE enrichment_jobs (
+	user_id     INT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	attempts    INT NOT NULL DEFAULT 0,
+	run_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error  TEXT
+);
+
+CREATE INDEX enrichment_jobs_run_at_idx ON enrichment_jobs (run_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_nationalities;
+
+ALTER TABLE users DROP COLUMN age_count;
+ALTER TABLE users DROP COLUMN gender_probability;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN gender_probability DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN age_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE user_nationalities (
+	user_id      INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	country      TEXT NOT NULL,
+	probability  DOUBLE PRECISION NOT NULL,
+	rank         INT NOT NULL,
+	PRIMARY KEY (user_id, country)
+);
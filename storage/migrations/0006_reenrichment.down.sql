@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS reenrichment_checkpoints;
+
+DROP INDEX IF EXISTS users_created_at_idx;
+
+ALTER TABLE users DROP COLUMN nationalize_source;
+ALTER TABLE users DROP COLUMN gender_source;
+ALTER TABLE users DROP COLUMN age_source;
+ALTER TABLE users DROP COLUMN created_at;
@@ -0,0 +1,20 @@
+-- Для существующих пользователей время создания неизвестно.
+ALTER TABLE users ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE users ADD COLUMN age_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN gender_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN nationalize_source TEXT NOT NULL DEFAULT '';
+
+-- Ручные правки до этой миграции не отличить, заполненные поля считаются
+-- полученными обогащением.
+UPDATE users SET age_source = 'enriched' WHERE age <> 0;
+UPDATE users SET gender_source = 'enriched' WHERE gender <> '';
+UPDATE users SET nationalize_source = 'enriched' WHERE nationalize <> '';
+
+CREATE INDEX users_created_at_idx ON users (created_at);
+
+CREATE TABLE reenrichment_checkpoints (
+	run         TEXT PRIMARY KEY,
+	last_id     INT NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- Версия строки для ETag и If-Match, увеличивается при каждом изменении пользователя.
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_audit;
+
+DROP FUNCTION IF EXISTS user_audit_immutable();
@@ -0,0 +1,52 @@
+-- История изменений пользователей. Внешнего ключа нет, что бы история
+-- оставалась после окончательного удаления пользователя.
+CREATE TABLE user_audit (
+	id          BIGSERIAL PRIMARY KEY,
+	user_id     INT NOT NULL,
+	action      TEXT NOT NULL,
+	actor       TEXT NOT NULL,
+	request_id  TEXT NOT NULL DEFAULT '',
+	changed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	-- {"поле": {"before": ..., "after": ...}} по json именам schemas.User.
+	changes     JSONB NOT NULL
+);
+
+CREATE INDEX user_audit_user_id_idx ON user_audit (user_id, changed_at, id);
+
+CREATE FUNCTION user_audit_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'user_audit records are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_audit_immutable BEFORE UPDATE OR DELETE ON user_audit
+	FOR EACH ROW EXECUTE FUNCTION user_audit_immutable();
+
+-- Прошлые изменения неизвестны, поэтому история существующих пользователей
+-- начинается с их текущего состояния.
+INSERT INTO user_audit (user_id, action, actor, changes)
+SELECT u.id, 'baseline', 'migration', (
+	SELECT jsonb_object_agg(field.key, jsonb_build_object('before', 'null'::jsonb, 'after', field.value))
+	FROM jsonb_each(jsonb_strip_nulls(jsonb_build_object(
+		'id', u.id,
+		'name', u.name,
+		'surname', u.surname,
+		'gender', u.gender,
+		'age', u.age,
+		'nationalize', u.nationalize,
+		'emails', (SELECT jsonb_agg(e.email) FROM emails e WHERE e.user_id = u.id),
+		'gender_probability', u.gender_probability,
+		'age_count', u.age_count,
+		'nationalities', (SELECT jsonb_agg(jsonb_build_object('country', n.country, 'probability', n.probability) ORDER BY n.rank)
+			FROM user_nationalities n WHERE n.user_id = u.id),
+		'enrichment_status', u.enrichment_status,
+		'sources', jsonb_strip_nulls(jsonb_build_object(
+			'age', NULLIF(u.age_source, ''),
+			'gender', NULLIF(u.gender_source, ''),
+			'nationalize', NULLIF(u.nationalize_source, ''))),
+		'created_at', u.created_at,
+		'deleted_at', u.deleted_at,
+		'version', u.version
+	))) AS field
+)
+FROM users u;
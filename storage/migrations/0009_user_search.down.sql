@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_surname_idx;
+DROP INDEX IF EXISTS emails_search_trgm_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS search_text;
+
+DROP FUNCTION IF EXISTS search_normalize(TEXT);
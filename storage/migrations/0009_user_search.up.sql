@@ -0,0 +1,27 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- search_normalize повторяет metadata.NameKey для каждого слова: нижний
+-- регистр, без диакритики, кириллица в латинице, j и y считаются i, x
+-- считается ks, повторы букв схлопываются. Так Пётр, Petr и Pyotr совпадают.
+-- Остальные символы становятся пробелами, что бы почта делилась на слова.
+-- unaccent с явным словарем, иначе функцию нельзя объявить IMMUTABLE для индексов.
+CREATE FUNCTION search_normalize(value TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+	SELECT trim(regexp_replace(regexp_replace(
+		replace(translate(translate(
+			replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(
+				lower(public.unaccent('public.unaccent'::regdictionary, value)),
+				'щ', 'shch'), 'ж', 'zh'), 'х', 'kh'), 'ц', 'ts'), 'ч', 'ch'), 'ш', 'sh'),
+				'ю', 'iu'), 'я', 'ia'), 'ъ', ''), 'ь', ''),
+			'абвгдеёзийклмнопрстуфыэіїєґ', 'abvgdeeziiklmnoprstufyeiieg'),
+			'jy', 'ii'), 'x', 'ks'),
+		'[^[:alpha:][:digit:]]+', ' ', 'g'), '(.)\1+', '\1', 'g'))
+$$;
+
+ALTER TABLE users ADD COLUMN search_text TEXT GENERATED ALWAYS AS (search_normalize(name || ' ' || surname)) STORED;
+
+CREATE INDEX users_search_trgm_idx ON users USING gin (search_text gin_trgm_ops);
+CREATE INDEX users_search_fts_idx ON users USING gin (to_tsvector('simple', search_text));
+CREATE INDEX emails_search_trgm_idx ON emails USING gin (search_normalize(email) gin_trgm_ops);
+CREATE INDEX users_surname_idx ON users (surname) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS emails_user_id_idx;
+DROP INDEX IF EXISTS emails_email_key;
+
+ALTER TABLE emails DROP CONSTRAINT IF EXISTS emails_user_id_fkey;
+ALTER TABLE emails DROP COLUMN IF EXISTS id;
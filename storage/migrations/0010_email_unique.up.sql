@@ -0,0 +1,19 @@
+-- Почты удаленных окончательно пользователей остались без владельца.
+DELETE FROM emails e WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = e.user_id);
+
+-- Нормализация как в storage.NormalizeEmail, кроме IDNA: адреса с
+-- национальными доменами приводятся к punycode при следующем изменении.
+UPDATE emails SET email = substring(trim(email) FROM '^(.*)@') || '@' || lower(substring(trim(email) FROM '@([^@]*)$'))
+WHERE position('@' IN email) > 0;
+
+ALTER TABLE emails ADD COLUMN id BIGSERIAL PRIMARY KEY;
+
+-- Повторяющийся адрес остается у пользователя, получившего его первым.
+DELETE FROM emails e USING emails first
+WHERE lower(e.email) = lower(first.email) AND (first.user_id, first.id) < (e.user_id, e.id);
+
+ALTER TABLE emails ADD CONSTRAINT emails_user_id_fkey
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX emails_email_key ON emails (lower(email));
+CREATE INDEX emails_user_id_idx ON emails (user_id);
@@ -0,0 +1,8 @@
+-- Ключи API для доступа к HTTP серверу. Хранится только sha256 ключа,
+-- отозванные ключи остаются, что бы имя нельзя было выдать другому ключу.
+CREATE TABLE api_keys (
+	name        TEXT PRIMARY KEY,
+	key_hash    TEXT NOT NULL UNIQUE,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revoked_at  TIMESTAMPTZ
+);
@@ -0,0 +1,5 @@
+CREATE OR REPLACE FUNCTION user_audit_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'user_audit records are immutable';
+END;
+$$ LANGUAGE plpgsql;
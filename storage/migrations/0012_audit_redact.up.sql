@@ -0,0 +1,21 @@
+-- Окончательное удаление должно стирать и данные пользователя в истории.
+-- Записи по-прежнему нельзя удалить или изменить, кроме очистки changes в
+-- транзакции, где purge установил app.audit_redact. Автор и время остаются.
+CREATE OR REPLACE FUNCTION user_audit_immutable() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'UPDATE' AND current_setting('app.audit_redact', true) = 'on'
+		AND NEW.changes = '{}'::jsonb
+		AND (NEW.id, NEW.user_id, NEW.action, NEW.actor, NEW.request_id, NEW.changed_at)
+			IS NOT DISTINCT FROM (OLD.id, OLD.user_id, OLD.action, OLD.actor, OLD.request_id, OLD.changed_at) THEN
+		RETURN NEW;
+	END IF;
+
+	RAISE EXCEPTION 'user_audit records are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+-- Пользователи, удаленные до этой миграции.
+SELECT set_config('app.audit_redact', 'on', true);
+UPDATE user_audit SET changes = '{}'
+WHERE changes <> '{}' AND user_id IN (SELECT user_id FROM user_audit WHERE action = 'purge');
+SELECT set_config('app.audit_redact', '', true);
@@ -0,0 +1,2 @@
+-- Задания повторного обогащения запрашивают провайдеров мимо кэша.
+ALTER TABLE enrichment_jobs ADD COLUMN refresh BOOLEAN NOT NULL DEFAULT false;
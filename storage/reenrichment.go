@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// ReenrichFilter выбирает пользователей для повторного обогащения. Условия
+// объединяются через И, пустой фильтр выбирает всех не удаленных.
+type ReenrichFilter struct {
+	// Хотя бы одно из полей возраст, пол, национальность не заполнено.
+	EmptyFields   bool
+	Nationalize   string
+	CreatedBefore *time.Time
+}
+
+// String описание фильтра, используется как имя запуска по умолчанию.
+func (filter *ReenrichFilter) String() string {
+	var parts []string
+	if filter.EmptyFields {
+		parts = append(parts, "empty_fields")
+	}
+	if filter.Nationalize != "" {
+		parts = append(parts, "nationalize="+filter.Nationalize)
+	}
+	if filter.CreatedBefore != nil {
+		parts = append(parts, "created_before="+filter.CreatedBefore.UTC().Format(time.RFC3339))
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, ",")
+}
+
+func (filter *ReenrichFilter) matches(user *schemas.User) bool {
+	if user.DeletedAt != nil {
+		return false
+	}
+	if filter.EmptyFields && user.Age != 0 && user.Gender != "" && user.Nationalize != "" {
+		return false
+	}
+	if filter.Nationalize != "" && user.Nationalize != filter.Nationalize {
+		return false
+	}
+	if filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// SelectForReenrichment возвращает до limit id пользователей больше afterID
+// по возрастанию.
+func (storage *Storage) SelectForReenrichment(ctx context.Context, filter *ReenrichFilter, afterID int, limit int) ([]int, error) {
+	conditions := []string{"u.deleted_at IS NULL", "u.id > $1"}
+	args := []interface{}{afterID}
+
+	if filter.EmptyFields {
+		conditions = append(conditions, "(u.age = 0 OR u.gender = '' OR u.nationalize = '')")
+	}
+	if filter.Nationalize != "" {
+		args = append(args, filter.Nationalize)
+		conditions = append(conditions, fmt.Sprintf("u.nationalize = $%d", len(args)))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("u.created_at < $%d", len(args)))
+	}
+	args = append(args, limit)
+
+	rows, err := storage.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT u.id FROM users u WHERE %s ORDER BY u.id LIMIT $%d;`, strings.Join(conditions, " AND "), len(args)),
+		args...)
+	if err != nil {
+		return nil, wrapError("Error query", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, wrapError("Error query", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("Error query", err)
+	}
+
+	return ids, nil
+}
+
+// EnqueueEnrichment ставит задания на обогащение и переводит пользователей
+// в статус schemas.EnrichmentPending. Уже стоящие в очереди не дублируются,
+// но тоже помечаются как повторные и не читают кэш.
+func (storage *Storage) EnqueueEnrichment(ctx context.Context, ids []int) error {
+	// Записи истории собираются в SQL, что бы не читать каждого пользователя.
+	info := auditInfo(ctx)
+	_, err := storage.db.ExecContext(ctx,
+		`WITH old AS (
+			SELECT id, enrichment_status, version FROM users
+			WHERE id = ANY($1::int[]) AND deleted_at IS NULL FOR UPDATE
+		), u AS (
+			UPDATE users SET enrichment_status = 'pending', version = users.version + 1
+			FROM old WHERE users.id = old.id
+			RETURNING users.id, old.enrichment_status AS old_status, old.version AS old_version, users.version
+		), jobs AS (
+			INSERT INTO enrichment_jobs (user_id, refresh) SELECT id, true FROM u
+			ON CONFLICT (user_id) DO UPDATE SET refresh = true
+		)
+		INSERT INTO user_audit (user_id, action, actor, request_id, changes)
+		SELECT id, 'reenrich', $2, $3, jsonb_build_object(
+			'enrichment_status', jsonb_build_object('before', old_status, 'after', 'pending'::text),
+			'version', jsonb_build_object('before', old_version, 'after', version))
+		FROM u;`,
+		pq.Array(ids), info.Actor, info.RequestID)
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	return nil
+}
+
+// GetCheckpoint возвращает последний обработанный id запуска run. ok false,
+// если запуск еще не начинался или был завершен.
+func (storage *Storage) GetCheckpoint(ctx context.Context, run string) (lastID int, ok bool, err error) {
+	err = storage.db.QueryRowContext(ctx,
+		`SELECT last_id FROM reenrichment_checkpoints WHERE run = $1;`,
+		run).Scan(&lastID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, wrapError("Error query", err)
+	}
+
+	return lastID, true, nil
+}
+
+func (storage *Storage) SaveCheckpoint(ctx context.Context, run string, lastID int) error {
+	_, err := storage.db.ExecContext(ctx,
+		`INSERT INTO reenrichment_checkpoints (run, last_id) VALUES ($1, $2)
+		ON CONFLICT (run) DO UPDATE SET last_id = EXCLUDED.last_id, updated_at = now();`,
+		run, lastID)
+	if err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	return nil
+}
+
+func (storage *Storage) DeleteCheckpoint(ctx context.Context, run string) error {
+	if _, err := storage.db.ExecContext(ctx, `DELETE FROM reenrichment_checkpoints WHERE run = $1;`, run); err != nil {
+		return wrapError("Error exec", err)
+	}
+
+	return nil
+}
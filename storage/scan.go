@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// userColumns колонки пользователя для scanUsers. Таблица или CTE с
+// пользователями в запросе должна иметь псевдоним u. Почты и национальности
+// собираются подзапросами, что бы страница читалась одним запросом.
+const userColumns = `u.id, u.name, u.surname, u.age, u.gender, u.nationalize, u.enrichment_status, u.deleted_at,
+	(SELECT array_agg(e.email ORDER BY e.id) FROM emails e WHERE e.user_id = u.id),
+	u.gender_probability, u.age_count,
+	u.age_source, u.gender_source, u.nationalize_source, u.created_at, u.version,
+	(SELECT json_agg(json_build_object('country', n.country, 'probability', n.probability) ORDER BY n.rank)
+		FROM user_nationalities n WHERE n.user_id = u.id)`
+
+// querier общая часть *sql.DB, *sql.Tx и *sql.Conn.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanUsers(rows *sql.Rows) ([]schemas.User, error) {
+	users := make([]schemas.User, 0)
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("Error query", err)
+	}
+
+	return users, nil
+}
+
+// scanUser читает текущую строку rows.
+func scanUser(rows *sql.Rows) (*schemas.User, error) {
+	user := schemas.User{}
+	var deletedAt sql.NullTime
+	var nationalities []byte
+
+	err := rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize,
+		&user.EnrichmentStatus, &deletedAt, pq.Array(&user.Emails),
+		&user.GenderProbability, &user.AgeCount,
+		&user.Sources.Age, &user.Sources.Gender, &user.Sources.Nationalize, &user.CreatedAt, &user.Version, &nationalities)
+	if err != nil {
+		return nil, err
+	}
+
+	if nationalities != nil {
+		if err := json.Unmarshal(nationalities, &user.Nationalities); err != nil {
+			return nil, fmt.Errorf("Error decode nationalities: %w", err)
+		}
+	}
+
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return &user, nil
+}
+
+// queryUsers выполняет запрос, выбирающий userColumns, и читает всех пользователей.
+func queryUsers(ctx context.Context, q querier, query string, args ...interface{}) ([]schemas.User, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError("Error query", err)
+	}
+	defer rows.Close()
+
+	return scanUsers(rows)
+}
+
+// getUser как queryUsers, но ожидает ровно одного пользователя.
+func getUser(ctx context.Context, q querier, query string, args ...interface{}) (*schemas.User, error) {
+	users, err := queryUsers(ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
+	}
+
+	return &users[0], nil
+}
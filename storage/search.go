@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	// searchThreshold минимальная похожесть слова на слово запроса для
+	// подсветки. Ниже word_similarity_threshold в pg_trgm, что бы найденное
+	// в базе с опечаткой, например Ivanow для Ivanov, тоже подсвечивалось.
+	searchThreshold = 0.5
+)
+
+// searchWord слово значения поля и его ключ для сравнения.
+type searchWord struct {
+	text string
+	key  string
+}
+
+// splitWords делит значение на слова из букв и цифр. Разделители остаются
+// отдельными частями без ключа, что бы собрать значение обратно.
+func splitWords(value string) []searchWord {
+	var words []searchWord
+	start := 0
+	inWord := false
+	flush := func(end int) {
+		if end > start {
+			word := searchWord{text: value[start:end]}
+			if inWord {
+				word.key = metadata.NameKey(word.text)
+			}
+			words = append(words, word)
+		}
+		start = end
+	}
+
+	for i, r := range value {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		if isWord != inWord {
+			flush(i)
+			inWord = isWord
+		}
+	}
+	flush(len(value))
+
+	return words
+}
+
+// searchTokens ключи слов запроса.
+func searchTokens(query string) []string {
+	var tokens []string
+	for _, word := range splitWords(query) {
+		if word.key != "" {
+			tokens = append(tokens, word.key)
+		}
+	}
+	return tokens
+}
+
+func trigrams(key string) map[string]bool {
+	padded := []rune("  " + key + " ")
+	result := make(map[string]bool, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		result[string(padded[i:i+3])] = true
+	}
+	return result
+}
+
+// wordSimilarity похожесть слов по триграммам, как similarity в pg_trgm.
+// Начало слова, например Iva для Ivanov, считается полным совпадением.
+func wordSimilarity(token string, key string) float64 {
+	if strings.HasPrefix(key, token) {
+		return 1
+	}
+
+	a, b := trigrams(token), trigrams(key)
+	common := 0
+	for trigram := range a {
+		if b[trigram] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// matchField считает для каждого слова запроса лучшую похожесть на слова
+// значения и подсвечивает похожие слова.
+func matchField(field string, value string, tokens []string) (schemas.SearchMatch, []float64) {
+	match := schemas.SearchMatch{Field: field, Value: value}
+	scores := make([]float64, len(tokens))
+	var highlight strings.Builder
+
+	for _, word := range splitWords(value) {
+		matched := false
+		if word.key != "" {
+			for i, token := range tokens {
+				score := wordSimilarity(token, word.key)
+				scores[i] = max(scores[i], score)
+				match.Score = max(match.Score, score)
+				matched = matched || score >= searchThreshold
+			}
+		}
+
+		text := html.EscapeString(word.text)
+		if matched {
+			text = "<mark>" + text + "</mark>"
+		}
+		highlight.WriteString(text)
+	}
+
+	match.Highlight = highlight.String()
+	return match, scores
+}
+
+type searchField struct {
+	name  string
+	value string
+}
+
+// searchResult оценивает пользователя: похожесть каждого слова запроса
+// берется по лучшему полю, оценка пользователя средняя по словам.
+func searchResult(user *schemas.User, tokens []string) schemas.SearchResult {
+	result := schemas.SearchResult{User: *user, Matches: make([]schemas.SearchMatch, 0)}
+	if len(tokens) == 0 {
+		return result
+	}
+
+	fields := []searchField{{"name", user.Name}, {"surname", user.Surname}}
+	for _, email := range user.Emails {
+		fields = append(fields, searchField{"emails", email})
+	}
+
+	best := make([]float64, len(tokens))
+	for _, field := range fields {
+		match, scores := matchField(field.name, field.value, tokens)
+		for i, score := range scores {
+			best[i] = max(best[i], score)
+		}
+		if match.Score >= searchThreshold {
+			result.Matches = append(result.Matches, match)
+		}
+	}
+
+	for _, score := range best {
+		result.Score += score
+	}
+	result.Score /= float64(len(tokens))
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Score > result.Matches[j].Score
+	})
+
+	return result
+}
+
+func searchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultSearchLimit
+	}
+	return min(limit, MaxSearchLimit)
+}
+
+// Search ищет пользователей по имени, фамилии и почте без учета регистра,
+// диакритики и способа транслитерации. Кандидатов находят индексы pg_trgm и
+// полнотекстовый поиск по users.search_text, совпавшие поля подсвечиваются.
+func (storage *Storage) Search(ctx context.Context, query string, limit int) ([]schemas.SearchResult, error) {
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return []schemas.SearchResult{}, nil
+	}
+
+	rows, err := storage.db.QueryContext(ctx, `
+		WITH q AS (
+			SELECT search_normalize($1) AS text, plainto_tsquery('simple', search_normalize($1)) AS ts
+		), matched AS (
+			SELECT u.id, CASE WHEN to_tsvector('simple', u.search_text) @@ q.ts THEN 1 ELSE word_similarity(q.text, u.search_text) END AS score
+			FROM users u, q
+			WHERE u.deleted_at IS NULL AND (q.text <% u.search_text OR to_tsvector('simple', u.search_text) @@ q.ts)
+			UNION ALL
+			SELECT e.user_id, word_similarity(q.text, search_normalize(e.email))
+			FROM emails e, q
+			WHERE q.text <% search_normalize(e.email)
+		)
+		SELECT m.id, max(m.score) AS score FROM matched m
+		JOIN users u ON u.id = m.id AND u.deleted_at IS NULL
+		GROUP BY m.id ORDER BY score DESC, m.id LIMIT $2;`,
+		query, searchLimit(limit))
+	if err != nil {
+		return nil, wrapError("Error query", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	scores := make(map[int]float64)
+	for rows.Next() {
+		var id int
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, wrapError("Error query", err)
+		}
+		ids = append(ids, int64(id))
+		scores[id] = score
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("Error query", err)
+	}
+
+	results := make([]schemas.SearchResult, 0, len(ids))
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	users, err := queryUsers(ctx, storage.db,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = ANY($1) AND u.deleted_at IS NULL;`,
+		pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*schemas.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	for _, id := range ids {
+		// Пользователь мог быть удален или помечен удаленным между запросами.
+		if user, ok := byID[int(id)]; ok {
+			result := searchResult(user, tokens)
+			result.Score = scores[int(id)]
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+func TestSearchResult(t *testing.T) {
+	user := &schemas.User{ID: 1, Name: "Пётр", Surname: "Иванов", Emails: []string{"petr.ivanov@test.com", "boss@test.com"}}
+
+	result := searchResult(user, searchTokens("ivanov PETR"))
+	require.Equal(t, 1.0, result.Score)
+	require.Equal(t, []schemas.SearchMatch{
+		{Field: "name", Value: "Пётр", Highlight: "<mark>Пётр</mark>", Score: 1},
+		{Field: "surname", Value: "Иванов", Highlight: "<mark>Иванов</mark>", Score: 1},
+		{Field: "emails", Value: "petr.ivanov@test.com", Highlight: "<mark>petr</mark>.<mark>ivanov</mark>@test.com", Score: 1},
+	}, result.Matches)
+
+	// Опечатка.
+	result = searchResult(user, searchTokens("Petr Ivanow"))
+	require.Greater(t, result.Score, searchThreshold)
+	require.Len(t, result.Matches, 3)
+	require.Equal(t, "surname", result.Matches[2].Field)
+	require.Equal(t, "<mark>Иванов</mark>", result.Matches[2].Highlight)
+
+	result = searchResult(user, searchTokens("Sidorov"))
+	require.Less(t, result.Score, searchThreshold)
+	require.Empty(t, result.Matches)
+}
+
+func TestSearch(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	mock.
+		ExpectQuery(`WITH q AS \(\s*SELECT search_normalize\(\$1\)`).
+		WithArgs("ivanov", DefaultSearchLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "score"}).AddRow(12, 1.0).AddRow(11, 0.7).AddRow(13, 0.5))
+	// Пользователь 13 помечен удаленным после первого запроса.
+	mock.
+		ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.id = ANY($1) AND u.deleted_at IS NULL;`)).
+		WillReturnRows(sqlmock.NewRows(userColumnNames).
+			AddRow(11, "Ivan", "Ivanova", 20, "", "", "complete", nil, nil, 0, 0, "", "", "", createdAt, 1, nil).
+			AddRow(12, "Петр", "Иванов", 30, "", "", "complete", nil, nil, 0, 0, "", "", "", createdAt, 1, nil),
+		)
+
+	results, err := storage.Search(context.Background(), "ivanov", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, 12, results[0].User.ID)
+	require.Equal(t, 1.0, results[0].Score)
+	require.Equal(t, "<mark>Иванов</mark>", results[0].Matches[0].Highlight)
+	require.Equal(t, 11, results[1].User.ID)
+	require.Equal(t, 0.7, results[1].Score)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemorySearch(t *testing.T) {
+	memory := NewMemory()
+	ctx := context.Background()
+
+	for _, user := range []schemas.User{
+		{Name: "Юлия", Surname: "Щербакова"},
+		{Name: "Julia", Surname: "Roberts", Emails: []string{"julia@test.com"}},
+		{Name: "Ivan", Surname: "Petrov"},
+	} {
+		_, err := memory.AddUser(ctx, &user)
+		require.NoError(t, err)
+	}
+
+	results, err := memory.Search(ctx, "yulia", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, []int{1, 2}, []int{results[0].User.ID, results[1].User.ID})
+
+	results, err = memory.Search(ctx, "shcherbakova julia", 1)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, 1, results[0].User.ID)
+
+	results, err = memory.Search(ctx, " - ", 0)
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	_, err = memory.DeleteUser(ctx, 2, 0)
+	require.NoError(t, err)
+	results, err = memory.Search(ctx, "yulia", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, 1, results[0].User.ID)
+}
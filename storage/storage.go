@@ -6,320 +6,436 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/metadata"
 	"github.com/nkhamm-spb/red_soft_test/schemas"
 )
 
 type StorageInterface interface {
 	GetUserById(ctx context.Context, id int) (*schemas.User, error)
-	GetUserBySurname(ctx context.Context, surname string) (*schemas.User, error)
+	GetUsersBySurname(ctx context.Context, surname string) ([]schemas.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*schemas.User, error)
+	Search(ctx context.Context, query string, limit int) ([]schemas.SearchResult, error)
+	// AddUser и EditUser нормализуют почты через NormalizeEmail и возвращают
+	// *EmailConflictError, если адрес занят другим пользователем.
 	AddUser(ctx context.Context, user *schemas.User) (*schemas.User, error)
 	GetAll(ctx context.Context) ([]schemas.User, error)
-	EditUser(ctx context.Context, id int, editData map[string]interface{}) (*schemas.User, error)
+	List(ctx context.Context, options *ListOptions) (*schemas.UserPage, error)
+	Export(ctx context.Context, options *ListOptions, fn func(user *schemas.User) error) error
+	// EditUser и DeleteUser возвращают ErrVersionMismatch, если version не 0
+	// и не совпадает с текущей версией пользователя.
+	EditUser(ctx context.Context, id int, patch *schemas.UserPatch, version int) (*schemas.User, error)
+	DeleteUser(ctx context.Context, id int, version int) (*schemas.User, error)
+	RestoreUser(ctx context.Context, id int) (*schemas.User, error)
+	PurgeUser(ctx context.Context, id int) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
+	BeginImport(ctx context.Context, atomic bool) (UserImport, error)
+
+	// Изменения пользователя пишутся в историю от имени автора из WithAuditInfo.
+	History(ctx context.Context, id int) ([]schemas.AuditRecord, error)
+	GetUserAsOf(ctx context.Context, id int, asOf time.Time) (*schemas.User, error)
+
+	ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]EnrichmentJob, error)
+	CompleteEnrichment(ctx context.Context, id int, result *metadata.Result, status string) error
+	RetryEnrichment(ctx context.Context, id int, delay time.Duration, lastError string) error
+
+	SelectForReenrichment(ctx context.Context, filter *ReenrichFilter, afterID int, limit int) ([]int, error)
+	EnqueueEnrichment(ctx context.Context, ids []int) error
+	GetCheckpoint(ctx context.Context, run string) (lastID int, ok bool, err error)
+	SaveCheckpoint(ctx context.Context, run string, lastID int) error
+	DeleteCheckpoint(ctx context.Context, run string) error
+
+	// Ключи API хранятся как sha256 в hex, см. auth.HashAPIKey.
+	FindAPIKey(ctx context.Context, hash string) (string, error)
+	CreateAPIKey(ctx context.Context, name string, hash string) error
+	RevokeAPIKey(ctx context.Context, name string) error
 }
 
 type Storage struct {
 	db *sql.DB
 }
 
+// Open создает хранилище, тип которого указан в конфиге.
+func Open(ctx context.Context, config *config.Storage) (StorageInterface, error) {
+	switch config.Type {
+	case "", "postgres":
+		return New(ctx, config)
+	case "memory":
+		log.Printf("Using in-memory storage")
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("Unknown storage type: %s", config.Type)
+	}
+}
+
 func New(ctx context.Context, config *config.Storage) (*Storage, error) {
-	db, err := sql.Open("postgres",
-		fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable",
-			config.User, config.Password, config.Name))
+	db, err := connect(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("Error open db: %v", err)
+		return nil, err
 	}
 
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("Error ping database: %v", err)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	createTables := `
-		CREATE TABLE IF NOT EXISTS users (
-			id           SERIAL PRIMARY KEY,
-			name         TEXT NOT NULL,
-			surname      TEXT NOT NULL,
-			age          INT NOT NULL,
-			gender       TEXT NOT NULL,
-			nationalize  TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS emails (
-			user_id    INT NOT NULL,
-			email      TEXT NOT NULL
-		);`
-
-	if _, err := db.ExecContext(ctx, createTables); err != nil {
-		return nil, fmt.Errorf("Error create table: %v", err)
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error migrate database: %w", err)
 	}
 
-	log.Printf("Connected to db!")
+	log.Printf("Connected to db! Applied migrations: %d", applied)
 
 	return &Storage{db}, nil
 }
 
-func (storage *Storage) GetUserById(ctx context.Context, id int) (*schemas.User, error) {
-	user := schemas.User{}
-
-	err := storage.db.QueryRowContext(ctx,
-		`SELECT id, name, surname, age, gender, nationalize FROM users WHERE id = $1;`,
-		id).Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize)
+func connect(ctx context.Context, config *config.Storage) (*sql.DB, error) {
+	db, err := sql.Open("postgres",
+		fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable",
+			config.User, config.Password, config.Name))
 	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
+		return nil, fmt.Errorf("Error open db: %w", err)
 	}
 
-	rows, err := storage.db.QueryContext(ctx,
-		`SELECT email FROM emails WHERE user_id = $1;`,
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("Error ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+func (storage *Storage) GetUserById(ctx context.Context, id int) (*schemas.User, error) {
+	return getUser(ctx, storage.db,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL;`,
 		id)
+}
+
+// GetUsersBySurname возвращает всех пользователей с фамилией surname по
+// возрастанию id.
+func (storage *Storage) GetUsersBySurname(ctx context.Context, surname string) ([]schemas.User, error) {
+	users, err := queryUsers(ctx, storage.db,
+		`SELECT `+userColumns+` FROM users u WHERE u.surname = $1 AND u.deleted_at IS NULL ORDER BY u.id;`,
+		surname)
 	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var email string
-		if err := rows.Scan(&email); err != nil {
-			return nil, err
-		}
-		user.Emails = append(user.Emails, email)
+	if len(users) == 0 {
+		return nil, fmt.Errorf("User not found: %w", ErrNotFound)
 	}
-
-	return &user, nil
+	return users, nil
 }
 
-func (storage *Storage) GetUserBySurname(ctx context.Context, surname string) (*schemas.User, error) {
-	user := schemas.User{}
-
-	err := storage.db.QueryRowContext(ctx,
-		`SELECT id, name, surname, age, gender, nationalize FROM users WHERE surname = $1;`,
-		surname).Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize)
-	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
+// AddUser создает пользователя. Для пользователя в статусе
+// schemas.EnrichmentPending в той же транзакции ставится задание на обогащение.
+func (storage *Storage) AddUser(ctx context.Context, user *schemas.User) (*schemas.User, error) {
+	if user.EnrichmentStatus == "" {
+		user.EnrichmentStatus = schemas.EnrichmentComplete
 	}
 
-	rows, err := storage.db.QueryContext(ctx,
-		`SELECT email FROM emails WHERE user_id = $1;`,
-		user.ID)
+	emails, err := normalizeEmails(user.Emails)
 	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
+		return nil, err
 	}
-	defer rows.Close()
+	user.Emails = emails
 
-	for rows.Next() {
-		var email string
-		if err := rows.Scan(&email); err != nil {
-			return nil, err
-		}
-		user.Emails = append(user.Emails, email)
+	err = storage.inTx(ctx, func(tx *sql.Tx) error {
+		return addUser(ctx, tx, user)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-func (storage *Storage) AddUser(ctx context.Context, user *schemas.User) (*schemas.User, error) {
-	err := storage.db.QueryRowContext(ctx,
-		`INSERT INTO users (name, surname, age, gender, nationalize) VALUES ($1, $2, $3, $4, $5) RETURNING id;`,
-		user.Name, user.Surname, user.Age, user.Gender, user.Nationalize).Scan(&user.ID)
+// addUser вставляет пользователя с уже нормализованными почтами в транзакции tx.
+func addUser(ctx context.Context, tx *sql.Tx, user *schemas.User) error {
+	if err := checkEmails(ctx, tx, 0, user.Emails); err != nil {
+		return err
+	}
+
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO users (name, surname, age, gender, nationalize, enrichment_status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, version;`,
+		user.Name, user.Surname, user.Age, user.Gender, user.Nationalize, user.EnrichmentStatus).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
+		return wrapError("Error query", err)
 	}
 
-	for _, email := range user.Emails {
-		_, err := storage.db.ExecContext(ctx,
-			`INSERT INTO emails (user_id, email) VALUES ($1, $2);`,
-			user.ID, email)
+	if err := insertEmails(ctx, tx, user.ID, user.Emails); err != nil {
+		return err
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("Error query: %v", err)
+	if user.EnrichmentStatus == schemas.EnrichmentPending {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO enrichment_jobs (user_id) VALUES ($1);`, user.ID); err != nil {
+			return wrapError("Error exec", err)
 		}
 	}
 
-	return user, nil
+	return writeAudit(ctx, tx, schemas.AuditCreate, nil, user)
 }
 
 func (storage *Storage) GetAll(ctx context.Context) ([]schemas.User, error) {
-	users := make([]schemas.User, 0)
+	return queryUsers(ctx, storage.db,
+		`SELECT `+userColumns+` FROM users u WHERE u.deleted_at IS NULL ORDER BY u.id;`)
+}
 
-	rows, err := storage.db.QueryContext(ctx,
-		`SELECT id, name, surname, age, gender, nationalize FROM users`)
+func (storage *Storage) List(ctx context.Context, options *ListOptions) (*schemas.UserPage, error) {
+	query, err := buildListQuery(options)
 	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		user := schemas.User{}
-		if err := rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize); err != nil {
-			return nil, err
-		}
-		users = append(users, user)
+	users, err := queryUsers(ctx, storage.db, query.pageSQL, query.pageArgs...)
+	if err != nil {
+		return nil, err
 	}
 
-	for i := 0; i < len(users); i++ {
-		emailRows, err := storage.db.QueryContext(ctx,
-			`SELECT email FROM emails WHERE user_id = $1;`,
-			users[i].ID)
-		if err != nil {
-			return nil, fmt.Errorf("Error query: %v", err)
+	page := schemas.UserPage{Items: users}
+
+	if len(page.Items) > options.Limit {
+		page.Items = page.Items[:options.Limit]
+		if page.NextCursor, err = encodeCursor(query.sort, &page.Items[len(page.Items)-1]); err != nil {
+			return nil, err
 		}
+	}
 
-		for emailRows.Next() {
-			var email string
-			if err := emailRows.Scan(&email); err != nil {
-				return nil, err
-			}
-			users[i].Emails = append(users[i].Emails, email)
+	if options.WithTotal {
+		var total int
+		if err := storage.db.QueryRowContext(ctx, query.countSQL, query.countArgs...).Scan(&total); err != nil {
+			return nil, wrapError("Error query", err)
 		}
-		emailRows.Close()
+		page.Total = &total
 	}
 
-	return users, nil
+	return &page, nil
 }
 
-func (storage *Storage) EditUser(ctx context.Context, id int, editData map[string]interface{}) (*schemas.User, error) {
-	tx, err := storage.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error begin transaction: %v", err)
+// EditUser применяет patch к пользователю. Возраст, пол и национальность,
+// заданные вручную, помечаются schemas.SourceManual.
+func (storage *Storage) EditUser(ctx context.Context, id int, patch *schemas.UserPatch, version int) (*schemas.User, error) {
+	var emails []string
+	if patch.Emails != nil {
+		var err error
+		if emails, err = normalizeEmails(*patch.Emails); err != nil {
+			return nil, err
+		}
 	}
-	defer tx.Rollback()
 
-	if emails, ok := editData["Emails"]; ok {
-		_, err = tx.ExecContext(ctx,
-			`DELETE FROM emails WHERE user_id = $1;`,
-			id)
-		if err != nil {
-			return nil, fmt.Errorf("Error exec: %v", err)
+	updates := []string{"version = version + 1"}
+	var args []interface{}
+
+	set := func(column string, value interface{}, source string) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", column, len(args)))
+		if source != "" {
+			updates = append(updates, source+" = '"+schemas.SourceManual+"'")
 		}
+	}
 
-		listEmails, ok := emails.([]interface{})
+	if patch.Name != nil {
+		set("name", *patch.Name, "")
+	}
+	if patch.Surname != nil {
+		set("surname", *patch.Surname, "")
+	}
+	if patch.Gender != nil {
+		set("gender", *patch.Gender, "gender_source")
+	}
+	if patch.Age != nil {
+		set("age", *patch.Age, "age_source")
+	}
+	if patch.Nationalize != nil {
+		set("nationalize", *patch.Nationalize, "nationalize_source")
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d;", strings.Join(updates, ", "), len(args))
 
-		if !ok {
-			return nil, fmt.Errorf("Wrong format for Emails")
+	var user *schemas.User
+	err := storage.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, false, version)
+		if err != nil {
+			return err
 		}
 
-		for _, email := range listEmails {
-			stringEmail, ok := email.(string)
-			if !ok {
-				return nil, fmt.Errorf("Wrong format for Emails")
+		if patch.Emails != nil {
+			if err := checkEmails(ctx, tx, id, emails); err != nil {
+				return err
 			}
 
-			_, err := tx.ExecContext(ctx,
-				`INSERT INTO emails (user_id, email) VALUES ($1, $2);`,
-				id, stringEmail)
+			if _, err := tx.ExecContext(ctx, `DELETE FROM emails WHERE user_id = $1;`, id); err != nil {
+				return wrapError("Error exec", err)
+			}
 
-			if err != nil {
-				return nil, fmt.Errorf("Error exec: %v", err)
+			if err := insertEmails(ctx, tx, id, emails); err != nil {
+				return err
 			}
 		}
-	}
 
-	var updates []string
-	var args []interface{}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return wrapError("Error exec", err)
+		}
 
-	queryCounter := 1
+		user, err = auditUser(ctx, tx, schemas.AuditEdit, before)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if name, ok := editData["name"]; ok {
-		stringName, ok := name.(string)
+	return user, nil
+}
 
-		if !ok {
-			return nil, fmt.Errorf("Wrong format for name")
-		}
+// DeleteUser помечает пользователя удаленным. До вызова PurgeUser или
+// PurgeDeleted его можно вернуть через RestoreUser.
+func (storage *Storage) DeleteUser(ctx context.Context, id int, version int) (*schemas.User, error) {
+	return storage.setDeleted(ctx, id, false, version,
+		`UPDATE users SET deleted_at = now(), version = version + 1 WHERE id = $1;`, schemas.AuditDelete)
+}
 
-		updates = append(updates, fmt.Sprintf("name = $%d", queryCounter))
-		args = append(args, stringName)
-		queryCounter++
-	}
+func (storage *Storage) RestoreUser(ctx context.Context, id int) (*schemas.User, error) {
+	return storage.setDeleted(ctx, id, true, 0,
+		`UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1;`, schemas.AuditRestore)
+}
 
-	if surname, ok := editData["surname"]; ok {
-		stringSurname, ok := surname.(string)
+// setDeleted выполняет query для пользователя, найденного lockUser, и пишет
+// изменение в историю.
+func (storage *Storage) setDeleted(ctx context.Context, id int, deleted bool, version int, query string, action string) (*schemas.User, error) {
+	var user *schemas.User
+	err := storage.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, deleted, version)
+		if err != nil {
+			return err
+		}
 
-		if !ok {
-			return nil, fmt.Errorf("Wrong format for surname")
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return wrapError("Error exec", err)
 		}
 
-		updates = append(updates, fmt.Sprintf("surname = $%d", queryCounter))
-		args = append(args, stringSurname)
-		queryCounter++
+		user, err = auditUser(ctx, tx, action, before)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if gender, ok := editData["gender"]; ok {
-		stringGender, ok := gender.(string)
+	return user, nil
+}
 
-		if !ok {
-			return nil, fmt.Errorf("Wrong format for gender")
-		}
+// lockUser читает пользователя с блокировкой строки до конца транзакции,
+// поэтому версия и состояние не изменятся до записи. deleted выбирает
+// удаленных или неудаленных пользователей, version не 0 проверяется.
+func lockUser(ctx context.Context, tx *sql.Tx, id int, deleted bool, version int) (*schemas.User, error) {
+	condition := "u.deleted_at IS NULL"
+	if deleted {
+		condition = "u.deleted_at IS NOT NULL"
+	}
 
-		updates = append(updates, fmt.Sprintf("gender = $%d", queryCounter))
-		args = append(args, stringGender)
-		queryCounter++
+	user, err := getUser(ctx, tx,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = $1 AND `+condition+` FOR UPDATE;`,
+		id)
+	if err != nil {
+		return nil, err
 	}
 
-	if age, ok := editData["age"]; ok {
-		floatAge, ok := age.(float64)
+	if version != 0 && version != user.Version {
+		return nil, fmt.Errorf("User version is %d, expected %d: %w", user.Version, version, ErrVersionMismatch)
+	}
+	return user, nil
+}
 
-		if !ok {
-			return nil, fmt.Errorf("Wrong format for age")
-		}
+// auditUser читает пользователя после изменения и пишет разницу с before
+// в историю в той же транзакции.
+func auditUser(ctx context.Context, tx *sql.Tx, action string, before *schemas.User) (*schemas.User, error) {
+	user, err := getUser(ctx, tx,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = $1;`,
+		before.ID)
+	if err != nil {
+		return nil, err
+	}
 
-		updates = append(updates, fmt.Sprintf("age = $%d", queryCounter))
-		args = append(args, int(floatAge))
-		queryCounter++
+	if err := writeAudit(ctx, tx, action, before, user); err != nil {
+		return nil, err
 	}
 
-	if nationalize, ok := editData["nationalize"]; ok {
-		stringNationalize, ok := nationalize.(string)
+	return user, nil
+}
 
-		if !ok {
-			return nil, fmt.Errorf("Wrong format for nationalize")
+// PurgeUser безвозвратно удаляет мягко удаленного пользователя, почты
+// удаляются каскадно. Неудаленного пользователя сначала нужно удалить через
+// DeleteUser, иначе ErrConflict. Из истории стираются данные пользователя,
+// остаются только действия, авторы и время, и добавляется запись об удалении.
+func (storage *Storage) PurgeUser(ctx context.Context, id int) error {
+	return storage.inTx(ctx, func(tx *sql.Tx) error {
+		var deleted bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT deleted_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE;`, id).Scan(&deleted)
+		if err != nil {
+			return wrapError("Error query", err)
+		}
+		if !deleted {
+			return fmt.Errorf("User is not deleted: %w", ErrConflict)
 		}
 
-		updates = append(updates, fmt.Sprintf("nationalize = $%d", queryCounter))
-		args = append(args, stringNationalize)
-		queryCounter++
-	}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL;`, id); err != nil {
+			return wrapError("Error exec", err)
+		}
 
-	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d;", strings.Join(updates, ", "), queryCounter)
-	args = append(args, id)
-	log.Println(query)
+		if err := redactAudit(ctx, tx); err != nil {
+			return err
+		}
 
-	_, err = tx.ExecContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("Error exec: %v", err)
-	}
+		info := auditInfo(ctx)
+		_, err = tx.ExecContext(ctx,
+			`WITH redacted AS (UPDATE user_audit SET changes = '{}' WHERE user_id = $1)
+			INSERT INTO user_audit (user_id, action, actor, request_id, changes) VALUES ($1, 'purge', $2, $3, '{}');`,
+			id, info.Actor, info.RequestID)
+		if err != nil {
+			return wrapError("Error exec", err)
+		}
 
-	user := schemas.User{}
+		return nil
+	})
+}
 
-	// Дублирование так как нужно получать пользователя через транзакцию.
-	// TODO: Убрать дублирование с помощью generic
-	err = tx.QueryRowContext(ctx,
-		`SELECT id, name, surname, age, gender, nationalize FROM users WHERE id = $1;`,
-		id).Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize)
-	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
-	}
+// PurgeDeleted безвозвратно удаляет пользователей, помеченных удаленными раньше
+// before. Удаление, очистка истории и записи о purge делаются одним запросом.
+func (storage *Storage) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	err := storage.inTx(ctx, func(tx *sql.Tx) error {
+		if err := redactAudit(ctx, tx); err != nil {
+			return err
+		}
 
-	rows, err := tx.QueryContext(ctx,
-		`SELECT email FROM emails WHERE user_id = $1;`,
-		id)
-	if err != nil {
-		return nil, fmt.Errorf("Error query: %v", err)
-	}
-	defer rows.Close()
+		info := auditInfo(ctx)
+		result, err := tx.ExecContext(ctx,
+			`WITH purged AS (DELETE FROM users WHERE deleted_at < $1 RETURNING id),
+			redacted AS (UPDATE user_audit SET changes = '{}' WHERE user_id IN (SELECT id FROM purged))
+			INSERT INTO user_audit (user_id, action, actor, request_id, changes)
+			SELECT id, 'purge', $2, $3, '{}' FROM purged;`,
+			before, info.Actor, info.RequestID)
+		if err != nil {
+			return wrapError("Error exec", err)
+		}
 
-	for rows.Next() {
-		var email string
-		if err := rows.Scan(&email); err != nil {
-			return nil, err
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return wrapError("Error exec", err)
 		}
-		user.Emails = append(user.Emails, email)
-	}
+		purged = int(affected)
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("Error commit: %v", err)
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
-	log.Printf("transaction committed")
 
-	return &user, nil
+	return purged, nil
 }
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+)
+
+// Бенчмарки считают запросы к базе на одну операцию (метрика queries/op).
+// Вариант n+1 воспроизводит загрузку почт отдельным запросом на каждого
+// пользователя, как было до общего scanUsers, для сравнения.
+
+const benchUsers = 100
+
+func BenchmarkGetAll(b *testing.B) {
+	b.Run("n+1", func(b *testing.B) {
+		db, queries := openCountingDB(benchUsers)
+		defer db.Close()
+
+		runCounted(b, queries, func() error {
+			_, err := legacyGetAll(context.Background(), db)
+			return err
+		})
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		db, queries := openCountingDB(benchUsers)
+		defer db.Close()
+		storage := Storage{db: db}
+
+		runCounted(b, queries, func() error {
+			_, err := storage.GetAll(context.Background())
+			return err
+		})
+	})
+}
+
+func BenchmarkGetUserById(b *testing.B) {
+	b.Run("n+1", func(b *testing.B) {
+		db, queries := openCountingDB(1)
+		defer db.Close()
+
+		runCounted(b, queries, func() error {
+			_, err := legacyGetUserById(context.Background(), db, 1)
+			return err
+		})
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		db, queries := openCountingDB(1)
+		defer db.Close()
+		storage := Storage{db: db}
+
+		runCounted(b, queries, func() error {
+			_, err := storage.GetUserById(context.Background(), 1)
+			return err
+		})
+	})
+}
+
+func runCounted(b *testing.B, queries *int64, fn func() error) {
+	b.ReportAllocs()
+	atomic.StoreInt64(queries, 0)
+
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, fn())
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(queries))/float64(b.N), "queries/op")
+}
+
+func legacyGetUserById(ctx context.Context, db *sql.DB, id int) (*schemas.User, error) {
+	user := schemas.User{}
+
+	err := db.QueryRowContext(ctx,
+		`SELECT id, name, surname, age, gender, nationalize FROM users WHERE id = $1;`,
+		id).Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Emails, err = legacyEmails(ctx, db, user.ID)
+	return &user, err
+}
+
+func legacyGetAll(ctx context.Context, db *sql.DB) ([]schemas.User, error) {
+	users := make([]schemas.User, 0)
+
+	rows, err := db.QueryContext(ctx, `SELECT id, name, surname, age, gender, nationalize FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := schemas.User{}
+		if err := rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Age, &user.Gender, &user.Nationalize); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	for i := range users {
+		if users[i].Emails, err = legacyEmails(ctx, db, users[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+func legacyEmails(ctx context.Context, db *sql.DB, id int) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT email FROM emails WHERE user_id = $1;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// countingConnector драйвер-заглушка, отвечающий на запросы пользователей
+// фиксированными строками и считающий количество запросов.
+type countingConnector struct {
+	users   int
+	queries *int64
+}
+
+func openCountingDB(users int) (*sql.DB, *int64) {
+	queries := new(int64)
+	return sql.OpenDB(&countingConnector{users: users, queries: queries}), queries
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &countingConn{c}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+	return nil
+}
+
+type countingConn struct {
+	connector *countingConnector
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare is not supported")
+}
+
+func (c *countingConn) Close() error {
+	return nil
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt64(c.connector.queries, 1)
+
+	users := c.connector.users
+	if len(args) > 0 && !strings.Contains(query, "FROM emails WHERE user_id") {
+		users = 1
+	}
+
+	switch {
+	case strings.Contains(query, "array_agg"):
+		rows := &countingRows{columns: []string{"id", "name", "surname", "age", "gender", "nationalize", "deleted_at", "emails"}}
+		for id := 1; id <= users; id++ {
+			rows.data = append(rows.data, []driver.Value{int64(id), "Test", "Testovich", int64(20), "male", "RU", nil,
+				fmt.Sprintf("{user%d@test.com,user%d@other.com}", id, id)})
+		}
+		return rows, nil
+	case strings.HasPrefix(query, "SELECT email"):
+		id := args[0].Value
+		return &countingRows{columns: []string{"email"}, data: [][]driver.Value{
+			{fmt.Sprintf("user%v@test.com", id)}, {fmt.Sprintf("user%v@other.com", id)},
+		}}, nil
+	default:
+		rows := &countingRows{columns: []string{"id", "name", "surname", "age", "gender", "nationalize"}}
+		for id := 1; id <= users; id++ {
+			rows.data = append(rows.data, []driver.Value{int64(id), "Test", "Testovich", int64(20), "male", "RU"})
+		}
+		return rows, nil
+	}
+}
+
+type countingRows struct {
+	columns []string
+	data    [][]driver.Value
+	next    int
+}
+
+func (r *countingRows) Columns() []string {
+	return r.columns
+}
+
+func (r *countingRows) Close() error {
+	return nil
+}
+
+func (r *countingRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.next])
+	r.next++
+	return nil
+}
@@ -2,8 +2,10 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/require"
@@ -11,6 +13,11 @@ import (
 	"github.com/nkhamm-spb/red_soft_test/schemas"
 )
 
+var userColumnNames = []string{"id", "name", "surname", "age", "gender", "nationalize", "enrichment_status", "deleted_at", "emails",
+	"gender_probability", "age_count", "age_source", "gender_source", "nationalize_source", "created_at", "version", "nationalities"}
+
+var createdAt = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
 func TestGetUserById(t *testing.T) {
 	db, mock, err := sqlmock.New(
 		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
@@ -20,28 +27,25 @@ func TestGetUserById(t *testing.T) {
 	storage := Storage{db: db}
 
 	mock.
-		ExpectQuery(regexp.QuoteMeta(`SELECT id, name, surname, age, gender, nationalize FROM users WHERE id = $1;`)).
+		ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL;`)).
 		WithArgs(11).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "age", "gender", "nationalize"}).
-			AddRow(11, "Test", "Testovich", 20, "Male", "Russian"),
+		WillReturnRows(sqlmock.NewRows(userColumnNames).
+			AddRow(11, "Test", "Testovich", 20, "Male", "Russian", "complete", nil, "{test_testovich@test.com}", 0, 0,
+				"enriched", "manual", "enriched", createdAt, 1, nil),
 		)
 
-	mock.
-		ExpectQuery(regexp.QuoteMeta(`SELECT email FROM emails WHERE user_id = $1;`)).
-		WithArgs(11).
-		WillReturnRows(sqlmock.NewRows([]string{"email"}).
-			AddRow("test_testovich@test.com"))
-
 	got, err := storage.GetUserById(context.Background(), 11)
 	require.NoError(t, err)
 	require.Equal(t, schemas.User{ID: 11, Name: "Test", Surname: "Testovich",
 		Age: 20, Gender: "Male", Nationalize: "Russian",
-		Emails: []string{"test_testovich@test.com"}}, *got)
+		Emails: []string{"test_testovich@test.com"}, EnrichmentStatus: schemas.EnrichmentComplete,
+		Sources:   schemas.FieldSources{Age: schemas.SourceEnriched, Gender: schemas.SourceManual, Nationalize: schemas.SourceEnriched},
+		CreatedAt: createdAt, Version: 1}, *got)
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestGetUserBySurname(t *testing.T) {
+func TestGetUsersBySurname(t *testing.T) {
 	db, mock, err := sqlmock.New(
 		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
 	)
@@ -50,23 +54,32 @@ func TestGetUserBySurname(t *testing.T) {
 	storage := Storage{db: db}
 
 	mock.
-		ExpectQuery(regexp.QuoteMeta(`SELECT id, name, surname, age, gender, nationalize FROM users WHERE surname = $1;`)).
+		ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.surname = $1 AND u.deleted_at IS NULL ORDER BY u.id;`)).
 		WithArgs("Testovich").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "age", "gender", "nationalize"}).
-			AddRow(11, "Test", "Testovich", 20, "Male", "Russian"),
+		WillReturnRows(sqlmock.NewRows(userColumnNames).
+			AddRow(11, "Test", "Testovich", 20, "Male", "Russian", "complete", nil, "{test_testovich@test.com}", 0, 0,
+				"enriched", "manual", "enriched", createdAt, 1, nil).
+			AddRow(12, "Other", "Testovich", 30, "Female", "Russian", "complete", nil, nil, 0, 0,
+				"", "", "", createdAt, 1, nil),
 		)
 
-	mock.
-		ExpectQuery(regexp.QuoteMeta(`SELECT email FROM emails WHERE user_id = $1;`)).
-		WithArgs(11).
-		WillReturnRows(sqlmock.NewRows([]string{"email"}).
-			AddRow("test_testovich@test.com"))
-
-	got, err := storage.GetUserBySurname(context.Background(), "Testovich")
+	got, err := storage.GetUsersBySurname(context.Background(), "Testovich")
 	require.NoError(t, err)
+	require.Len(t, got, 2)
 	require.Equal(t, schemas.User{ID: 11, Name: "Test", Surname: "Testovich",
 		Age: 20, Gender: "Male", Nationalize: "Russian",
-		Emails: []string{"test_testovich@test.com"}}, *got)
+		Emails: []string{"test_testovich@test.com"}, EnrichmentStatus: schemas.EnrichmentComplete,
+		Sources:   schemas.FieldSources{Age: schemas.SourceEnriched, Gender: schemas.SourceManual, Nationalize: schemas.SourceEnriched},
+		CreatedAt: createdAt, Version: 1}, got[0])
+	require.Equal(t, 12, got[1].ID)
+
+	mock.
+		ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.surname = $1`)).
+		WithArgs("Nobody").
+		WillReturnRows(sqlmock.NewRows(userColumnNames))
+
+	_, err = storage.GetUsersBySurname(context.Background(), "Nobody")
+	require.ErrorIs(t, err, ErrNotFound)
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -79,25 +92,278 @@ func TestAddUser(t *testing.T) {
 	defer db.Close()
 	storage := Storage{db: db}
 
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery(regexp.QuoteMeta(`SELECT e.email, e.user_id FROM emails e WHERE lower(e.email) = ANY($1) AND e.user_id <> $2`)).
+		WithArgs(`{"test_testovich@test.com","second@test.com"}`, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}))
 	mock.
-		ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (name, surname, age, gender, nationalize) VALUES ($1, $2, $3, $4, $5) RETURNING id;`)).
-		WithArgs("Test", "Testovich", 20, "Male", "Russian").
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).
-			AddRow(11),
+		ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (name, surname, age, gender, nationalize, enrichment_status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, version;`)).
+		WithArgs("Test", "Testovich", 20, "Male", "Russian", "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).
+			AddRow(11, createdAt, 1),
 		)
 
 	mock.
-		ExpectExec(regexp.QuoteMeta(`INSERT INTO emails (user_id, email) VALUES ($1, $2);`)).
-		WithArgs(11, "test_testovich@test.com").
+		ExpectExec(regexp.QuoteMeta(`INSERT INTO emails (user_id, email) SELECT $1, e.email FROM unnest($2::text[]) WITH ORDINALITY`)).
+		WithArgs(11, `{"Test_Testovich@test.com","second@test.com"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec(regexp.QuoteMeta(`INSERT INTO enrichment_jobs (user_id) VALUES ($1);`)).
+		WithArgs(11).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec(regexp.QuoteMeta(`INSERT INTO user_audit (user_id, action, actor, request_id, changes) VALUES ($1, $2, $3, $4, $5);`)).
+		WithArgs(11, "create", "admin", "request-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	user := schemas.User{Name: "Test", Surname: "Testovich",
 		Age: 20, Gender: "Male", Nationalize: "Russian",
-		Emails: []string{"test_testovich@test.com"}}
+		Emails: []string{" Test_Testovich@TEST.com ", "second@test.com"}, EnrichmentStatus: schemas.EnrichmentPending}
 
-	got, err := storage.AddUser(context.Background(), &user)
+	ctx := WithAuditInfo(context.Background(), AuditInfo{Actor: "admin", RequestID: "request-1"})
+	got, err := storage.AddUser(ctx, &user)
 	require.NoError(t, err)
 	require.Equal(t, user, *got)
+	require.Equal(t, []string{"Test_Testovich@test.com", "second@test.com"}, got.Emails)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEditUser(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	userRows := func(version int, email string) *sqlmock.Rows {
+		return sqlmock.NewRows(userColumnNames).
+			AddRow(11, "Test", "Testovich", 20, "female", "RU", "complete", nil, "{"+email+"}", 0, 0,
+				"enriched", "manual", "enriched", createdAt, version, nil)
+	}
+	lockQuery := regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL FOR UPDATE;`)
+	auditQuery := regexp.QuoteMeta(`INSERT INTO user_audit (user_id, action, actor, request_id, changes) VALUES ($1, $2, $3, $4, $5);`)
+	emailsQuery := regexp.QuoteMeta(`SELECT e.email, e.user_id FROM emails e WHERE lower(e.email) = ANY($1) AND e.user_id <> $2`)
+
+	// Изменение только почт тоже увеличивает версию.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).
+		WithArgs(11).
+		WillReturnRows(userRows(1, "old@test.com"))
+	mock.ExpectQuery(emailsQuery).
+		WithArgs(`{"new@test.com"}`, 11).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM emails WHERE user_id = $1;`)).
+		WithArgs(11).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO emails (user_id, email) SELECT $1, e.email FROM unnest($2::text[]) WITH ORDINALITY`)).
+		WithArgs(11, `{"new@test.com"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET version = version + 1 WHERE id = $1;`)).
+		WithArgs(11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.id = $1;`)).
+		WithArgs(11).
+		WillReturnRows(userRows(2, "new@test.com"))
+	mock.ExpectExec(auditQuery).
+		WithArgs(11, "edit", "system", "",
+			[]byte(`{"emails":{"before":["old@test.com"],"after":["new@test.com"]},"version":{"before":1,"after":2}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	got, err := storage.EditUser(context.Background(), 11, &schemas.UserPatch{Emails: &[]string{"new@test.com"}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"new@test.com"}, got.Emails)
+
+	gender := "female"
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).
+		WithArgs(11).
+		WillReturnRows(userRows(2, "new@test.com"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET version = version + 1, gender = $1, gender_source = 'manual' WHERE id = $2;`)).
+		WithArgs("female", 11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.id = $1;`)).
+		WithArgs(11).
+		WillReturnRows(userRows(3, "new@test.com"))
+	mock.ExpectExec(auditQuery).
+		WithArgs(11, "edit", "system", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	_, err = storage.EditUser(context.Background(), 11, &schemas.UserPatch{Gender: &gender}, 2)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).
+		WithArgs(11).
+		WillReturnRows(userRows(3, "new@test.com"))
+	mock.ExpectRollback()
+
+	_, err = storage.EditUser(context.Background(), 11, &schemas.UserPatch{Gender: &gender}, 2)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).
+		WithArgs(12).
+		WillReturnRows(sqlmock.NewRows(userColumnNames))
+	mock.ExpectRollback()
+
+	_, err = storage.EditUser(context.Background(), 12, &schemas.UserPatch{Gender: &gender}, 0)
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).
+		WithArgs(11).
+		WillReturnRows(userRows(3, "new@test.com"))
+	mock.ExpectQuery(emailsQuery).
+		WithArgs(`{"taken@xn--80a1acny.xn--p1ai"}`, 11).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}).AddRow("taken@xn--80a1acny.xn--p1ai", 5))
+	mock.ExpectRollback()
+
+	_, err = storage.EditUser(context.Background(), 11, &schemas.UserPatch{Emails: &[]string{"taken@Почта.рф"}}, 0)
+	var conflictErr *EmailConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Equal(t, EmailConflictError{Email: "taken@xn--80a1acny.xn--p1ai", UserID: 5}, *conflictErr)
+	require.True(t, errors.Is(err, ErrConflict))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteUserVersion(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL FOR UPDATE;`)).
+		WithArgs(11).
+		WillReturnRows(sqlmock.NewRows(userColumnNames).
+			AddRow(11, "Test", "Testovich", 20, "female", "RU", "complete", nil, nil, 0, 0,
+				"enriched", "manual", "enriched", createdAt, 3, nil))
+	mock.ExpectRollback()
+
+	_, err = storage.DeleteUser(context.Background(), 11, 2)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeUser(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	lockQuery := regexp.QuoteMeta(`SELECT deleted_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE;`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs(12).WillReturnRows(sqlmock.NewRows([]string{"deleted"}).AddRow(false))
+	mock.ExpectRollback()
+
+	err = storage.PurgeUser(context.Background(), 12)
+	require.True(t, errors.Is(err, ErrConflict))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs(13).WillReturnRows(sqlmock.NewRows([]string{"deleted"}))
+	mock.ExpectRollback()
+
+	err = storage.PurgeUser(context.Background(), 13)
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs(11).WillReturnRows(sqlmock.NewRows([]string{"deleted"}).AddRow(true))
+	mock.
+		ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL;`)).
+		WithArgs(11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec(regexp.QuoteMeta(`SELECT set_config('app.audit_redact', 'on', true);`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec(regexp.QuoteMeta(`WITH redacted AS (UPDATE user_audit SET changes = '{}' WHERE user_id = $1)`)+`\s+`+
+			regexp.QuoteMeta(`INSERT INTO user_audit (user_id, action, actor, request_id, changes) VALUES ($1, 'purge', $2, $3, '{}');`)).
+		WithArgs(11, "system", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, storage.PurgeUser(context.Background(), 11))
+
+	auditRows := sqlmock.NewRows([]string{"id", "user_id", "action", "actor", "request_id", "changed_at", "changes"}).
+		AddRow(1, 11, "create", "operator", "", createdAt, []byte(`{}`)).
+		AddRow(2, 11, "purge", "system", "", createdAt, []byte(`{}`))
+	auditQuery := regexp.QuoteMeta(`SELECT ` + auditColumns + ` FROM user_audit WHERE user_id = $1 ORDER BY id;`)
+	mock.ExpectQuery(auditQuery).WithArgs(11).WillReturnRows(auditRows)
+
+	_, err = storage.History(context.Background(), 11)
+	require.True(t, errors.Is(err, ErrPurged))
+
+	mock.ExpectQuery(auditQuery).WithArgs(11).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "action", "actor", "request_id", "changed_at", "changes"}).
+		AddRow(1, 11, "create", "operator", "", createdAt, []byte(`{"name":{"before":null,"after":"Ivan"}}`)).
+		AddRow(2, 11, "purge", "system", "", createdAt.Add(time.Hour), []byte(`{}`)))
+
+	_, err = storage.GetUserAsOf(context.Background(), 11, createdAt)
+	require.True(t, errors.Is(err, ErrPurged))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAll(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	mock.
+		ExpectQuery(regexp.QuoteMeta(`SELECT ` + userColumns + ` FROM users u WHERE u.deleted_at IS NULL ORDER BY u.id;`)).
+		WillReturnRows(sqlmock.NewRows(userColumnNames).
+			AddRow(11, "Test", "Testovich", 20, "Male", "Russian", "complete", nil, "{first@test.com,second@test.com}", 0.98, 12,
+				"", "", "", createdAt, 1, `[{"country": "RU", "probability": 0.7}, {"country": "BY", "probability": 0.2}]`).
+			AddRow(12, "Other", "Testovich", 30, "Female", "Russian", "complete", nil, nil, 0, 0, "", "", "", createdAt, 1, nil),
+		)
+
+	got, err := storage.GetAll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []schemas.User{
+		{ID: 11, Name: "Test", Surname: "Testovich", Age: 20, Gender: "Male", Nationalize: "Russian",
+			Emails: []string{"first@test.com", "second@test.com"}, EnrichmentStatus: schemas.EnrichmentComplete,
+			GenderProbability: 0.98, AgeCount: 12,
+			Nationalities: []schemas.Nationality{{Country: "RU", Probability: 0.7}, {Country: "BY", Probability: 0.2}},
+			CreatedAt:     createdAt, Version: 1},
+		{ID: 12, Name: "Other", Surname: "Testovich", Age: 30, Gender: "Female", Nationalize: "Russian",
+			EnrichmentStatus: schemas.EnrichmentComplete, CreatedAt: createdAt, Version: 1},
+	}, got)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimEnrichmentJobs(t *testing.T) {
+	db, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	mock.
+		ExpectQuery(`FOR UPDATE SKIP LOCKED`).
+		WithArgs(2, int64(60000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "attempts", "refresh"}).
+			AddRow(11, "Test", "Testovich", 1, true),
+		)
+
+	got, err := storage.ClaimEnrichmentJobs(context.Background(), 2, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []EnrichmentJob{{UserID: 11, Name: "Test", Surname: "Testovich", Attempts: 1, Refresh: true}}, got)
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
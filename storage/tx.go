@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Коды ошибок Postgres, после которых транзакцию можно повторить целиком.
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+const (
+	maxTxAttempts = 3
+	txRetryDelay  = 20 * time.Millisecond
+)
+
+// inTx выполняет fn в транзакции: коммит, если fn вернула nil, иначе откат.
+// При ошибке сериализации или взаимной блокировке, в том числе при коммите,
+// fn повторяется в новой транзакции, поэтому она должна заново задавать все
+// значения, которые возвращает через замыкание.
+func (storage *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, storage.db, fn)
+		if err == nil || attempt >= maxTxAttempts || !retryableTx(err) {
+			return err
+		}
+
+		delay := txRetryDelay*time.Duration(attempt) + rand.N(txRetryDelay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Error begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError("Error commit", err)
+	}
+	return nil
+}
+
+func retryableTx(err error) bool {
+	var pgErr *pq.Error
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+}
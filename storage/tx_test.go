@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	storage := Storage{db: db}
+
+	// Ошибка сериализации при коммите повторяет транзакцию целиком.
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(&pq.Error{Code: pgSerializationFailure})
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	attempts := 0
+	err = storage.inTx(context.Background(), func(tx *sql.Tx) error {
+		attempts++
+		_, err := tx.ExecContext(context.Background(), `UPDATE users SET version = version + 1;`)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+
+	// Остальные ошибки откатывают транзакцию без повтора.
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO emails").WillReturnError(&pq.Error{Code: pgUniqueViolation})
+	mock.ExpectRollback()
+
+	err = storage.inTx(context.Background(), func(tx *sql.Tx) error {
+		return insertEmails(context.Background(), tx, 1, []string{"a@test.com"})
+	})
+	require.True(t, errors.Is(err, ErrConflict))
+
+	// Повторы ограничены maxTxAttempts.
+	for i := 0; i < maxTxAttempts; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnError(&pq.Error{Code: pgDeadlockDetected})
+		mock.ExpectRollback()
+	}
+
+	err = storage.inTx(context.Background(), func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(context.Background(), `UPDATE users SET version = version + 1;`)
+		return wrapError("Error exec", err)
+	})
+	require.Error(t, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
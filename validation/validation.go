@@ -0,0 +1,252 @@
+// Package validation проверяет структуры по правилам из тега validate.
+//
+// Правила перечисляются через запятую и проверяются по порядку, для поля
+// возвращается первая ошибка:
+//
+//	required        значение не пустое
+//	omitempty       пустое значение не проверяется дальше
+//	min=N, max=N    длина строки в символах, значение числа или длина списка
+//	name            имя из латинских или кириллических букв, допускаются
+//	                пробел, дефис и апостроф между буквами
+//	email           адрес по RFC 5322 без отображаемого имени
+//	iso3166         код страны ISO 3166-1 alpha-2
+//	oneof=a b       одно из перечисленных значений
+//	unique          элементы списка не повторяются (без учета регистра)
+//	dive            следующие правила применяются к каждому элементу списка
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// Validate проверяет все поля структуры и возвращает *storage.ValidationError
+// со списком всех неверных полей или nil.
+func Validate(value interface{}) error {
+	return validate(value, nil)
+}
+
+// ValidatePartial проверяет только поля, json имена которых есть в present.
+// Используется для частичного редактирования, где отсутствующие поля не меняются.
+func ValidatePartial(value interface{}, present map[string]bool) error {
+	return validate(value, present)
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+type checkFunc func(value reflect.Value, param string) string
+
+var checks map[string]checkFunc
+
+func init() {
+	checks = map[string]checkFunc{
+		"required": checkRequired,
+		"min":      checkMin,
+		"max":      checkMax,
+		"name":     checkName,
+		"email":    checkEmail,
+		"iso3166":  checkISO3166,
+		"oneof":    checkOneOf,
+		"unique":   checkUnique,
+	}
+}
+
+func validate(value interface{}, present map[string]bool) error {
+	structValue := reflect.Indirect(reflect.ValueOf(value))
+	structType := structValue.Type()
+
+	var fields []storage.FieldError
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		name := jsonName(field)
+		if present != nil && !present[name] {
+			continue
+		}
+
+		fields = append(fields, checkValue(name, structValue.Field(i), parseRules(tag))...)
+	}
+
+	if len(fields) > 0 {
+		return &storage.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func parseRules(tag string) []rule {
+	var rules []rule
+	for _, item := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if name != "dive" && name != "omitempty" && checks[name] == nil {
+			panic(fmt.Sprintf("validation: unknown rule %q", name))
+		}
+		rules = append(rules, rule{name: name, param: param})
+	}
+	return rules
+}
+
+func checkValue(name string, value reflect.Value, rules []rule) []storage.FieldError {
+	for i, rule := range rules {
+		switch rule.name {
+		case "omitempty":
+			if isEmpty(value) {
+				return nil
+			}
+		case "dive":
+			var fields []storage.FieldError
+			for j := 0; j < value.Len(); j++ {
+				fields = append(fields, checkValue(fmt.Sprintf("%s[%d]", name, j), value.Index(j), rules[i+1:])...)
+			}
+			return fields
+		default:
+			if message := checks[rule.name](value, rule.param); message != "" {
+				return []storage.FieldError{{Field: name, Message: message}}
+			}
+		}
+	}
+	return nil
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+func checkRequired(value reflect.Value, _ string) string {
+	if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" || isEmpty(value) {
+		return "is required"
+	}
+	return ""
+}
+
+func checkMin(value reflect.Value, param string) string {
+	limit, _ := strconv.Atoi(param)
+
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) < limit {
+			return fmt.Sprintf("must be at least %d characters long", limit)
+		}
+	case reflect.Slice:
+		if value.Len() < limit {
+			return fmt.Sprintf("must contain at least %d items", limit)
+		}
+	case reflect.Int:
+		if value.Int() < int64(limit) {
+			return fmt.Sprintf("must be at least %d", limit)
+		}
+	}
+	return ""
+}
+
+func checkMax(value reflect.Value, param string) string {
+	limit, _ := strconv.Atoi(param)
+
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) > limit {
+			return fmt.Sprintf("must be at most %d characters long", limit)
+		}
+	case reflect.Slice:
+		if value.Len() > limit {
+			return fmt.Sprintf("must contain at most %d items", limit)
+		}
+	case reflect.Int:
+		if value.Int() > int64(limit) {
+			return fmt.Sprintf("must be at most %d", limit)
+		}
+	}
+	return ""
+}
+
+func isNameLetter(r rune) bool {
+	return unicode.Is(unicode.Latin, r) || unicode.Is(unicode.Cyrillic, r)
+}
+
+func checkName(value reflect.Value, _ string) string {
+	const message = "must contain only Latin or Cyrillic letters, spaces, hyphens and apostrophes"
+
+	previousLetter := false
+	for _, r := range value.String() {
+		switch {
+		case isNameLetter(r) && unicode.IsLetter(r):
+			previousLetter = true
+		case unicode.Is(unicode.Mn, r) && previousLetter:
+			// Комбинируемые диакритические знаки, например й в форме NFD.
+		case strings.ContainsRune(" -'’", r) && previousLetter:
+			previousLetter = false
+		default:
+			return message
+		}
+	}
+
+	if !previousLetter {
+		return message
+	}
+	return ""
+}
+
+// checkEmail не учитывает пробелы по краям, их убирает storage.NormalizeEmail.
+func checkEmail(value reflect.Value, _ string) string {
+	email := strings.TrimSpace(value.String())
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func checkISO3166(value reflect.Value, _ string) string {
+	if !iso3166Alpha2[value.String()] {
+		return "must be an ISO 3166-1 alpha-2 country code"
+	}
+	return ""
+}
+
+func checkOneOf(value reflect.Value, param string) string {
+	for _, option := range strings.Fields(param) {
+		if value.String() == option {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must be one of: %s", strings.Join(strings.Fields(param), ", "))
+}
+
+func checkUnique(value reflect.Value, _ string) string {
+	seen := make(map[string]bool, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		item := strings.ToLower(strings.TrimSpace(fmt.Sprint(value.Index(i).Interface())))
+		if seen[item] {
+			return "must not contain duplicates"
+		}
+		seen[item] = true
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestValidateNewUser(t *testing.T) {
+	valid := []schemas.NewUser{
+		{Name: "Ivan", Surname: "Petrov", Emails: []string{"ivan@test.com"}},
+		{Name: "Иван", Surname: "Петров-Водкин"},
+		{Name: "Anne Marie", Surname: "O'Neil", Emails: []string{"a@test.com", "b@test.com"}},
+		{Name: "José", Surname: "Núñez"},
+		{Name: "Ivan", Surname: "Petrov", Emails: []string{" Foo@Example.COM "}},
+	}
+	for _, user := range valid {
+		require.NoError(t, Validate(&user), user)
+	}
+
+	err := Validate(&schemas.NewUser{
+		Name:    "",
+		Surname: "Petrov1",
+		Emails:  []string{"ivan@test.com", "Ivan <ivan@other.com>", "not an email"},
+	})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, storage.ErrValidation))
+
+	var validationErr *storage.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []storage.FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "surname", Message: "must contain only Latin or Cyrillic letters, spaces, hyphens and apostrophes"},
+		{Field: "emails[1]", Message: "must be a valid email address"},
+		{Field: "emails[2]", Message: "must be a valid email address"},
+	}, validationErr.Fields)
+
+	err = Validate(&schemas.NewUser{Name: "Ivan", Surname: "Petrov", Emails: []string{"a@test.com", " A@test.com"}})
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []storage.FieldError{{Field: "emails", Message: "must not contain duplicates"}}, validationErr.Fields)
+}
+
+func TestValidatePartial(t *testing.T) {
+	edit := schemas.EditUser{Age: 200, Gender: "unknown", Nationalize: "XX"}
+
+	require.NoError(t, ValidatePartial(&edit, map[string]bool{}))
+
+	err := ValidatePartial(&edit, map[string]bool{"age": true, "gender": true, "nationalize": true})
+	var validationErr *storage.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []storage.FieldError{
+		{Field: "gender", Message: "must be one of: male, female"},
+		{Field: "age", Message: "must be at most 150"},
+		{Field: "nationalize", Message: "must be an ISO 3166-1 alpha-2 country code"},
+	}, validationErr.Fields)
+
+	edit = schemas.EditUser{Gender: "", Nationalize: "RU"}
+	require.NoError(t, ValidatePartial(&edit, map[string]bool{"gender": true, "nationalize": true}))
+}
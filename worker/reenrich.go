@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+const (
+	defaultReenrichRate = 5
+	reenrichPageSize    = 100
+)
+
+// ErrAlreadyRunning запуск с таким именем уже выполняется в этом процессе.
+var ErrAlreadyRunning = fmt.Errorf("Reenrichment is already running: %w", storage.ErrConflict)
+
+// ReenrichOptions параметры повторного обогащения.
+type ReenrichOptions struct {
+	// Run имя запуска для контрольной точки, по умолчанию Filter.String().
+	// Повторный запуск с тем же именем продолжает с места остановки.
+	Run    string
+	Filter storage.ReenrichFilter
+	// Сколько пользователей в секунду ставить в очередь, 0 берет значение из конфига.
+	Rate float64
+}
+
+// Reenricher ставит выбранных пользователей в очередь обогащения с
+// ограничением скорости. Сами запросы к провайдерам выполняет Pool, поэтому
+// повторы и пакеты работают так же, как для новых пользователей. Кэш
+// провайдеров не читается, а обновляется, см. EnrichmentJob.Refresh.
+type Reenricher struct {
+	storage storage.StorageInterface
+	config  config.Reenrich
+
+	mu      sync.Mutex
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+func NewReenricher(storage storage.StorageInterface, reenrichConfig *config.Reenrich) *Reenricher {
+	reenricher := &Reenricher{
+		storage: storage,
+		config:  *reenrichConfig,
+		running: make(map[string]bool),
+	}
+
+	if reenricher.config.Rate <= 0 {
+		reenricher.config.Rate = defaultReenrichRate
+	}
+
+	return reenricher
+}
+
+// Start выполняет Run в фоне и возвращает имя запуска. Запуск
+// останавливается отменой ctx, дождаться его можно через Wait.
+func (reenricher *Reenricher) Start(ctx context.Context, options ReenrichOptions) (string, error) {
+	run := options.run()
+	if err := reenricher.lock(run); err != nil {
+		return "", err
+	}
+
+	reenricher.wg.Add(1)
+	go func() {
+		defer reenricher.wg.Done()
+		defer reenricher.unlock(run)
+
+		if _, err := reenricher.run(ctx, run, &options); err != nil {
+			log.Printf("Error reenrich %s: %v", run, err)
+		}
+	}()
+
+	return run, nil
+}
+
+// Wait ждет завершения запусков из Start, в том числе сохранения их
+// контрольных точек после отмены.
+func (reenricher *Reenricher) Wait() {
+	reenricher.wg.Wait()
+}
+
+// Run ставит пользователей в очередь и возвращает их число. Прогресс
+// сохраняется после каждой страницы и при отмене ctx, после завершения
+// контрольная точка удаляется.
+func (reenricher *Reenricher) Run(ctx context.Context, options ReenrichOptions) (int, error) {
+	run := options.run()
+	if err := reenricher.lock(run); err != nil {
+		return 0, err
+	}
+	defer reenricher.unlock(run)
+
+	return reenricher.run(ctx, run, &options)
+}
+
+func (options *ReenrichOptions) run() string {
+	if options.Run != "" {
+		return options.Run
+	}
+	return options.Filter.String()
+}
+
+func (reenricher *Reenricher) lock(run string) error {
+	reenricher.mu.Lock()
+	defer reenricher.mu.Unlock()
+
+	if reenricher.running[run] {
+		return fmt.Errorf("%s: %w", run, ErrAlreadyRunning)
+	}
+	reenricher.running[run] = true
+	return nil
+}
+
+func (reenricher *Reenricher) unlock(run string) {
+	reenricher.mu.Lock()
+	defer reenricher.mu.Unlock()
+
+	delete(reenricher.running, run)
+}
+
+func (reenricher *Reenricher) run(ctx context.Context, run string, options *ReenrichOptions) (int, error) {
+	rate := options.Rate
+	if rate <= 0 {
+		rate = reenricher.config.Rate
+	}
+
+	lastID, resumed, err := reenricher.storage.GetCheckpoint(ctx, run)
+	if err != nil {
+		return 0, err
+	}
+	if resumed {
+		log.Printf("Resuming reenrichment %s after user %d", run, lastID)
+	} else {
+		log.Printf("Starting reenrichment %s", run)
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	// Контрольная точка сохраняется и после отмены ctx.
+	saveCheckpoint := func() error {
+		return reenricher.storage.SaveCheckpoint(context.WithoutCancel(ctx), run, lastID)
+	}
+
+	// Отмена может прийти и посреди запроса к хранилищу, прогресс
+	// сохраняется при любом выходе по ctx.
+	finished := false
+	defer func() {
+		if ctx.Err() != nil && !finished {
+			if err := saveCheckpoint(); err != nil {
+				log.Printf("Error save reenrichment checkpoint %s: %v", run, err)
+			}
+		}
+	}()
+
+	enqueued := 0
+	for {
+		ids, err := reenricher.storage.SelectForReenrichment(ctx, &options.Filter, lastID, reenrichPageSize)
+		if err != nil {
+			return enqueued, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			select {
+			case <-ctx.Done():
+				return enqueued, ctx.Err()
+			case <-ticker.C:
+			}
+
+			if err := reenricher.storage.EnqueueEnrichment(ctx, []int{id}); err != nil {
+				return enqueued, err
+			}
+			lastID = id
+			enqueued++
+		}
+
+		if err := saveCheckpoint(); err != nil {
+			return enqueued, err
+		}
+	}
+
+	if err := reenricher.storage.DeleteCheckpoint(ctx, run); err != nil {
+		return enqueued, err
+	}
+	finished = true
+
+	log.Printf("Reenrichment %s finished, enqueued users: %d", run, enqueued)
+	return enqueued, nil
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+func TestReenricher(t *testing.T) {
+	memory := storage.NewMemory()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := memory.AddUser(ctx, &schemas.User{Name: "Ivan", Surname: "Petrov"})
+		require.NoError(t, err)
+	}
+
+	reenricher := NewReenricher(memory, &config.Reenrich{Rate: 1000})
+
+	// Запуск продолжается с контрольной точки.
+	require.NoError(t, memory.SaveCheckpoint(ctx, "all", 1))
+
+	enqueued, err := reenricher.Run(ctx, ReenrichOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, enqueued)
+
+	_, ok, err := memory.GetCheckpoint(ctx, "all")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	jobs, err := memory.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3}, []int{jobs[0].UserID, jobs[1].UserID})
+	require.True(t, jobs[0].Refresh)
+}
+
+func TestReenricherCancel(t *testing.T) {
+	memory := storage.NewMemory()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := memory.AddUser(ctx, &schemas.User{Name: "Ivan", Surname: "Petrov"})
+		require.NoError(t, err)
+	}
+
+	reenricher := NewReenricher(memory, &config.Reenrich{Rate: 20})
+
+	runCtx, cancel := context.WithTimeout(ctx, 75*time.Millisecond)
+	defer cancel()
+
+	enqueued, err := reenricher.Run(runCtx, ReenrichOptions{Run: "slow"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	lastID, ok, err := memory.GetCheckpoint(ctx, "slow")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, enqueued, lastID)
+
+	startCtx, stop := context.WithCancel(ctx)
+	_, err = reenricher.Start(startCtx, ReenrichOptions{Run: "slow", Rate: 0.001})
+	require.NoError(t, err)
+	_, err = reenricher.Run(ctx, ReenrichOptions{Run: "slow"})
+	require.True(t, errors.Is(err, storage.ErrConflict))
+
+	// После отмены фоновый запуск сохраняет контрольную точку и снимает блокировку.
+	stop()
+	reenricher.Wait()
+
+	_, ok, err = memory.GetCheckpoint(ctx, "slow")
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = reenricher.Start(startCtx, ReenrichOptions{Run: "slow"})
+	require.NoError(t, err)
+	reenricher.Wait()
+}
@@ -0,0 +1,212 @@
+// Package worker в фоне заполняет возраст, пол и национальность новых
+// пользователей по очереди заданий в хранилище.
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// Значения по умолчанию для незаданных полей enrichment.worker.
+const (
+	defaultWorkers      = 4
+	defaultBatchSize    = 10
+	defaultPollInterval = time.Second
+	defaultLease        = time.Minute
+	defaultMaxAttempts  = 5
+	defaultBackoffBase  = 10 * time.Second
+	defaultBackoffMax   = 10 * time.Minute
+)
+
+// Pool обработчики очереди обогащения. Задания забираются через
+// storage.ClaimEnrichmentJobs, поэтому несколько экземпляров сервиса могут
+// работать с одной базой.
+type Pool struct {
+	storage  storage.StorageInterface
+	enricher metadata.Enricher
+	config   config.Worker
+
+	mu      sync.Mutex
+	waiters map[int][]chan struct{}
+}
+
+func New(storage storage.StorageInterface, enricher metadata.Enricher, workerConfig *config.Worker) *Pool {
+	pool := &Pool{
+		storage:  storage,
+		enricher: enricher,
+		config:   *workerConfig,
+		waiters:  make(map[int][]chan struct{}),
+	}
+
+	if pool.config.Workers <= 0 {
+		pool.config.Workers = defaultWorkers
+	}
+	if pool.config.BatchSize <= 0 {
+		pool.config.BatchSize = defaultBatchSize
+	}
+	if pool.config.PollInterval <= 0 {
+		pool.config.PollInterval = defaultPollInterval
+	}
+	if pool.config.Lease <= 0 {
+		pool.config.Lease = defaultLease
+	}
+	if pool.config.MaxAttempts <= 0 {
+		pool.config.MaxAttempts = defaultMaxAttempts
+	}
+	if pool.config.BackoffBase <= 0 {
+		pool.config.BackoffBase = defaultBackoffBase
+	}
+	if pool.config.BackoffMax <= 0 {
+		pool.config.BackoffMax = defaultBackoffMax
+	}
+
+	return pool
+}
+
+// auditActor автор результатов обогащения в истории пользователя.
+const auditActor = "enrichment"
+
+// Run обрабатывает задания, пока не отменен ctx, и ждет завершения текущих.
+func (pool *Pool) Run(ctx context.Context) {
+	log.Printf("Starting %d enrichment workers", pool.config.Workers)
+	ctx = storage.WithAuditInfo(ctx, storage.AuditInfo{Actor: auditActor})
+
+	var wg sync.WaitGroup
+	for i := 0; i < pool.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("Enrichment workers stopped")
+}
+
+func (pool *Pool) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := pool.storage.ClaimEnrichmentJobs(ctx, pool.config.BatchSize, pool.config.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error claim enrichment jobs: %v", err)
+		}
+
+		if len(jobs) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(pool.config.PollInterval):
+			}
+			continue
+		}
+
+		// Задания выполняются одновременно, что бы metadata.Batcher мог
+		// объединить их запросы к провайдерам.
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pool.process(ctx, job)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func (pool *Pool) process(ctx context.Context, job storage.EnrichmentJob) {
+	enrichCtx, cancel := context.WithTimeout(ctx, pool.config.Lease)
+	defer cancel()
+	if job.Refresh {
+		enrichCtx = metadata.WithRefresh(enrichCtx)
+	}
+
+	result, err := pool.enricher.Enrich(enrichCtx, job.Name, job.Surname)
+	if ctx.Err() != nil {
+		// Сервис останавливается, задание будет выдано снова после lease.
+		return
+	}
+
+	if err != nil && job.Attempts < pool.config.MaxAttempts {
+		delay := pool.backoff(job.Attempts)
+		log.Printf("Error enrich user %d, attempt %d, retry in %s: %v", job.UserID, job.Attempts, delay, err)
+
+		if err := pool.storage.RetryEnrichment(ctx, job.UserID, delay, err.Error()); err != nil {
+			log.Printf("Error retry enrichment of user %d: %v", job.UserID, err)
+		}
+		return
+	}
+
+	status := schemas.EnrichmentComplete
+	if err != nil {
+		log.Printf("Error enrich user %d, giving up after %d attempts: %v", job.UserID, job.Attempts, err)
+
+		status = schemas.EnrichmentPartial
+		if result.Empty() {
+			status = schemas.EnrichmentFailed
+		}
+	}
+	if result == nil {
+		result = &metadata.Result{}
+	}
+
+	if err := pool.storage.CompleteEnrichment(ctx, job.UserID, result, status); err != nil {
+		log.Printf("Error complete enrichment of user %d: %v", job.UserID, err)
+		return
+	}
+
+	log.Printf("User %d enrichment finished with status %s", job.UserID, status)
+	pool.notify(job.UserID)
+}
+
+func (pool *Pool) backoff(attempt int) time.Duration {
+	delay := pool.config.BackoffBase << (attempt - 1)
+	if delay <= 0 || delay > pool.config.BackoffMax {
+		delay = pool.config.BackoffMax
+	}
+	return delay
+}
+
+// Wait возвращает канал, который закроется, когда этот экземпляр сервиса
+// завершит обогащение пользователя. Задание может выполнить и другой
+// экземпляр, поэтому ожидающие должны дополнительно опрашивать хранилище.
+// Вызов stop отменяет подписку.
+func (pool *Pool) Wait(id int) (done <-chan struct{}, stop func()) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	waiter := make(chan struct{})
+	pool.waiters[id] = append(pool.waiters[id], waiter)
+
+	return waiter, func() {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+
+		waiters := pool.waiters[id]
+		for i, item := range waiters {
+			if item == waiter {
+				pool.waiters[id] = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(pool.waiters[id]) == 0 {
+			delete(pool.waiters, id)
+		}
+	}
+}
+
+func (pool *Pool) notify(id int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, waiter := range pool.waiters[id] {
+		close(waiter)
+	}
+	delete(pool.waiters, id)
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nkhamm-spb/red_soft_test/config"
+	"github.com/nkhamm-spb/red_soft_test/metadata"
+	"github.com/nkhamm-spb/red_soft_test/schemas"
+	"github.com/nkhamm-spb/red_soft_test/storage"
+)
+
+// flakyEnricher определяет возраст всегда, а пол только с попытки succeedAt.
+type flakyEnricher struct {
+	mu        sync.Mutex
+	calls     int
+	succeedAt int
+}
+
+func (enricher *flakyEnricher) Enrich(ctx context.Context, name string, surname string) (*metadata.Result, error) {
+	enricher.mu.Lock()
+	defer enricher.mu.Unlock()
+
+	enricher.calls++
+	if enricher.succeedAt == 0 || enricher.calls < enricher.succeedAt {
+		return &metadata.Result{Age: 42}, errors.New("genderize is unavailable")
+	}
+	return &metadata.Result{Age: 42, Gender: "male"}, nil
+}
+
+func runPool(t *testing.T, enricher metadata.Enricher) (*storage.Memory, *Pool) {
+	memory := storage.NewMemory()
+	pool := New(memory, enricher, &config.Worker{
+		Workers:      2,
+		PollInterval: time.Millisecond,
+		MaxAttempts:  3,
+		BackoffBase:  time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return memory, pool
+}
+
+func addAndWait(t *testing.T, memory *storage.Memory, pool *Pool) *schemas.User {
+	user, err := memory.AddUser(context.Background(), &schemas.User{Name: "Ivan", Surname: "Petrov",
+		EnrichmentStatus: schemas.EnrichmentPending})
+	require.NoError(t, err)
+
+	done, stop := pool.Wait(user.ID)
+	defer stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("enrichment is not finished")
+	}
+
+	user, err = memory.GetUserById(context.Background(), user.ID)
+	require.NoError(t, err)
+	return user
+}
+
+func TestPoolRetry(t *testing.T) {
+	enricher := &flakyEnricher{succeedAt: 2}
+	memory, pool := runPool(t, enricher)
+
+	user := addAndWait(t, memory, pool)
+	require.Equal(t, schemas.EnrichmentComplete, user.EnrichmentStatus)
+	require.Equal(t, 42, user.Age)
+	require.Equal(t, "male", user.Gender)
+	require.Equal(t, 2, enricher.calls)
+}
+
+func TestPoolPartial(t *testing.T) {
+	enricher := &flakyEnricher{}
+	memory, pool := runPool(t, enricher)
+
+	user := addAndWait(t, memory, pool)
+	require.Equal(t, schemas.EnrichmentPartial, user.EnrichmentStatus)
+	require.Equal(t, 42, user.Age)
+	require.Equal(t, 3, enricher.calls)
+}